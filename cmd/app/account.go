@@ -0,0 +1,200 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ekachaikeaw/social/internal/store"
+)
+
+// purgeBatchSize is the number of due accounts removed per transaction
+const purgeBatchSize = 100
+
+type DeleteAccountPayload struct {
+	Password string `json:"password" validate:"required,max=72"`
+}
+
+type AccountDeletion struct {
+	DeleteAfter time.Time `json:"delete_after"`
+}
+
+// exportAccountHandler godoc
+//
+//	@Summary		Downloads the account data
+//	@Description	Returns a ZIP with the profile, posts, comments, follows and reactions of the authenticated user as JSON files
+//	@Tags			users
+//	@Produce		application/zip
+//	@Success		200	{file}		file
+//	@Failure		401	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/export [get]
+func (a *application) exportAccountHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	export, err := a.store.Users.Export(r.Context(), user.ID)
+	if err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	files := []struct {
+		name string
+		data any
+	}{
+		{"profile.json", export.Profile},
+		{"posts.json", export.Posts},
+		{"comments.json", export.Comments},
+		{"following.json", export.Following},
+		{"followers.json", export.Followers},
+		{"reactions.json", export.Reactions},
+	}
+
+	// built in memory so a failure can still be reported as an error
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			a.internalServerError(w, r, err)
+			return
+		}
+
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.data); err != nil {
+			a.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="gophersocial-%s.zip"`, export.Profile.Username))
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// deleteAccountHandler godoc
+//
+//	@Summary		Deletes the account
+//	@Description	Schedules the account of the authenticated user for deletion. Logging in before the grace period ends cancels it.
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		DeleteAccountPayload	true	"Current password"
+//	@Success		202		{object}	AccountDeletion
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me [delete]
+func (a *application) deleteAccountHandler(w http.ResponseWriter, r *http.Request) {
+	var payload DeleteAccountPayload
+	if err := readJson(w, r, &payload); err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	c := r.Context()
+
+	// the cached user has no password hash
+	user, err := a.store.Users.GetByID(c, getUserFromCtx(r).ID)
+	if err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	if err := user.Password.Compare(payload.Password); err != nil {
+		a.badRequestResponse(w, r, errors.New("password is incorrect"))
+		return
+	}
+
+	deletion := AccountDeletion{DeleteAfter: time.Now().Add(a.config.account.deletionGrace).Truncate(time.Second)}
+	if err := a.store.Users.ScheduleDeletion(c, user.ID, deletion.DeleteAfter); err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	if a.config.redis.enable {
+		a.cacheStore.Users.Delete(c, user.ID)
+	}
+
+	if err := a.jsonResponse(w, http.StatusAccepted, deletion); err != nil {
+		a.internalServerError(w, r, err)
+	}
+}
+
+// purgeDeletedAccounts removes the accounts whose grace period ended every
+// account.purgeInterval until c is done
+func (app *application) purgeDeletedAccounts(c context.Context) {
+	ticker := time.NewTicker(app.config.account.purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for {
+			users, err := app.store.Users.PurgeDeleted(c, app.config.account.anonymize, purgeBatchSize)
+			if err != nil {
+				app.logger.Errorw("error purging deleted accounts", "error", err)
+				break
+			}
+
+			for _, u := range users {
+				if app.config.redis.enable {
+					app.cacheStore.Users.Delete(c, u.ID)
+				}
+				if err := app.media.Delete(c, u.AvatarURL); err != nil {
+					app.logger.Warnw("error deleting avatar", "user_id", u.ID, "error", err)
+				}
+			}
+
+			if len(users) > 0 {
+				app.logger.Infow("purged deleted accounts", "count", len(users), "anonymize", app.config.account.anonymize)
+			}
+
+			if len(users) < purgeBatchSize {
+				break
+			}
+		}
+	}
+}
+
+// cancelDeletion keeps an account scheduled for deletion, called when its
+// owner logs in again
+func (a *application) cancelDeletion(c context.Context, user *store.User) error {
+	if user.DeleteAfter == nil {
+		return nil
+	}
+
+	if err := a.store.Users.CancelDeletion(c, user.ID); err != nil {
+		return err
+	}
+	user.DeleteAfter = nil
+
+	if a.config.redis.enable {
+		a.cacheStore.Users.Delete(c, user.ID)
+	}
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccountExport(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "/v1/users/me/export", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken)
+
+	rr := executeRequest(req, mux)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+
+	if ct := rr.Header().Get("Content-Type"); ct != "application/zip" {
+		t.Fatalf("expected application/zip, got %q", ct)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	for _, name := range []string{"profile.json", "posts.json", "comments.json", "following.json", "followers.json", "reactions.json"} {
+		if files[name] == nil {
+			t.Errorf("expected %s in the export", name)
+		}
+	}
+
+	f, err := files["posts.json"].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var posts []map[string]any
+	if err := json.NewDecoder(f).Decode(&posts); err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 1 || posts[0]["title"] != "hello" {
+		t.Errorf("unexpected posts %v", posts)
+	}
+}
+
+// deletionUserStore remembers when the deletion of the user of a
+// memoryUserStore was scheduled
+type deletionUserStore struct {
+	*memoryUserStore
+
+	deleteAfter *time.Time
+}
+
+func (s *deletionUserStore) ScheduleDeletion(c context.Context, userID int64, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deleteAfter = &at
+	return nil
+}
+
+func TestAccountDeletion(t *testing.T) {
+	app := newTestApplication(t, config{account: accountConfig{deletionGrace: 24 * time.Hour}})
+	users := &deletionUserStore{memoryUserStore: newMemoryUserStore(t, "gopher@example.com", "password")}
+	app.store.Users = users
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(body string, auth bool) *http.Response {
+		req, err := http.NewRequest(http.MethodDelete, "/v1/users/me", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if auth {
+			req.Header.Set("Authorization", "Bearer "+testToken)
+		}
+		return executeRequest(req, mux).Result()
+	}
+
+	tests := []struct {
+		name string
+		body string
+		auth bool
+		code int
+	}{
+		{"should require the password", `{"password":"wrong"}`, true, http.StatusBadRequest},
+		{"should require a payload", `{}`, true, http.StatusBadRequest},
+		{"should not delete unauthenticated", `{"password":"password"}`, false, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkResponseCode(t, tt.code, request(tt.body, tt.auth).StatusCode)
+			if users.deleteAfter != nil {
+				t.Error("expected no deletion scheduled")
+			}
+		})
+	}
+
+	t.Run("should schedule the deletion after the grace period", func(t *testing.T) {
+		res := request(`{"password":"password"}`, true)
+		checkResponseCode(t, http.StatusAccepted, res.StatusCode)
+
+		var body struct {
+			Data AccountDeletion `json:"data"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+
+		if users.deleteAfter == nil || !users.deleteAfter.Equal(body.Data.DeleteAfter) {
+			t.Fatalf("scheduled %v, answered %v", users.deleteAfter, body.Data.DeleteAfter)
+		}
+		if d := time.Until(body.Data.DeleteAfter); d < 23*time.Hour || d > 24*time.Hour {
+			t.Errorf("expected the deletion in a day, got %v", d)
+		}
+	})
+}
@@ -13,12 +13,16 @@ import (
 	"fmt"
 
 	"github.com/ekachaikeaw/social/docs" // This is required for generated swagger docs
+	"github.com/ekachaikeaw/social/internal/activitypub"
 	"github.com/ekachaikeaw/social/internal/auth"
 	"github.com/ekachaikeaw/social/internal/env"
 	"github.com/ekachaikeaw/social/internal/mailer"
+	"github.com/ekachaikeaw/social/internal/media"
 	"github.com/ekachaikeaw/social/internal/ratelimiter"
 	"github.com/ekachaikeaw/social/internal/store"
 	"github.com/ekachaikeaw/social/internal/store/cache"
+	"github.com/ekachaikeaw/social/internal/stream"
+	"github.com/ekachaikeaw/social/internal/username"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
@@ -36,6 +40,12 @@ type application struct {
 	mailer        mailer.Client
 	authenticator auth.Authenticator
 	ratelimiter   ratelimiter.Limiter
+	mailLimiter   ratelimiter.Limiter
+	federation    *activitypub.Client
+	actorKeys     *activitypub.KeyCache
+	broker        stream.Broker
+	media         media.Store
+	usernames     *username.Policy
 }
 
 type config struct {
@@ -48,17 +58,71 @@ type config struct {
 	mail        mailConfig
 	frontedURL  string
 	auth        authConfig
+	feed        feedConfig
+	federation  federationConfig
+	stream      streamConfig
+	gateway     gatewayConfig
+	media       mediaConfig
+	account     accountConfig
+	username    usernameConfig
+}
+
+type usernameConfig struct {
+	reserved       []string
+	changeCooldown time.Duration
+	hold           time.Duration
+}
+
+type accountConfig struct {
+	deletionGrace time.Duration
+	purgeInterval time.Duration
+	anonymize     bool
+}
+
+type mediaConfig struct {
+	dir string
+	url string
+}
+
+type gatewayConfig struct {
+	allowedOrigin string
+	rateLimiter   ratelimiter.Config
+}
+
+type streamConfig struct {
+	heartbeat time.Duration
+}
+
+type federationConfig struct {
+	enable  bool
+	baseURL string
+	keyTTL  time.Duration
+}
+
+type feedConfig struct {
+	cursorSecret string
+	fanout       bool
+	ranking      store.Ranking
 }
 
 type authConfig struct {
 	basic basicConfig
 	token tokenConfig
+	totp  totpConfig
+}
+
+type totpConfig struct {
+	issuer       string
+	challengeExp time.Duration
 }
 
 type tokenConfig struct {
-	secret string
-	exp    time.Duration
-	iss    string
+	secret               string
+	signingKeyFile       string
+	verificationKeyFiles []string
+	exp                  time.Duration
+	refreshExp           time.Duration
+	iss                  string
 }
 
 type basicConfig struct {
@@ -67,10 +131,13 @@ type basicConfig struct {
 }
 
 type mailConfig struct {
-	fromEmail string
-	sendGrid  sendGridConfig
-	mailTrap  mailTrapConfig
-	exp       time.Duration
+	fromEmail   string
+	sendGrid    sendGridConfig
+	mailTrap    mailTrapConfig
+	exp         time.Duration
+	resetExp    time.Duration
+	revertExp   time.Duration
+	rateLimiter ratelimiter.Config
 }
 
 type mailTrapConfig struct {
@@ -103,8 +170,8 @@ func (app *application) mount() http.Handler {
 	r.Use(middleware.Recoverer)
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{env.GetString("CORS_ALLOWED_ORIGIN", "http://localhost:5174")},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "Last-Event-ID"},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: false,
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
@@ -113,7 +180,21 @@ func (app *application) mount() http.Handler {
 	// Set a timeout value on the request context (ctx), that will signal
 	// through ctx.Done() that the request has timed out and further
 	// processing should be stopped.
-	r.Use(middleware.Timeout(60 * time.Second))
+	r.Use(app.TimeoutMiddleware(60*time.Second, "/v1/gateway", "/v1/users/feed/stream"))
+	r.Get("/.well-known/jwks.json", app.jwksHandler)
+	if app.config.federation.enable {
+		r.Get("/.well-known/webfinger", app.webfingerHandler)
+
+		r.Route("/ap", func(r chi.Router) {
+			r.Route("/users/{userID}", func(r chi.Router) {
+				r.Get("/", app.getActorHandler)
+				r.Get("/outbox", app.getOutboxHandler)
+				r.Post("/inbox", app.postInboxHandler)
+			})
+			r.Get("/posts/{postID}", app.getNoteHandler)
+		})
+	}
+
 	r.Route("/v1", func(r chi.Router) {
 		// r.With(app.BasicAuthMiddleware()).
 		r.Get("/health", app.healthCheckHandler)
@@ -122,6 +203,13 @@ func (app *application) mount() http.Handler {
 		docsURL := fmt.Sprintf("%s/swagger/doc.json", app.config.addr)
 		r.Get("/swagger/*", httpSwagger.Handler(httpSwagger.URL(docsURL)))
 
+		r.Get("/gateway", app.gatewayHandler)
+
+		// only stores that keep files locally serve them
+		if h, ok := app.media.(http.Handler); ok {
+			r.Handle("/media/*", h)
+		}
+
 		r.Route("/posts", func(r chi.Router) {
 			r.Use(app.AuthTokenMiddleware)
 			r.Post("/", app.createPostHandler)
@@ -131,6 +219,9 @@ func (app *application) mount() http.Handler {
 
 				r.Get("/", app.getPostHandler)
 
+				r.Put("/reactions", app.reactToPostHandler)
+				r.Delete("/reactions", app.deleteReactionHandler)
+
 				r.Patch("/", app.checkPostOwnership("moderator", app.updatePostHandler))
 				r.Delete("/", app.checkPostOwnership("admin", app.deletePostHandler))
 			})
@@ -138,24 +229,95 @@ func (app *application) mount() http.Handler {
 
 		r.Route("/users", func(r chi.Router) {
 			r.Put("/activate/{token}", app.activateUserHandler)
+			r.Get("/available", app.usernameAvailableHandler)
+			r.Put("/email/confirm/{token}", app.confirmEmailHandler)
+			r.Put("/email/revert/{token}", app.revertEmailHandler)
 
-			r.Route("/{userID}", func(r chi.Router) {
+			r.Group(func(r chi.Router) {
 				r.Use(app.AuthTokenMiddleware)
-				r.Get("/", app.getUserHandler)
+				r.Patch("/me", app.updateProfileHandler)
+				r.Delete("/me", app.deleteAccountHandler)
+				r.Get("/me/export", app.exportAccountHandler)
+				r.Put("/me/avatar", app.uploadAvatarHandler)
+				r.Put("/me/password", app.changePasswordHandler)
+				r.Put("/me/email", app.changeEmailHandler)
+				r.Put("/me/username", app.changeUsernameHandler)
+				r.Get("/me/usernames", app.getUsernameHistoryHandler)
+				r.Post("/me/2fa", app.enrollTOTPHandler)
+				r.Post("/me/2fa/confirm", app.confirmTOTPHandler)
+				r.Delete("/me/2fa", app.disableTOTPHandler)
+				r.Get("/by-username/{username}", app.getUserByUsernameHandler)
+				r.Get("/suggestions", app.getSuggestionsHandler)
+			})
 
-				r.Put("/follow", app.followUserHandler)
-				r.Put("/unfollow", app.unfollowUserHandler)
+			r.Route("/{userID}", func(r chi.Router) {
+				r.Get("/feed.atom", app.getUserAtomFeedHandler)
+				r.Get("/feed.rss", app.getUserRSSFeedHandler)
+
+				r.Group(func(r chi.Router) {
+					r.Use(app.AuthTokenMiddleware)
+					r.Get("/", app.getUserHandler)
+					r.Get("/followers", app.getFollowersHandler)
+					r.Get("/following", app.getFollowingHandler)
+
+					r.Put("/follow", app.followUserHandler)
+					r.Put("/unfollow", app.unfollowUserHandler)
+				})
 			})
 
 			r.Group(func(r chi.Router) {
 				r.Use(app.AuthTokenMiddleware)
 				r.Get("/feed", app.getUserFeedHandler)
+				r.Get("/feed/stream", app.streamFeedHandler)
 			})
 		})
 
+		r.With(app.AuthTokenMiddleware).Get("/explore", app.getExploreHandler)
+
+		r.Route("/follow-requests", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+
+			r.Get("/incoming", app.getIncomingFollowRequestsHandler)
+			r.Get("/outgoing", app.getOutgoingFollowRequestsHandler)
+			r.Put("/{userID}/approve", app.approveFollowRequestHandler)
+			r.Put("/{userID}/reject", app.rejectFollowRequestHandler)
+		})
+
+		r.Route("/blocks", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+
+			r.Get("/", app.getBlockedUsersHandler)
+			r.Put("/{userID}", app.blockUserHandler)
+			r.Delete("/{userID}", app.unblockUserHandler)
+		})
+
+		r.Route("/mutes", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+
+			r.Get("/users", app.getMutedUsersHandler)
+			r.Put("/users/{userID}", app.muteUserHandler)
+			r.Delete("/users/{userID}", app.unmuteUserHandler)
+
+			r.Get("/keywords", app.getMutedKeywordsHandler)
+			r.Post("/keywords", app.muteKeywordHandler)
+			r.Delete("/keywords/{keywordID}", app.unmuteKeywordHandler)
+		})
+
+		r.Route("/tags/{tag}", func(r chi.Router) {
+			r.Get("/feed.atom", app.getTagAtomFeedHandler)
+			r.Get("/feed.rss", app.getTagRSSFeedHandler)
+		})
+
 		r.Route("/authentication", func(r chi.Router) {
 			r.Post("/user", app.registerUserHandler)
 			r.Post("/token", app.createUserTokenHandler)
+			r.Post("/token/2fa", app.verifyTwoFactorHandler)
+			r.Post("/refresh", app.refreshTokenHandler)
+			r.With(app.AuthTokenMiddleware).Post("/logout", app.logoutHandler)
+			r.With(app.AuthTokenMiddleware).Post("/logout-all", app.logoutAllHandler)
+			r.Post("/resend-activation", app.resendActivationHandler)
+			r.Post("/forgot-password", app.forgotPasswordHandler)
+			r.Post("/reset-password", app.resetPasswordHandler)
 		})
 	})
 
@@ -174,6 +336,16 @@ func (app *application) run(mux http.Handler) error {
 		IdleTimeout:  time.Minute,
 	}
 
+	// event streams never go idle on their own
+	srv.RegisterOnShutdown(func() {
+		app.broker.Close()
+	})
+
+	background, stopBackground := context.WithCancel(context.Background())
+	srv.RegisterOnShutdown(stopBackground)
+	go app.purgeDeletedAccounts(background)
+	go app.backfillSkeletons(background)
+
 	shutdown := make(chan error)
 
 	go func() {
@@ -46,4 +46,40 @@ func TestRateLimiterMiddleware(t *testing.T) {
 			}
 		}
 	}
-}
\ No newline at end of file
+}
+func TestTimeoutMiddleware(t *testing.T) {
+	app := newTestApplication(t, config{})
+
+	var hasDeadline bool
+	handler := app.TimeoutMiddleware(time.Minute, "/v1/users/feed/stream")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, hasDeadline = r.Context().Deadline()
+	}))
+
+	tests := []struct {
+		name     string
+		url      string
+		accept   string
+		deadline bool
+	}{
+		{"should time out regular requests", "/v1/posts/1", "", true},
+		{"should not trust an event stream accept header", "/v1/posts/1", "text/event-stream", true},
+		{"should not time out the event stream", "/v1/users/feed/stream", "text/event-stream", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			executeRequest(req, handler)
+
+			if hasDeadline != tt.deadline {
+				t.Errorf("expected deadline %v. Got %v", tt.deadline, hasDeadline)
+			}
+		})
+	}
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/ekachaikeaw/social/internal/mailer"
@@ -24,11 +27,28 @@ type UserWithToken struct {
 	Token string `json:"token"`
 }
 
+type ResendActivationPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
 type CreateUserTokenPayload struct {
 	Email    string `json:"email" validate:"required,email,max=255"`
 	Password string `json:"password" validate:"required,min=3,max=72"`
 }
 
+type RefreshTokenPayload struct {
+	RefreshToken string `json:"refresh_token" validate:"required,max=255"`
+}
+
+// TokenPair is a short lived access token and the opaque refresh token that
+// gets the next one
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
 // registerUserHandler godoc
 //
 //	@Summary		Registers a user
@@ -53,8 +73,14 @@ func (a *application) registerUserHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	name, err := a.usernames.Check(payload.Username)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
 	user := &store.User{
-		Username: payload.Username,
+		Username: name,
 		Email:    payload.Email,
 		Role: store.Role{
 			Name: "user",
@@ -74,7 +100,7 @@ func (a *application) registerUserHandler(w http.ResponseWriter, r *http.Request
 	hash := sha256.Sum256([]byte(plainToken))
 	hashToken := hex.EncodeToString(hash[:])
 
-	err := a.store.Users.CreateAndInvite(c, user, hashToken, a.config.mail.exp)
+	err = a.store.Users.CreateAndInvite(c, user, hashToken, a.config.mail.exp)
 	if err != nil {
 		switch err {
 		case store.ErrDuplicateEmail:
@@ -124,15 +150,85 @@ func (a *application) registerUserHandler(w http.ResponseWriter, r *http.Request
 	}
 }
 
+// resendActivationHandler godoc
+//
+//	@Summary		Resends the activation email
+//	@Description	Issues a new invitation token to an inactive user and emails it. The response is the same whether or not the address has an account.
+//	@Tags			authentication
+//	@Accept			json
+//	@Param			payload	body		ResendActivationPayload	true	"Email"
+//	@Success		202		{string}	string					"Accepted"
+//	@Failure		400		{object}	error
+//	@Failure		429		{object}	error
+//	@Router			/authentication/resend-activation [post]
+func (a *application) resendActivationHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ResendActivationPayload
+	if err := readJson(w, r, &payload); err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	// limited per address, emails are case insensitive
+	if a.config.mail.rateLimiter.Enable {
+		if allow, retryAfter := a.mailLimiter.Allow(strings.ToLower(payload.Email)); !allow {
+			a.rateLimitExeededResponse(w, r, retryAfter.String())
+			return
+		}
+	}
+
+	// sent in the background so the response time doesn't tell whether
+	// the address has an account
+	go a.resendActivation(payload.Email)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (a *application) resendActivation(email string) {
+	c, cancel := context.WithTimeout(context.Background(), deliveryTimeout)
+	defer cancel()
+
+	// hash the token to storage but plain token for email
+	plainToken := uuid.New().String()
+	hash := sha256.Sum256([]byte(plainToken))
+	hashToken := hex.EncodeToString(hash[:])
+
+	user, err := a.store.Users.RenewInvitation(c, email, hashToken, a.config.mail.exp)
+	if err != nil {
+		if err != store.ErrNotFound {
+			a.logger.Errorw("error resending activation", "error", err)
+		}
+		return
+	}
+
+	vars := struct {
+		Username      string
+		ActivationURL string
+	}{
+		Username:      user.Username,
+		ActivationURL: fmt.Sprintf("%s/confirm/%s", a.config.frontedURL, plainToken),
+	}
+
+	isProdEnv := a.config.env == "production"
+	if _, err := a.mailer.Send(mailer.UserWelcomeTemplate, user.Username, user.Email, vars, !isProdEnv); err != nil {
+		a.logger.Errorw("error resending activation", "user_id", user.ID, "error", err)
+	}
+}
+
 // createTokenHandler godoc
 //
 //	@Summary		Creates a token
-//	@Description	Creates a token for a user
+//	@Description	Creates an access token and a refresh token for a user, logging in cancels a pending account deletion. With 2FA on it returns a challenge to complete at /authentication/token/2fa instead.
 //	@Tags			authentication
 //	@Accept			json
 //	@Produce		json
 //	@Param			payload	body		CreateUserTokenPayload	true	"User credentials"
-//	@Success		200		{string}	string					"Token"
+//	@Success		201		{object}	TokenPair				"Tokens"
+//	@Success		202		{object}	TwoFactorChallenge		"2FA required"
 //	@Failure		400		{object}	error
 //	@Failure		401		{object}	error
 //	@Failure		500		{object}	error
@@ -165,22 +261,135 @@ func (a *application) createUserTokenHandler(w http.ResponseWriter, r *http.Requ
 		a.unauthorizedErrorResponse(w, r, err)
 		return
 	}
-	// create token
-	claims := jwt.MapClaims{
-		"sub": user.ID,
-		"exp": time.Now().Add(a.config.auth.token.exp).Unix(),
-		"iat": time.Now().Unix(),
-		"nbf": time.Now().Unix(),
-		"iss": a.config.auth.token.iss,
-		"aud": a.config.auth.token.iss,
+
+	// no token before the second factor
+	if _, err := a.enabledTOTP(r.Context(), user.ID); err != store.ErrNotFound {
+		if err != nil {
+			a.internalServerError(w, r, err)
+			return
+		}
+
+		challenge, err := a.createChallenge(r.Context(), user.ID)
+		if err != nil {
+			a.internalServerError(w, r, err)
+			return
+		}
+
+		if err := a.jsonResponse(w, http.StatusAccepted, challenge); err != nil {
+			a.internalServerError(w, r, err)
+		}
+		return
 	}
-	token, err := a.authenticator.GenerateToken(claims)
+
+	// logging in during the grace period keeps the account
+	if err := a.cancelDeletion(r.Context(), user); err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+	// create tokens
+	tokens, err := a.createTokenPair(r.Context(), user)
 	if err != nil {
 		a.internalServerError(w, r, err)
 		return
 	}
 	// send to user
-	if err := a.jsonResponse(w, http.StatusCreated, token); err != nil {
+	if err := a.jsonResponse(w, http.StatusCreated, tokens); err != nil {
 		a.internalServerError(w, r, err)
 	}
 }
+
+// refreshTokenHandler godoc
+//
+//	@Summary		Refreshes a token
+//	@Description	Exchanges a refresh token for a new access token and a new refresh token. Each refresh token works once, replaying one revokes every token of its login.
+//	@Tags			authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		RefreshTokenPayload	true	"Refresh token"
+//	@Success		200		{object}	TokenPair
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/authentication/refresh [post]
+func (a *application) refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var payload RefreshTokenPayload
+	if err := readJson(w, r, &payload); err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	plainToken := uuid.New().String()
+	hash := sha256.Sum256([]byte(plainToken))
+	hashToken := hex.EncodeToString(hash[:])
+
+	userID, err := a.store.RefreshToken.Rotate(r.Context(), payload.RefreshToken, hashToken, a.config.auth.token.refreshExp)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			a.unauthorizedErrorResponse(w, r, errors.New("invalid refresh token"))
+		case store.ErrRefreshTokenReused:
+			a.logger.Warnw("refresh token reused, family revoked")
+			a.unauthorizedErrorResponse(w, r, err)
+		default:
+			a.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	token, err := a.createToken(&store.User{ID: userID})
+	if err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	if err := a.jsonResponse(w, http.StatusOK, a.tokenPair(token, plainToken)); err != nil {
+		a.internalServerError(w, r, err)
+	}
+}
+
+// createTokenPair starts a new refresh token family for user
+func (a *application) createTokenPair(c context.Context, user *store.User) (*TokenPair, error) {
+	token, err := a.createToken(user)
+	if err != nil {
+		return nil, err
+	}
+
+	// the hash is stored, the plain token only goes to the client
+	plainToken := uuid.New().String()
+	hash := sha256.Sum256([]byte(plainToken))
+	hashToken := hex.EncodeToString(hash[:])
+
+	if err := a.store.RefreshToken.Create(c, user.ID, hashToken, a.config.auth.token.refreshExp); err != nil {
+		return nil, err
+	}
+
+	return a.tokenPair(token, plainToken), nil
+}
+
+func (a *application) tokenPair(token, refreshToken string) *TokenPair {
+	return &TokenPair{
+		AccessToken:  token,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(a.config.auth.token.exp.Seconds()),
+	}
+}
+
+func (a *application) createToken(user *store.User) (string, error) {
+	claims := jwt.MapClaims{
+		"jti": uuid.New().String(),
+		"sub": user.ID,
+		"exp": time.Now().Add(a.config.auth.token.exp).Unix(),
+		"iat": time.Now().Unix(),
+		"nbf": time.Now().Unix(),
+		"iss": a.config.auth.token.iss,
+		"aud": a.config.auth.token.iss,
+	}
+
+	return a.authenticator.GenerateToken(claims)
+}
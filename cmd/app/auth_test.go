@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ekachaikeaw/social/internal/ratelimiter"
+)
+
+func TestResendActivation(t *testing.T) {
+	cfg := config{
+		mail: mailConfig{
+			rateLimiter: ratelimiter.Config{
+				RequestPerTimeFrame: 2,
+				TimeFram:            time.Minute,
+				Enable:              true,
+			},
+		},
+	}
+	app := newTestApplication(t, cfg)
+	mux := app.mount()
+
+	resend := func(email string) int {
+		body := `{"email":"` + email + `"}`
+		req, err := http.NewRequest(http.MethodPost, "/v1/authentication/resend-activation", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return executeRequest(req, mux).Code
+	}
+
+	t.Run("should require an email", func(t *testing.T) {
+		checkResponseCode(t, http.StatusBadRequest, resend("gopher"))
+	})
+
+	t.Run("should limit resends per email", func(t *testing.T) {
+		checkResponseCode(t, http.StatusAccepted, resend("gopher@example.com"))
+		checkResponseCode(t, http.StatusAccepted, resend("Gopher@example.com"))
+		checkResponseCode(t, http.StatusTooManyRequests, resend("gopher@example.com"))
+
+		checkResponseCode(t, http.StatusAccepted, resend("other@example.com"))
+	})
+}
+
+func TestRefreshToken(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{"should rotate a valid token", `{"refresh_token":"valid"}`, http.StatusOK},
+		{"should reject a reused token", `{"refresh_token":"reused"}`, http.StatusUnauthorized},
+		{"should reject an unknown token", `{"refresh_token":"unknown"}`, http.StatusUnauthorized},
+		{"should require a token", `{}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "/v1/authentication/refresh", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := executeRequest(req, mux)
+
+			checkResponseCode(t, tt.code, rr.Code)
+			if tt.code != http.StatusOK {
+				return
+			}
+
+			var body struct {
+				Data TokenPair `json:"data"`
+			}
+			if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Data.AccessToken == "" || body.Data.RefreshToken == "" || body.Data.RefreshToken == "valid" {
+				t.Errorf("expected a new token pair, got %+v", body.Data)
+			}
+		})
+	}
+}
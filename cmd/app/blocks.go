@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/ekachaikeaw/social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// GetBlockedUsers godoc
+//
+//	@Summary		Lists blocked users
+//	@Description	Lists the users blocked by the authenticated user
+//	@Tags			blocks
+//	@Produce		json
+//	@Success		200	{array}		store.BlockedUser
+//	@Failure		401	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/blocks [get]
+func (a *application) getBlockedUsersHandler(w http.ResponseWriter, r *http.Request) {
+	blocked, err := a.store.Block.GetBlockedUsers(r.Context(), getUserFromCtx(r).ID)
+	if err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	if err := a.jsonResponse(w, http.StatusOK, blocked); err != nil {
+		a.internalServerError(w, r, err)
+	}
+}
+
+// BlockUser godoc
+//
+//	@Summary		Blocks a user
+//	@Description	Removes the follows between the authenticated user and a user and keeps them from following, seeing or commenting on each other's posts
+//	@Tags			blocks
+//	@Produce		json
+//	@Param			userID	path		int	true	"User ID"
+//	@Success		200		{object}	store.BlockedUser
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		409		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/blocks/{userID} [put]
+func (a *application) blockUserHandler(w http.ResponseWriter, r *http.Request) {
+	blockedID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+	if blockedID == user.ID {
+		a.badRequestResponse(w, r, errors.New("you can't block yourself"))
+		return
+	}
+
+	blocked := &store.BlockedUser{
+		UserID:        user.ID,
+		BlockedUserID: blockedID,
+	}
+
+	c := r.Context()
+	if err := a.store.Block.Block(c, blocked); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			a.notFoundErr(w, r, err)
+		case store.ErrConflict:
+			a.conflictErr(w, r, err)
+		default:
+			a.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// neither may be suggested to the other anymore
+	a.dropSuggestions(c, user.ID)
+	a.dropSuggestions(c, blockedID)
+
+	// the follows are gone both ways
+	if a.fanoutEnabled() {
+		a.cleanupTimeline(c, user.ID, blockedID)
+		a.cleanupTimeline(c, blockedID, user.ID)
+	}
+
+	if err := a.jsonResponse(w, http.StatusOK, blocked); err != nil {
+		a.internalServerError(w, r, err)
+	}
+}
+
+// UnblockUser godoc
+//
+//	@Summary		Unblocks a user
+//	@Description	Unblocks a user, follows removed by the block are not restored
+//	@Tags			blocks
+//	@Param			userID	path	int	true	"User ID"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/blocks/{userID} [delete]
+func (a *application) unblockUserHandler(w http.ResponseWriter, r *http.Request) {
+	blockedID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := a.store.Block.Unblock(r.Context(), getUserFromCtx(r).ID, blockedID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			a.notFoundErr(w, r, err)
+		default:
+			a.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
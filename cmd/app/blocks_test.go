@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/ekachaikeaw/social/internal/store"
+)
+
+// memoryBlockStore keeps the blocks of the users 1 to 3 in a slice
+type memoryBlockStore struct {
+	blocks []store.BlockedUser
+}
+
+func (s *memoryBlockStore) Block(c context.Context, b *store.BlockedUser) error {
+	if b.BlockedUserID < 1 || b.BlockedUserID > 3 {
+		return store.ErrNotFound
+	}
+	for _, blocked := range s.blocks {
+		if blocked.UserID == b.UserID && blocked.BlockedUserID == b.BlockedUserID {
+			return store.ErrConflict
+		}
+	}
+
+	b.CreatedAt = "2024-01-01T00:00:00Z"
+	s.blocks = append(s.blocks, *b)
+	return nil
+}
+
+func (s *memoryBlockStore) Unblock(c context.Context, userID, blockedUserID int64) error {
+	for i, b := range s.blocks {
+		if b.UserID == userID && b.BlockedUserID == blockedUserID {
+			s.blocks = append(s.blocks[:i], s.blocks[i+1:]...)
+			return nil
+		}
+	}
+	return store.ErrNotFound
+}
+
+func (s *memoryBlockStore) GetBlockedUsers(c context.Context, userID int64) ([]store.BlockedUser, error) {
+	blocked := []store.BlockedUser{}
+	for _, b := range s.blocks {
+		if b.UserID == userID {
+			blocked = append(blocked, b)
+		}
+	}
+	return blocked, nil
+}
+
+func (s *memoryBlockStore) NotBlocked(c context.Context, userID, otherID int64) (bool, error) {
+	for _, b := range s.blocks {
+		if (b.UserID == userID && b.BlockedUserID == otherID) || (b.UserID == otherID && b.BlockedUserID == userID) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func TestBlocks(t *testing.T) {
+	app := newTestApplication(t, config{})
+	blocks := &memoryBlockStore{}
+	app.store.Block = blocks
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(method, url string) *http.Response {
+		req, err := http.NewRequest(method, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		return executeRequest(req, mux).Result()
+	}
+
+	blocked := func(t *testing.T) []int64 {
+		t.Helper()
+
+		res := request(http.MethodGet, "/v1/blocks")
+		checkResponseCode(t, http.StatusOK, res.StatusCode)
+
+		var body struct {
+			Data []store.BlockedUser `json:"data"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+
+		ids := []int64{}
+		for _, b := range body.Data {
+			ids = append(ids, b.BlockedUserID)
+		}
+		return ids
+	}
+
+	t.Run("should block a user", func(t *testing.T) {
+		res := request(http.MethodPut, "/v1/blocks/2")
+		checkResponseCode(t, http.StatusOK, res.StatusCode)
+
+		var body struct {
+			Data store.BlockedUser `json:"data"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Data.BlockedUserID != 2 || body.Data.CreatedAt == "" {
+			t.Errorf("unexpected block %+v", body.Data)
+		}
+
+		if ids := blocked(t); len(ids) != 1 || ids[0] != 2 {
+			t.Errorf("expected user 2 blocked, got %v", ids)
+		}
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		code   int
+	}{
+		{"should not block twice", http.MethodPut, "/v1/blocks/2", http.StatusConflict},
+		{"should not block yourself", http.MethodPut, "/v1/blocks/1", http.StatusBadRequest},
+		{"should not block an unknown user", http.MethodPut, "/v1/blocks/42", http.StatusNotFound},
+		{"should reject an invalid user id", http.MethodPut, "/v1/blocks/gopher", http.StatusBadRequest},
+		{"should not unblock a user that isn't blocked", http.MethodDelete, "/v1/blocks/3", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkResponseCode(t, tt.code, request(tt.method, tt.url).StatusCode)
+		})
+	}
+
+	t.Run("should unblock a user", func(t *testing.T) {
+		checkResponseCode(t, http.StatusNoContent, request(http.MethodDelete, "/v1/blocks/2").StatusCode)
+		if ids := blocked(t); len(ids) != 0 {
+			t.Errorf("expected no blocks, got %v", ids)
+		}
+	})
+}
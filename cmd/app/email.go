@@ -0,0 +1,190 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ekachaikeaw/social/internal/mailer"
+	"github.com/ekachaikeaw/social/internal/store"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type ChangeEmailPayload struct {
+	Email    string `json:"email" validate:"required,email,max=255"`
+	Password string `json:"password" validate:"required,max=72"`
+}
+
+// changeEmailHandler godoc
+//
+//	@Summary		Changes the email
+//	@Description	Sends a confirmation link to the new address. The current address stays in use until the link is opened.
+//	@Tags			users
+//	@Accept			json
+//	@Param			payload	body		ChangeEmailPayload	true	"New email and current password"
+//	@Success		202		{string}	string				"Confirmation sent"
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/email [put]
+func (a *application) changeEmailHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ChangeEmailPayload
+	if err := readJson(w, r, &payload); err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	c := r.Context()
+
+	// the cached user has no password hash
+	user, err := a.store.Users.GetByID(c, getUserFromCtx(r).ID)
+	if err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	if err := user.Password.Compare(payload.Password); err != nil {
+		a.badRequestResponse(w, r, errors.New("password is incorrect"))
+		return
+	}
+
+	if strings.EqualFold(user.Email, payload.Email) {
+		a.badRequestResponse(w, r, errors.New("email is already in use by this account"))
+		return
+	}
+
+	// hash the token to storage but plain token for email
+	plainToken := uuid.New().String()
+	hash := sha256.Sum256([]byte(plainToken))
+	hashToken := hex.EncodeToString(hash[:])
+
+	if err := a.store.Users.RequestEmailChange(c, user.ID, payload.Email, hashToken, a.config.mail.exp); err != nil {
+		switch err {
+		case store.ErrDuplicateEmail:
+			a.badRequestResponse(w, r, err)
+		default:
+			a.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	vars := struct {
+		Username   string
+		ConfirmURL string
+		Expiry     string
+	}{
+		Username:   user.Username,
+		ConfirmURL: fmt.Sprintf("%s/confirm-email/%s", a.config.frontedURL, plainToken),
+		Expiry:     a.config.mail.exp.String(),
+	}
+
+	isProdEnv := a.config.env == "production"
+	if _, err := a.mailer.Send(mailer.EmailChangeTemplate, user.Username, payload.Email, vars, !isProdEnv); err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// confirmEmailHandler godoc
+//
+//	@Summary		Confirms an email change
+//	@Description	Switches the account to the new address and emails the previous one a link to undo the change
+//	@Tags			users
+//	@Param			token	path	string	true	"Confirmation token"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Router			/users/email/confirm/{token} [put]
+func (a *application) confirmEmailHandler(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+
+	plainToken := uuid.New().String()
+	hash := sha256.Sum256([]byte(plainToken))
+	hashToken := hex.EncodeToString(hash[:])
+
+	c := r.Context()
+	change, err := a.store.Users.ConfirmEmailChange(c, token, hashToken, a.config.mail.revertExp)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			a.notFoundErr(w, r, err)
+		case store.ErrDuplicateEmail:
+			a.badRequestResponse(w, r, err)
+		default:
+			a.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if a.config.redis.enable {
+		a.cacheStore.Users.Delete(c, change.UserID)
+	}
+
+	vars := struct {
+		Username  string
+		NewEmail  string
+		RevertURL string
+		Expiry    string
+	}{
+		Username:  change.Username,
+		NewEmail:  change.NewEmail,
+		RevertURL: fmt.Sprintf("%s/revert-email/%s", a.config.frontedURL, plainToken),
+		Expiry:    a.config.mail.revertExp.String(),
+	}
+
+	// the change is already applied, a failed notice is only logged
+	isProdEnv := a.config.env == "production"
+	if _, err := a.mailer.Send(mailer.EmailChangedTemplate, change.Username, change.OldEmail, vars, !isProdEnv); err != nil {
+		a.logger.Errorw("error sending email change notice", "user_id", change.UserID, "error", err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// revertEmailHandler godoc
+//
+//	@Summary		Reverts an email change
+//	@Description	Restores the previous address with the link sent to it when the email was changed and signs the user out everywhere
+//	@Tags			users
+//	@Param			token	path	string	true	"Revert token"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Router			/users/email/revert/{token} [put]
+func (a *application) revertEmailHandler(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+
+	c := r.Context()
+	change, err := a.store.Users.RevertEmailChange(c, token)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			a.notFoundErr(w, r, err)
+		case store.ErrDuplicateEmail:
+			a.badRequestResponse(w, r, err)
+		default:
+			a.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if a.config.redis.enable {
+		a.cacheStore.Users.Delete(c, change.UserID)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ekachaikeaw/social/internal/mailer"
+	"github.com/ekachaikeaw/social/internal/store"
+	"github.com/ekachaikeaw/social/internal/store/cache"
+)
+
+// recordingUserCache never hits and remembers which users were dropped from
+// the cache
+type recordingUserCache struct {
+	cache.MockUserStore
+	deleted []int64
+}
+
+func (s *recordingUserCache) Get(context.Context, int64) (*store.User, error) {
+	return nil, nil
+}
+
+func (s *recordingUserCache) Delete(c context.Context, userID int64) {
+	s.deleted = append(s.deleted, userID)
+}
+
+// emailUserStore keeps the pending and the reverted email change of the user
+// of a memoryUserStore
+type emailUserStore struct {
+	*memoryUserStore
+
+	confirmToken string
+	newEmail     string
+	oldEmail     string
+	revertToken  string
+}
+
+func (s *emailUserStore) RequestEmailChange(c context.Context, userID int64, email, token string, exp time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.newEmail, s.confirmToken = email, token
+	return nil
+}
+
+func (s *emailUserStore) ConfirmEmailChange(c context.Context, token, revertToken string, revertExp time.Duration) (*store.EmailChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.confirmToken == "" || hashToken(token) != s.confirmToken {
+		return nil, store.ErrNotFound
+	}
+
+	change := &store.EmailChange{UserID: s.user.ID, Username: s.user.Username, OldEmail: s.user.Email, NewEmail: s.newEmail}
+	s.oldEmail = s.user.Email
+	s.user.Email, s.confirmToken, s.revertToken = s.newEmail, "", revertToken
+	return change, nil
+}
+
+func (s *emailUserStore) RevertEmailChange(c context.Context, token string) (*store.EmailChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.revertToken == "" || hashToken(token) != s.revertToken {
+		return nil, store.ErrNotFound
+	}
+
+	change := &store.EmailChange{UserID: s.user.ID, Username: s.user.Username, OldEmail: s.user.Email, NewEmail: s.oldEmail}
+	s.user.Email, s.revertToken = s.oldEmail, ""
+	return change, nil
+}
+
+func TestEmailChange(t *testing.T) {
+	app := newTestApplication(t, config{
+		frontedURL: "http://localhost:5173",
+		redis:      redisConfig{enable: true},
+	})
+	users := &emailUserStore{memoryUserStore: newMemoryUserStore(t, "old@example.com", "password")}
+	app.store.Users = users
+	userCache := &recordingUserCache{}
+	app.cacheStore.Users = userCache
+	mail := newRecordingMailer()
+	app.mailer = mail
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(method, url, body string, auth bool) int {
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if auth {
+			req.Header.Set("Authorization", "Bearer "+testToken)
+		}
+		return executeRequest(req, mux).Code
+	}
+
+	tests := []struct {
+		name string
+		body string
+		auth bool
+		code int
+	}{
+		{"should require the current password", `{"email":"new@example.com","password":"wrong"}`, true, http.StatusBadRequest},
+		{"should require a valid email", `{"email":"new","password":"password"}`, true, http.StatusBadRequest},
+		{"should refuse the current email", `{"email":"OLD@example.com","password":"password"}`, true, http.StatusBadRequest},
+		{"should not change the email unauthenticated", `{"email":"new@example.com","password":"password"}`, false, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkResponseCode(t, tt.code, request(http.MethodPut, "/v1/users/me/email", tt.body, tt.auth))
+			if users.confirmToken != "" {
+				t.Error("expected no change requested")
+			}
+		})
+	}
+
+	var confirmToken, revertToken string
+
+	t.Run("should send the confirmation to the new address", func(t *testing.T) {
+		code := request(http.MethodPut, "/v1/users/me/email", `{"email":"new@example.com","password":"password"}`, true)
+		checkResponseCode(t, http.StatusAccepted, code)
+
+		sent := mail.next(t)
+		if sent.template != mailer.EmailChangeTemplate || sent.email != "new@example.com" {
+			t.Fatalf("unexpected email %+v", sent)
+		}
+
+		url := sent.data.(struct {
+			Username   string
+			ConfirmURL string
+			Expiry     string
+		}).ConfirmURL
+		confirmToken = strings.TrimPrefix(url, "http://localhost:5173/confirm-email/")
+		if hashToken(confirmToken) != users.confirmToken {
+			t.Errorf("the link %s doesn't match the stored token", url)
+		}
+		if users.user.Email != "old@example.com" {
+			t.Error("expected the old address in use until confirmed")
+		}
+	})
+
+	t.Run("should send the revert link to the old address", func(t *testing.T) {
+		checkResponseCode(t, http.StatusNotFound, request(http.MethodPut, "/v1/users/email/confirm/unknown", "", false))
+		checkResponseCode(t, http.StatusNoContent, request(http.MethodPut, "/v1/users/email/confirm/"+confirmToken, "", false))
+
+		sent := mail.next(t)
+		if sent.template != mailer.EmailChangedTemplate || sent.email != "old@example.com" {
+			t.Fatalf("unexpected email %+v", sent)
+		}
+
+		url := sent.data.(struct {
+			Username  string
+			NewEmail  string
+			RevertURL string
+			Expiry    string
+		}).RevertURL
+		revertToken = strings.TrimPrefix(url, "http://localhost:5173/revert-email/")
+		if hashToken(revertToken) != users.revertToken {
+			t.Errorf("the link %s doesn't match the stored token", url)
+		}
+	})
+
+	t.Run("should restore the old address and drop the cached user", func(t *testing.T) {
+		userCache.deleted = nil
+
+		checkResponseCode(t, http.StatusNotFound, request(http.MethodPut, "/v1/users/email/revert/unknown", "", false))
+		checkResponseCode(t, http.StatusNoContent, request(http.MethodPut, "/v1/users/email/revert/"+revertToken, "", false))
+
+		if users.user.Email != "old@example.com" {
+			t.Errorf("expected the old address back, got %q", users.user.Email)
+		}
+		if len(userCache.deleted) != 1 || userCache.deleted[0] != 1 {
+			t.Errorf("expected user 1 dropped from the cache, got %v", userCache.deleted)
+		}
+
+		checkResponseCode(t, http.StatusNotFound, request(http.MethodPut, "/v1/users/email/revert/"+revertToken, "", false))
+	})
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+
+	"github.com/ekachaikeaw/social/internal/store"
+	"github.com/ekachaikeaw/social/internal/store/cache"
+)
+
+// getExploreHandler godoc
+//
+//	@Summary		Fetches the explore feed
+//	@Description	Fetches recent or popular posts from users the caller doesn't follow
+//	@Tags			feed
+//	@Accept			json
+//	@Produce		json
+//	@Param			since	query		string	false	"Since, RFC3339 or YYYY-MM-DD HH:MM:SS"
+//	@Param			until	query		string	false	"Until, RFC3339 or YYYY-MM-DD HH:MM:SS"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Param			cursor	query		string	false	"Cursor returned as next_cursor by the previous page"
+//	@Param			sort	query		string	false	"Sort, desc for recent or top for popular"
+//	@Param			tags	query		string	false	"Tags"
+//	@Param			search	query		string	false	"Search"
+//	@Success		200		{object}	[]store.PostWithMetadata
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/explore [get]
+func (a *application) getExploreHandler(w http.ResponseWriter, r *http.Request) {
+	fq, err := a.parseFeedQuery(r)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	c := r.Context()
+	user := getUserFromCtx(r)
+
+	page, err := a.getExplore(c, user.ID, fq)
+	if err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	if err := a.feedResponse(w, r, page.Posts, page.Next); err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (a *application) getExplore(c context.Context, userID int64, fq store.PaginatedQuery) (*cache.ExplorePage, error) {
+	if !a.config.redis.enable {
+		return a.queryExplore(c, userID, fq)
+	}
+
+	// ranking inputs are left out of the key, a cached page keeps the
+	// cursor it was ranked with
+	key, err := json.Marshal(fq)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(key)
+	query := hex.EncodeToString(hash[:])
+
+	page, err := a.cacheStore.Explore.Get(c, userID, query)
+	if err != nil {
+		a.logger.Errorw("error reading explore cache, falling back to database", "user_id", userID, "error", err)
+		return a.queryExplore(c, userID, fq)
+	}
+
+	if page == nil {
+		page, err = a.queryExplore(c, userID, fq)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := a.cacheStore.Explore.Set(c, userID, query, page); err != nil {
+			a.logger.Errorw("error caching explore page", "user_id", userID, "error", err)
+		}
+	}
+
+	return page, nil
+}
+
+func (a *application) queryExplore(c context.Context, userID int64, fq store.PaginatedQuery) (*cache.ExplorePage, error) {
+	posts, err := a.store.Posts.GetExplore(c, userID, fq)
+	if err != nil {
+		return nil, err
+	}
+
+	next, err := nextFeedCursor(posts, fq)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cache.ExplorePage{Posts: posts, Next: next}, nil
+}
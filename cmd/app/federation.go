@@ -0,0 +1,475 @@
+package main
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ekachaikeaw/social/internal/activitypub"
+	"github.com/ekachaikeaw/social/internal/store"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// outboxLimit is the number of recent posts listed in an outbox
+const outboxLimit = 20
+
+// deliveryTimeout bounds the background delivery of one activity
+const deliveryTimeout = time.Second * 30
+
+// webfingerHandler godoc
+//
+//	@Summary		WebFinger discovery
+//	@Description	Resolves acct:username@domain to the ActivityPub actor of a user
+//	@Tags			federation
+//	@Produce		json
+//	@Param			resource	query		string	true	"acct:username@domain"
+//	@Success		200			{object}	activitypub.WebFinger
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error
+//	@Router			/.well-known/webfinger [get]
+func (app *application) webfingerHandler(w http.ResponseWriter, r *http.Request) {
+	resource := r.URL.Query().Get("resource")
+
+	account, ok := strings.CutPrefix(resource, "acct:")
+	if !ok {
+		app.badRequestResponse(w, r, errors.New("resource must be an acct: uri"))
+		return
+	}
+
+	username, domain, ok := strings.Cut(account, "@")
+	if !ok || !strings.EqualFold(domain, app.federationDomain()) {
+		app.notFoundErr(w, r, fmt.Errorf("unknown resource %s", resource))
+		return
+	}
+
+	// old handles resolve too, the subject names the current one
+	user, err := app.store.Users.ResolveUsername(r.Context(), username)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundErr(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	actorID := app.actorURL(user.ID)
+	jrd := activitypub.WebFinger{
+		Subject: "acct:" + user.Username + "@" + app.federationDomain(),
+		Aliases: []string{actorID},
+		Links: []activitypub.WebFingerLink{
+			{Rel: "self", Type: activitypub.ContentType, Href: actorID},
+			{Rel: "http://webfinger.net/rel/profile-page", Type: "text/html", Href: app.profileURL(user.ID)},
+		},
+	}
+
+	if err := writeContentJson(w, http.StatusOK, "application/jrd+json", jrd); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getActorHandler godoc
+//
+//	@Summary		ActivityPub actor
+//	@Description	Actor document of a user
+//	@Tags			federation
+//	@Produce		json
+//	@Param			userID	path		int	true	"User ID"
+//	@Success		200		{object}	activitypub.Actor
+//	@Failure		404		{object}	error
+//	@Router			/ap/users/{userID} [get]
+func (app *application) getActorHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := app.federatedUser(r)
+	if err != nil {
+		app.syndicationError(w, r, err)
+		return
+	}
+
+	key, err := app.actorKey(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	actor := activitypub.NewActor(app.actorURL(user.ID), user.Username, app.profileURL(user.ID), key.PublicKey)
+	if err := writeContentJson(w, http.StatusOK, activitypub.ContentType, actor); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getOutboxHandler godoc
+//
+//	@Summary		ActivityPub outbox
+//	@Description	Create activities for the latest posts of a user
+//	@Tags			federation
+//	@Produce		json
+//	@Param			userID	path		int	true	"User ID"
+//	@Success		200		{object}	activitypub.OrderedCollection
+//	@Failure		404		{object}	error
+//	@Router			/ap/users/{userID}/outbox [get]
+func (app *application) getOutboxHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := app.federatedUser(r)
+	if err != nil {
+		app.syndicationError(w, r, err)
+		return
+	}
+
+	posts, err := app.store.Posts.GetByUserID(r.Context(), user.ID, outboxLimit)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	items := make([]any, 0, len(posts))
+	for _, p := range posts {
+		create, err := app.createActivity(p)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		items = append(items, create)
+	}
+
+	outbox := activitypub.NewOrderedCollection(app.actorURL(user.ID)+"/outbox", items)
+	if err := writeContentJson(w, http.StatusOK, activitypub.ContentType, outbox); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getNoteHandler godoc
+//
+//	@Summary		ActivityPub note
+//	@Description	Note object of a post
+//	@Tags			federation
+//	@Produce		json
+//	@Param			postID	path		int	true	"Post ID"
+//	@Success		200		{object}	activitypub.Note
+//	@Failure		404		{object}	error
+//	@Router			/ap/posts/{postID} [get]
+func (app *application) getNoteHandler(w http.ResponseWriter, r *http.Request) {
+	postID, err := strconv.ParseInt(chi.URLParam(r, "postID"), 10, 64)
+	if err != nil {
+		app.notFoundErr(w, r, err)
+		return
+	}
+
+	post, err := app.store.Posts.GetByID(r.Context(), postID)
+	if err != nil {
+		app.syndicationError(w, r, err)
+		return
+	}
+
+	author, err := app.store.Users.GetByID(r.Context(), post.UserID)
+	if err != nil {
+		app.syndicationError(w, r, err)
+		return
+	}
+
+	if author.IsPrivate {
+		app.notFoundErr(w, r, store.ErrNotFound)
+		return
+	}
+
+	if err := writeContentJson(w, http.StatusOK, activitypub.ContentType, app.note(*post)); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// postInboxHandler godoc
+//
+//	@Summary		ActivityPub inbox
+//	@Description	Accepts signed Follow, Undo and Create activities from remote servers
+//	@Tags			federation
+//	@Accept			json
+//	@Param			userID	path		int		true	"User ID"
+//	@Success		202		{string}	string	"Accepted"
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		404		{object}	error
+//	@Router			/ap/users/{userID}/inbox [post]
+func (app *application) postInboxHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1_048_578))
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	c := r.Context()
+
+	signer, err := app.verifySignature(r, body)
+	if err != nil {
+		app.unauthorizedErrorResponse(w, r, err)
+		return
+	}
+
+	var activity activitypub.Activity
+	if err := json.Unmarshal(body, &activity); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if activity.Actor != signer.ID {
+		app.unauthorizedErrorResponse(w, r, fmt.Errorf("activity actor %s is not the signer %s", activity.Actor, signer.ID))
+		return
+	}
+
+	user, err := app.federatedUser(r)
+	if err != nil {
+		app.syndicationError(w, r, err)
+		return
+	}
+
+	switch activity.Type {
+	case "Follow":
+		if activity.ObjectID() != app.actorURL(user.ID) {
+			app.badRequestResponse(w, r, errors.New("follow object is not this actor"))
+			return
+		}
+
+		follower := &store.RemoteFollower{UserID: user.ID, ActorID: signer.ID, Inbox: signer.Inbox}
+		if err := app.store.Federation.AddRemoteFollower(c, follower); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		accept, err := activitypub.NewActivity(
+			app.actorURL(user.ID)+"#accepts/"+uuid.New().String(),
+			"Accept",
+			app.actorURL(user.ID),
+			activity,
+			signer.ID,
+		)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		go app.deliver(user.ID, []string{signer.Inbox}, accept)
+	case "Undo":
+		inner, err := activity.EmbeddedActivity()
+		if err != nil || inner.Type != "Follow" || inner.Actor != signer.ID {
+			break
+		}
+
+		if err := app.store.Federation.RemoveRemoteFollower(c, user.ID, signer.ID); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	case "Create":
+		app.logger.Infow("received remote object", "actor", signer.ID, "object", activity.ObjectID())
+	default:
+		app.logger.Infow("ignored activity", "type", activity.Type, "actor", signer.ID)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// verifySignature checks the signature of an inbox request and returns the
+// actor who signed it. Keys are cached by key id and fetched again when they
+// don't verify, in case the actor rotated theirs.
+func (app *application) verifySignature(r *http.Request, body []byte) (*activitypub.Actor, error) {
+	var signer *activitypub.Actor
+	var signerKeyID string
+	var cached bool
+
+	fetch := func(keyID string) (*rsa.PublicKey, error) {
+		signerKeyID = keyID
+
+		actor, key, ok := app.actorKeys.Get(keyID)
+		if !ok {
+			var err error
+			if actor, key, err = app.federation.FetchKey(r.Context(), keyID); err != nil {
+				return nil, err
+			}
+			app.actorKeys.Set(keyID, actor, key)
+		}
+
+		signer, cached = actor, ok
+		return key, nil
+	}
+
+	_, err := activitypub.Verify(r, body, fetch)
+	if err != nil && cached {
+		app.actorKeys.Delete(signerKeyID)
+		_, err = activitypub.Verify(r, body, fetch)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return signer, nil
+}
+
+// federatePost sends a new post to the remote followers of its author
+func (app *application) federatePost(post store.Post) {
+	c, cancel := context.WithTimeout(context.Background(), deliveryTimeout)
+	defer cancel()
+
+	author, err := app.store.Users.GetByID(c, post.UserID)
+	if err != nil {
+		app.logger.Errorw("error federating post", "post_id", post.ID, "error", err)
+		return
+	}
+
+	if author.IsPrivate {
+		return
+	}
+
+	followers, err := app.store.Federation.GetRemoteFollowers(c, post.UserID)
+	if err != nil {
+		app.logger.Errorw("error federating post", "post_id", post.ID, "error", err)
+		return
+	}
+
+	if len(followers) == 0 {
+		return
+	}
+
+	create, err := app.createActivity(post)
+	if err != nil {
+		app.logger.Errorw("error federating post", "post_id", post.ID, "error", err)
+		return
+	}
+
+	inboxes := make([]string, 0, len(followers))
+	for _, f := range followers {
+		inboxes = append(inboxes, f.Inbox)
+	}
+
+	app.deliver(post.UserID, inboxes, create)
+}
+
+// deliver signs activity with the key of userID and posts it to each inbox
+func (app *application) deliver(userID int64, inboxes []string, activity any) {
+	c, cancel := context.WithTimeout(context.Background(), deliveryTimeout)
+	defer cancel()
+
+	key, err := app.actorKey(c, userID)
+	if err != nil {
+		app.logger.Errorw("error delivering activity", "user_id", userID, "error", err)
+		return
+	}
+
+	privateKey, err := activitypub.ParsePrivateKey(key.PrivateKey)
+	if err != nil {
+		app.logger.Errorw("error delivering activity", "user_id", userID, "error", err)
+		return
+	}
+
+	keyID := app.actorURL(userID) + "#main-key"
+	for _, inbox := range inboxes {
+		if err := app.federation.Deliver(c, inbox, activity, keyID, privateKey); err != nil {
+			app.logger.Errorw("error delivering activity", "user_id", userID, "inbox", inbox, "error", err)
+		}
+	}
+}
+
+// actorKey returns the signing key of a user, creating it on first use
+func (app *application) actorKey(c context.Context, userID int64) (*store.ActorKey, error) {
+	key, err := app.store.Federation.GetActorKey(c, userID)
+	if err == nil {
+		return key, nil
+	}
+
+	if err != store.ErrNotFound {
+		return nil, err
+	}
+
+	privatePem, publicPem, err := activitypub.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	key = &store.ActorKey{UserID: userID, PublicKey: publicPem, PrivateKey: privatePem}
+	if err := app.store.Federation.CreateActorKey(c, key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func (app *application) federatedUser(r *http.Request) (*store.User, error) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		return nil, store.ErrNotFound
+	}
+
+	user, err := app.store.Users.GetByID(r.Context(), userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// private accounts approve each follower, which remote servers can't
+	// ask for, so they aren't federated at all
+	if user.IsPrivate {
+		return nil, store.ErrNotFound
+	}
+
+	return user, nil
+}
+
+func (app *application) createActivity(p store.Post) (*activitypub.Activity, error) {
+	note := app.note(p)
+
+	create, err := activitypub.NewActivity(note.ID+"/activity", "Create", note.AttributedTo, note, note.To...)
+	if err != nil {
+		return nil, err
+	}
+	create.Cc = note.Cc
+
+	return create, nil
+}
+
+func (app *application) note(p store.Post) *activitypub.Note {
+	actorID := app.actorURL(p.UserID)
+
+	note := &activitypub.Note{
+		ID:           fmt.Sprintf("%s/ap/posts/%d", app.config.federation.baseURL, p.ID),
+		Type:         "Note",
+		AttributedTo: actorID,
+		Content: fmt.Sprintf(
+			"<p><strong>%s</strong></p><p>%s</p>",
+			html.EscapeString(p.Title),
+			html.EscapeString(p.Content),
+		),
+		Published: formatPostTime(p.CreatedAt, time.RFC3339),
+		URL:       app.postURL(p),
+		To:        []string{activitypub.PublicAudience},
+		Cc:        []string{actorID + "/followers"},
+	}
+
+	for _, tag := range p.Tags {
+		note.Tag = append(note.Tag, activitypub.Tag{Type: "Hashtag", Name: "#" + tag})
+	}
+
+	return note
+}
+
+func (app *application) actorURL(userID int64) string {
+	return fmt.Sprintf("%s/ap/users/%d", app.config.federation.baseURL, userID)
+}
+
+func (app *application) profileURL(userID int64) string {
+	return fmt.Sprintf("%s/users/%d", app.config.frontedURL, userID)
+}
+
+func (app *application) federationDomain() string {
+	u, err := url.Parse(app.config.federation.baseURL)
+	if err != nil {
+		return ""
+	}
+
+	return u.Host
+}
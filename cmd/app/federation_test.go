@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ekachaikeaw/social/internal/activitypub"
+)
+
+func TestFederation(t *testing.T) {
+	cfg := config{
+		federation: federationConfig{
+			enable:  true,
+			baseURL: "https://social.test",
+			keyTTL:  time.Hour,
+		},
+	}
+	app := newTestApplication(t, cfg)
+	mux := app.mount()
+
+	// a remote server with one actor whose inbox records deliveries
+	privatePem, publicPem, err := activitypub.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := activitypub.ParsePrivateKey(privatePem)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var remoteActor *activitypub.Actor
+	var fetches atomic.Int32
+	received := make(chan *activitypub.Activity, 1)
+
+	remote := http.NewServeMux()
+	remote.HandleFunc("/users/bob", func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Header().Set("Content-Type", activitypub.ContentType)
+		json.NewEncoder(w).Encode(remoteActor)
+	})
+	remote.HandleFunc("/users/bob/inbox", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		var activity activitypub.Activity
+		json.Unmarshal(body, &activity)
+		received <- &activity
+		w.WriteHeader(http.StatusAccepted)
+	})
+	ts := httptest.NewServer(remote)
+	defer ts.Close()
+
+	remoteActor = activitypub.NewActor(ts.URL+"/users/bob", "bob", "", publicPem)
+
+	inbox := func(t *testing.T, activity *activitypub.Activity, signer string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		body, err := json.Marshal(activity)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest(http.MethodPost, "https://social.test/ap/users/1/inbox", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", activitypub.ContentType)
+
+		if signer != "" {
+			if err := activitypub.Sign(req, body, signer, key); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		return executeRequest(req, mux)
+	}
+
+	t.Run("should resolve webfinger", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/.well-known/webfinger?resource=acct:alice@social.test", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("should not resolve other domains", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/.well-known/webfinger?resource=acct:alice@other.test", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("should serve the actor", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/ap/users/1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		var actor activitypub.Actor
+		if err := json.NewDecoder(rr.Body).Decode(&actor); err != nil {
+			t.Fatal(err)
+		}
+		if actor.ID != "https://social.test/ap/users/1" || actor.PublicKey.PublicKeyPem == "" {
+			t.Errorf("unexpected actor %+v", actor)
+		}
+	})
+
+	t.Run("should reject unsigned activities", func(t *testing.T) {
+		follow, err := activitypub.NewActivity(ts.URL+"/follows/1", "Follow", remoteActor.ID, "https://social.test/ap/users/1")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := inbox(t, follow, "")
+		checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("should reject activities from another actor than the signer", func(t *testing.T) {
+		follow, err := activitypub.NewActivity(ts.URL+"/follows/1", "Follow", ts.URL+"/users/eve", "https://social.test/ap/users/1")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := inbox(t, follow, remoteActor.ID+"#main-key")
+		checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("should accept a signed follow", func(t *testing.T) {
+		follow, err := activitypub.NewActivity(ts.URL+"/follows/1", "Follow", remoteActor.ID, "https://social.test/ap/users/1")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := inbox(t, follow, remoteActor.ID+"#main-key")
+		checkResponseCode(t, http.StatusAccepted, rr.Code)
+
+		select {
+		case accept := <-received:
+			if accept.Type != "Accept" || accept.Actor != "https://social.test/ap/users/1" {
+				t.Errorf("unexpected activity %+v", accept)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no accept delivered")
+		}
+	})
+
+	t.Run("should cache the key of the signer until it changes", func(t *testing.T) {
+		follow := func(t *testing.T) {
+			t.Helper()
+
+			activity, err := activitypub.NewActivity(ts.URL+"/follows/1", "Follow", remoteActor.ID, "https://social.test/ap/users/1")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := inbox(t, activity, remoteActor.ID+"#main-key")
+			checkResponseCode(t, http.StatusAccepted, rr.Code)
+
+			select {
+			case <-received:
+			case <-time.After(5 * time.Second):
+				t.Fatal("no accept delivered")
+			}
+		}
+
+		before := fetches.Load()
+		follow(t)
+		if n := fetches.Load() - before; n != 0 {
+			t.Errorf("expected the cached key, fetched the actor %d times", n)
+		}
+
+		// the actor rotates its key, the cached one no longer verifies
+		privatePem, publicPem, err := activitypub.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key, err = activitypub.ParsePrivateKey(privatePem); err != nil {
+			t.Fatal(err)
+		}
+		remoteActor = activitypub.NewActor(ts.URL+"/users/bob", "bob", "", publicPem)
+
+		follow(t)
+		if n := fetches.Load() - before; n != 1 {
+			t.Errorf("expected the actor fetched once after the rotation, got %d", n)
+		}
+	})
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/ekachaikeaw/social/internal/store"
 )
@@ -13,11 +16,12 @@ import (
 //	@Tags			feed
 //	@Accept			json
 //	@Produce		json
-//	@Param			since	query		string	false	"Since"
-//	@Param			until	query		string	false	"Until"
+//	@Param			since	query		string	false	"Since, RFC3339 or YYYY-MM-DD HH:MM:SS"
+//	@Param			until	query		string	false	"Until, RFC3339 or YYYY-MM-DD HH:MM:SS"
 //	@Param			limit	query		int		false	"Limit"
 //	@Param			offset	query		int		false	"Offset"
-//	@Param			sort	query		string	false	"Sort"
+//	@Param			cursor	query		string	false	"Cursor returned as next_cursor by the previous page"
+//	@Param			sort	query		string	false	"Sort, asc, desc or top"
 //	@Param			tags	query		string	false	"Tags"
 //	@Param			search	query		string	false	"Search"
 //	@Success		200		{object}	[]store.PostWithMetadata
@@ -26,6 +30,29 @@ import (
 //	@Security		ApiKeyAuth
 //	@Router			/users/feed [get]
 func (a *application) getUserFeedHandler(w http.ResponseWriter, r *http.Request) {
+	fq, err := a.parseFeedQuery(r)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	c := r.Context()
+	user := getUserFromCtx(r)
+
+	feed, next, err := a.getUserFeed(c, user.ID, fq)
+	if err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	if err = a.feedResponse(w, r, feed, next); err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+}
+
+// parseFeedQuery reads the pagination and filters shared by the feeds
+func (a *application) parseFeedQuery(r *http.Request) (store.PaginatedQuery, error) {
 	// pagination, filter
 	// create default paginatedQuery 
 	fq := store.PaginatedQuery{
@@ -36,26 +63,72 @@ func (a *application) getUserFeedHandler(w http.ResponseWriter, r *http.Request)
 
 	fq, err := fq.Parse(r)
 	if err != nil {
-		a.badRequestResponse(w, r, err)
-		return 
+		return fq, err
 	}
 
 	if err := Validate.Struct(fq); err != nil {
-		a.badRequestResponse(w, r, err)
-		return
+		return fq, err
 	}
 
-	c := r.Context()
-	user := getUserFromCtx(r)
+	if fq.Cursor != "" {
+		if fq.Offset != 0 {
+			return fq, errors.New("cursor and offset can't be used together")
+		}
+
+		cursor, err := store.DecodeCursor(fq.Cursor, a.config.feed.cursorSecret)
+		if err != nil {
+			return fq, err
+		}
+
+		if cursor.IsRanked() != (fq.Sort == "top") {
+			return fq, errors.New("cursor doesn't match the sort order")
+		}
+		fq.After = &cursor
+	}
 
-	feed, err := a.store.Posts.GetUserFeed(c, user.ID, fq)
+	if fq.Sort == "top" {
+		fq.Ranking = a.config.feed.ranking
+		fq.RankedAt = time.Now()
+		if fq.After != nil {
+			fq.RankedAt = fq.After.RankedAt
+		}
+	}
+
+	return fq, nil
+}
+
+// feedResponse writes a page of posts with the cursor of the next page in
+// the envelope and the Link header
+func (a *application) feedResponse(w http.ResponseWriter, r *http.Request, feed []store.PostWithMetadata, next *store.Cursor) error {
+	nextCursor := ""
+	if next != nil {
+		nextCursor = next.Encode(a.config.feed.cursorSecret)
+
+		q := r.URL.Query()
+		q.Del("offset")
+		q.Set("cursor", nextCursor)
+		w.Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, r.URL.Path, q.Encode()))
+	}
+
+	return a.paginatedResponse(w, http.StatusOK, feed, nextCursor)
+}
+
+// nextFeedCursor returns the position after a full page, nil otherwise
+func nextFeedCursor(feed []store.PostWithMetadata, fq store.PaginatedQuery) (*store.Cursor, error) {
+	if len(feed) == 0 || len(feed) < fq.Limit {
+		return nil, nil
+	}
+
+	last := feed[len(feed)-1]
+	next, err := store.CursorFromPost(last.Post)
 	if err != nil {
-		a.internalServerError(w, r, err)
-		return
+		return nil, err
 	}
 
-	if err = a.jsonResponse(w, http.StatusOK, feed); err != nil {
-		a.internalServerError(w, r, err)
-		return
+	if fq.Sort == "top" {
+		next.Score = last.Score
+		next.RankedAt = fq.RankedAt
 	}
-}
\ No newline at end of file
+
+	return &next, nil
+}
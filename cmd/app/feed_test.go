@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ekachaikeaw/social/internal/store"
+	"github.com/ekachaikeaw/social/internal/store/cache"
+)
+
+func TestGetUserFeed(t *testing.T) {
+	app := newTestApplication(t, config{feed: feedConfig{cursorSecret: "test"}})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	validCursor := store.Cursor{CreatedAt: time.Now(), ID: 42}.Encode("test")
+	rankedCursor := store.Cursor{CreatedAt: time.Now(), ID: 42, Score: 1.5, RankedAt: time.Now()}.Encode("test")
+
+	tests := []struct {
+		name     string
+		query    string
+		expected int
+	}{
+		{"should allow offset pagination", "?limit=10&offset=20", http.StatusOK},
+		{"should allow a signed cursor", "?cursor=" + validCursor, http.StatusOK},
+		{"should reject a tampered cursor", "?cursor=" + validCursor + "x", http.StatusBadRequest},
+		{"should reject a cursor signed with another secret", "?cursor=" + store.Cursor{ID: 1}.Encode("other"), http.StatusBadRequest},
+		{"should reject cursor and offset together", "?offset=20&cursor=" + validCursor, http.StatusBadRequest},
+		{"should allow an RFC3339 time window", "?since=2024-01-01T00:00:00Z&until=2024-02-01T00:00:00%2B07:00", http.StatusOK},
+		{"should allow a date time window", "?since=2024-01-01+00:00:00", http.StatusOK},
+		{"should reject a malformed since", "?since=yesterday", http.StatusBadRequest},
+		{"should reject a malformed until", "?until=2024-13-01", http.StatusBadRequest},
+		{"should allow the top sort", "?sort=top", http.StatusOK},
+		{"should allow a ranked cursor with the top sort", "?sort=top&cursor=" + rankedCursor, http.StatusOK},
+		{"should reject a chronological cursor with the top sort", "?sort=top&cursor=" + validCursor, http.StatusBadRequest},
+		{"should reject a ranked cursor with a chronological sort", "?cursor=" + rankedCursor, http.StatusBadRequest},
+		{"should reject an unknown sort", "?sort=hot", http.StatusBadRequest},
+		{"should reject since after until", "?since=2024-02-01T00:00:00Z&until=2024-01-01T00:00:00Z", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "/v1/users/feed"+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("Authorization", "Bearer "+testToken)
+			rr := executeRequest(req, mux)
+
+			checkResponseCode(t, tt.expected, rr.Code)
+		})
+	}
+}
+
+func TestGetExplore(t *testing.T) {
+	app := newTestApplication(t, config{feed: feedConfig{cursorSecret: "test"}})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should not allow unauthenticated request", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/explore", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("should allow popular posts filtered by tags", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/explore?sort=top&tags=go,web", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+}
+
+// downExploreStore is an explore cache whose redis is unreachable
+type downExploreStore struct{}
+
+func (s downExploreStore) Get(context.Context, int64, string) (*cache.ExplorePage, error) {
+	return nil, errors.New("connection refused")
+}
+func (s downExploreStore) Set(context.Context, int64, string, *cache.ExplorePage) error {
+	return errors.New("connection refused")
+}
+
+func TestGetExploreCacheDown(t *testing.T) {
+	app := newTestApplication(t, config{
+		feed:  feedConfig{cursorSecret: "test"},
+		redis: redisConfig{enable: true},
+	})
+	app.cacheStore.Explore = downExploreStore{}
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "/v1/explore", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	rr := executeRequest(req, mux)
+
+	// the page comes from the database instead
+	checkResponseCode(t, http.StatusOK, rr.Code)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/ekachaikeaw/social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// getIncomingFollowRequestsHandler godoc
+//
+//	@Summary		Lists incoming follow requests
+//	@Description	Lists the users waiting for the authenticated user to approve their follow request, most recent first
+//	@Tags			users
+//	@Produce		json
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Param			sort	query		string	false	"Sort by request date, asc or desc"
+//	@Success		200		{object}	[]store.FollowUser
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/follow-requests/incoming [get]
+func (a *application) getIncomingFollowRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	a.followRequestsResponse(w, r, a.store.Follower.GetIncomingRequests)
+}
+
+// getOutgoingFollowRequestsHandler godoc
+//
+//	@Summary		Lists outgoing follow requests
+//	@Description	Lists the private accounts the authenticated user asked to follow, most recent first
+//	@Tags			users
+//	@Produce		json
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Param			sort	query		string	false	"Sort by request date, asc or desc"
+//	@Success		200		{object}	[]store.FollowUser
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/follow-requests/outgoing [get]
+func (a *application) getOutgoingFollowRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	a.followRequestsResponse(w, r, a.store.Follower.GetOutgoingRequests)
+}
+
+func (a *application) followRequestsResponse(w http.ResponseWriter, r *http.Request, list followListFunc) {
+	fq, err := parseListQuery(r)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	users, err := list(r.Context(), getUserFromCtx(r).ID, fq)
+	if err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	if err := a.jsonResponse(w, http.StatusOK, users); err != nil {
+		a.internalServerError(w, r, err)
+	}
+}
+
+// approveFollowRequestHandler godoc
+//
+//	@Summary		Approves a follow request
+//	@Description	Lets the requesting user follow the authenticated user
+//	@Tags			users
+//	@Param			userID	path	int	true	"ID of the requesting user"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		401	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/follow-requests/{userID}/approve [put]
+func (a *application) approveFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+	followerID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+	c := r.Context()
+
+	if err := a.store.Follower.ApproveRequest(c, user.ID, followerID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			a.notFoundErr(w, r, err)
+		default:
+			a.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if a.fanoutEnabled() {
+		a.backfillTimeline(c, followerID, user.ID)
+	}
+
+	a.notify(c, followerID, notification{Kind: "follow_approved", UserID: user.ID})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// rejectFollowRequestHandler godoc
+//
+//	@Summary		Rejects a follow request
+//	@Description	Drops the follow request of a user without notifying them
+//	@Tags			users
+//	@Param			userID	path	int	true	"ID of the requesting user"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		401	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/follow-requests/{userID}/reject [put]
+func (a *application) rejectFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+	followerID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := a.store.Follower.RejectRequest(r.Context(), getUserFromCtx(r).ID, followerID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			a.notFoundErr(w, r, err)
+		default:
+			a.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
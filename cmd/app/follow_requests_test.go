@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ekachaikeaw/social/internal/store"
+)
+
+// followRequestStore holds the pending requests of user 1 and records the
+// queries and answers it gets
+type followRequestStore struct {
+	store.MockFollowerStore
+	pending []int64
+	query   store.PaginatedQuery
+	follows []int64
+}
+
+func (s *followRequestStore) GetIncomingRequests(c context.Context, userID int64, fq store.PaginatedQuery) ([]store.FollowUser, error) {
+	s.query = fq
+
+	users := []store.FollowUser{}
+	for _, id := range s.pending {
+		users = append(users, store.FollowUser{ID: id})
+	}
+	return users, nil
+}
+
+func (s *followRequestStore) answer(userID, followerID int64) error {
+	for i, id := range s.pending {
+		if userID == 1 && id == followerID {
+			s.pending = append(s.pending[:i], s.pending[i+1:]...)
+			return nil
+		}
+	}
+	return store.ErrNotFound
+}
+
+func (s *followRequestStore) ApproveRequest(c context.Context, userID, followerID int64) error {
+	if err := s.answer(userID, followerID); err != nil {
+		return err
+	}
+	s.follows = append(s.follows, followerID)
+	return nil
+}
+
+func (s *followRequestStore) RejectRequest(c context.Context, userID, followerID int64) error {
+	return s.answer(userID, followerID)
+}
+
+func TestFollowRequests(t *testing.T) {
+	app := newTestApplication(t, config{})
+	follower := &followRequestStore{pending: []int64{2, 3}}
+	app.store.Follower = follower
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(method, url string, auth bool) *http.Response {
+		req, err := http.NewRequest(method, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if auth {
+			req.Header.Set("Authorization", "Bearer "+testToken)
+		}
+		return executeRequest(req, mux).Result()
+	}
+
+	pending := func(t *testing.T) []int64 {
+		t.Helper()
+
+		res := request(http.MethodGet, "/v1/follow-requests/incoming?sort=asc", true)
+		checkResponseCode(t, http.StatusOK, res.StatusCode)
+
+		var body struct {
+			Data []store.FollowUser `json:"data"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+
+		ids := []int64{}
+		for _, u := range body.Data {
+			ids = append(ids, u.ID)
+		}
+		return ids
+	}
+
+	t.Run("should list the pending requests", func(t *testing.T) {
+		if ids := pending(t); len(ids) != 2 || ids[0] != 2 || ids[1] != 3 {
+			t.Errorf("unexpected requests %v", ids)
+		}
+		if follower.query.Sort != "asc" {
+			t.Errorf("expected the sort passed on, got %q", follower.query.Sort)
+		}
+	})
+
+	t.Run("should reject bad queries and ids", func(t *testing.T) {
+		checkResponseCode(t, http.StatusBadRequest, request(http.MethodGet, "/v1/follow-requests/incoming?sort=top", true).StatusCode)
+		checkResponseCode(t, http.StatusBadRequest, request(http.MethodPut, "/v1/follow-requests/gopher/approve", true).StatusCode)
+		checkResponseCode(t, http.StatusUnauthorized, request(http.MethodGet, "/v1/follow-requests/incoming", false).StatusCode)
+	})
+
+	t.Run("should approve and notify the follower", func(t *testing.T) {
+		sub, err := app.broker.Subscribe(context.Background(), notificationsTopic(2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sub.Close()
+
+		checkResponseCode(t, http.StatusNoContent, request(http.MethodPut, "/v1/follow-requests/2/approve", true).StatusCode)
+		if len(follower.follows) != 1 || follower.follows[0] != 2 {
+			t.Errorf("expected user 2 to follow, got %v", follower.follows)
+		}
+
+		select {
+		case e := <-sub.C:
+			var n notification
+			if err := json.Unmarshal(e.Data, &n); err != nil {
+				t.Fatal(err)
+			}
+			if n.Kind != "follow_approved" || n.UserID != 1 {
+				t.Errorf("unexpected notification %+v", n)
+			}
+		case <-time.After(time.Second):
+			t.Error("expected a notification")
+		}
+
+		checkResponseCode(t, http.StatusNotFound, request(http.MethodPut, "/v1/follow-requests/2/approve", true).StatusCode)
+	})
+
+	t.Run("should reject without a follow", func(t *testing.T) {
+		checkResponseCode(t, http.StatusNoContent, request(http.MethodPut, "/v1/follow-requests/3/reject", true).StatusCode)
+		if len(follower.follows) != 1 {
+			t.Errorf("expected no follow from a rejection, got %v", follower.follows)
+		}
+		if ids := pending(t); len(ids) != 0 {
+			t.Errorf("expected no pending requests, got %v", ids)
+		}
+	})
+}
@@ -0,0 +1,523 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ekachaikeaw/social/internal/ratelimiter"
+	"github.com/ekachaikeaw/social/internal/store"
+	"github.com/ekachaikeaw/social/internal/stream"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// gatewayWriteWait is the time allowed to write one frame
+	gatewayWriteWait = time.Second * 10
+	// gatewayPongWait is how long a connection may stay silent
+	gatewayPongWait = time.Second * 60
+	// gatewayPingPeriod must be shorter than gatewayPongWait
+	gatewayPingPeriod = gatewayPongWait * 9 / 10
+	// gatewaySendBuffer is the number of frames held for a slow client
+	// before it is disconnected
+	gatewaySendBuffer = 64
+	// gatewayMaxTopics caps the subscriptions of one connection
+	gatewayMaxTopics      = 50
+	gatewayMaxMessageSize = 4096
+)
+
+// gatewayProtocol is the subprotocol browsers use to pass the access token,
+// they can't set an Authorization header on a websocket handshake
+const gatewayProtocol = "access_token"
+
+// gatewayMessage is a frame in either direction. Clients send subscribe,
+// unsubscribe and typing, the server sends notification, presence, typing,
+// subscribed, unsubscribed and error.
+type gatewayMessage struct {
+	Type  string          `json:"type"`
+	Topic string          `json:"topic,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+}
+
+// notification is sent to a user when someone interacts with them
+type notification struct {
+	Kind     string `json:"kind"`
+	UserID   int64  `json:"user_id"`
+	PostID   int64  `json:"post_id,omitempty"`
+	Reaction string `json:"reaction,omitempty"`
+}
+
+type presence struct {
+	UserID int64 `json:"user_id"`
+	Online bool  `json:"online"`
+}
+
+type typing struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+}
+
+// revocation is published on the notifications topic of a user when they
+// log out, it never reaches the client. An empty JTI closes every connection
+// of the user.
+type revocation struct {
+	JTI string `json:"jti,omitempty"`
+}
+
+// gatewayHandler godoc
+//
+//	@Summary		Opens the real-time gateway
+//	@Description	Upgrades to a websocket carrying notifications, typing indicators and presence. Authenticate with a bearer token, or from browsers with the subprotocols "access_token" and the token.
+//	@Tags			gateway
+//	@Success		101	{string}	string	"Switching Protocols"
+//	@Failure		401	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/gateway [get]
+func (app *application) gatewayHandler(w http.ResponseWriter, r *http.Request) {
+	token := gatewayToken(r)
+	if token == "" {
+		app.unauthorizedErrorResponse(w, r, fmt.Errorf("access token is missing"))
+		return
+	}
+
+	user, claims, err := app.authenticate(r.Context(), token)
+	if err != nil {
+		app.unauthorizedErrorResponse(w, r, err)
+		return
+	}
+
+	upgrader := websocket.Upgrader{
+		Subprotocols: []string{gatewayProtocol},
+		CheckOrigin:  app.checkGatewayOrigin,
+	}
+
+	// the upgrader replies on failure
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	conn := &gatewayConn{
+		app:    app,
+		ws:     ws,
+		user:   user,
+		jti:    claims["jti"].(string),
+		id:     uuid.New().String(),
+		send:   make(chan gatewayMessage, gatewaySendBuffer),
+		done:   make(chan struct{}),
+		topics: make(map[string]*gatewaySub),
+	}
+
+	if app.config.gateway.rateLimiter.Enable {
+		conn.limiter = ratelimiter.NewFixedWindowRateLimiter(
+			app.config.gateway.rateLimiter.RequestPerTimeFrame,
+			app.config.gateway.rateLimiter.TimeFram,
+		)
+	}
+
+	conn.serve()
+}
+
+// notify pushes a notification to the gateway connections of userID
+func (app *application) notify(c context.Context, userID int64, n notification) {
+	data, err := json.Marshal(n)
+	if err != nil {
+		app.logger.Errorw("error sending notification", "user_id", userID, "error", err)
+		return
+	}
+
+	e := stream.Event{Type: "notification", Data: data}
+	if err := app.broker.Publish(c, e, notificationsTopic(userID)); err != nil {
+		app.logger.Errorw("error sending notification", "user_id", userID, "error", err)
+	}
+}
+
+// closeGateway closes the gateway connections userID opened with the token
+// jti, or all of them when jti is empty, on every instance
+func (app *application) closeGateway(c context.Context, userID int64, jti string) {
+	data, err := json.Marshal(revocation{JTI: jti})
+	if err != nil {
+		app.logger.Errorw("error closing gateway", "user_id", userID, "error", err)
+		return
+	}
+
+	e := stream.Event{Type: "revoked", Data: data}
+	if err := app.broker.Publish(c, e, notificationsTopic(userID)); err != nil {
+		app.logger.Errorw("error closing gateway", "user_id", userID, "error", err)
+	}
+}
+
+func (app *application) checkGatewayOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || origin == app.config.gateway.allowedOrigin {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+func gatewayToken(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return token
+	}
+
+	protocols := websocket.Subprotocols(r)
+	if len(protocols) == 2 && protocols[0] == gatewayProtocol {
+		return protocols[1]
+	}
+
+	return ""
+}
+
+type gatewayConn struct {
+	app     *application
+	ws      *websocket.Conn
+	user    *store.User
+	jti     string
+	id      string
+	limiter ratelimiter.Limiter
+
+	send chan gatewayMessage
+	done chan struct{}
+	once sync.Once
+
+	// topics is only touched by the read loop
+	topics map[string]*gatewaySub
+}
+
+type gatewaySub struct {
+	*stream.Subscription
+	brokerTopic string
+	stopped     atomic.Bool
+}
+
+func (conn *gatewayConn) serve() {
+	c := context.Background()
+
+	defer conn.cleanup(c)
+	go conn.writeLoop(c)
+
+	conn.ws.SetReadLimit(gatewayMaxMessageSize)
+	conn.ws.SetReadDeadline(time.Now().Add(gatewayPongWait))
+	conn.ws.SetPongHandler(func(string) error {
+		return conn.ws.SetReadDeadline(time.Now().Add(gatewayPongWait))
+	})
+
+	if err := conn.subscribe(c, "notifications"); err != nil {
+		conn.app.logger.Errorw("error opening gateway", "user_id", conn.user.ID, "error", err)
+		conn.close(websocket.CloseInternalServerErr, "internal server error")
+		return
+	}
+
+	conn.touch(c)
+
+	for {
+		_, data, err := conn.ws.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		if conn.limiter != nil {
+			if allow, retryAfter := conn.limiter.Allow(conn.id); !allow {
+				conn.error(fmt.Sprintf("rate limit exceeded, retry after %s", retryAfter))
+				continue
+			}
+		}
+
+		var msg gatewayMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			conn.error("invalid message")
+			continue
+		}
+
+		conn.handle(c, msg)
+	}
+}
+
+func (conn *gatewayConn) handle(c context.Context, msg gatewayMessage) {
+	switch msg.Type {
+	case "subscribe":
+		if _, ok := conn.topics[msg.Topic]; ok {
+			conn.reply("subscribed", msg.Topic)
+			return
+		}
+
+		if len(conn.topics) >= gatewayMaxTopics {
+			conn.error("too many subscriptions")
+			return
+		}
+
+		if err := conn.subscribe(c, msg.Topic); err != nil {
+			conn.topicError(msg.Topic, err)
+			return
+		}
+
+		conn.reply("subscribed", msg.Topic)
+
+		if kind, id, _ := strings.Cut(msg.Topic, ":"); kind == "presence" {
+			userID, _ := strconv.ParseInt(id, 10, 64)
+			online, err := conn.app.cacheStore.Presence.IsOnline(c, userID)
+			if err != nil {
+				conn.app.logger.Errorw("error reading presence", "user_id", userID, "error", err)
+				return
+			}
+
+			data, _ := json.Marshal(presence{UserID: userID, Online: online})
+			conn.enqueue(gatewayMessage{Type: "presence", Topic: msg.Topic, Data: data})
+		}
+	case "unsubscribe":
+		sub, ok := conn.topics[msg.Topic]
+		if !ok || msg.Topic == "notifications" {
+			conn.error(fmt.Sprintf("not subscribed to %s", msg.Topic))
+			return
+		}
+
+		sub.stopped.Store(true)
+		sub.Close()
+		delete(conn.topics, msg.Topic)
+
+		conn.reply("unsubscribed", msg.Topic)
+	case "typing":
+		// typing is only relayed to the comment threads the client follows
+		sub, ok := conn.topics[msg.Topic]
+		if kind, _, _ := strings.Cut(msg.Topic, ":"); kind != "post" || !ok {
+			conn.error(fmt.Sprintf("not subscribed to %s", msg.Topic))
+			return
+		}
+
+		data, _ := json.Marshal(typing{UserID: conn.user.ID, Username: conn.user.Username})
+		if err := conn.app.broker.Publish(c, stream.Event{Type: "typing", Data: data}, sub.brokerTopic); err != nil {
+			conn.app.logger.Errorw("error publishing typing", "user_id", conn.user.ID, "error", err)
+		}
+	default:
+		conn.error(fmt.Sprintf("unknown message type %q", msg.Type))
+	}
+}
+
+func (conn *gatewayConn) subscribe(c context.Context, topic string) error {
+	brokerTopic, err := conn.app.gatewayTopic(c, conn.user, topic)
+	if err != nil {
+		return err
+	}
+
+	s, err := conn.app.broker.Subscribe(c, brokerTopic)
+	if err != nil {
+		return err
+	}
+
+	sub := &gatewaySub{Subscription: s, brokerTopic: brokerTopic}
+	conn.topics[topic] = sub
+
+	go conn.forward(topic, sub)
+
+	return nil
+}
+
+// forward copies the events of one subscription to the client
+func (conn *gatewayConn) forward(topic string, sub *gatewaySub) {
+	for e := range sub.C {
+		if e.Type == "revoked" {
+			var rev revocation
+			if err := json.Unmarshal(e.Data, &rev); err == nil && (rev.JTI == "" || rev.JTI == conn.jti) {
+				conn.close(websocket.ClosePolicyViolation, "session revoked")
+			}
+			continue
+		}
+
+		conn.enqueue(gatewayMessage{Type: e.Type, Topic: topic, Data: e.Data})
+	}
+
+	// the broker dropped us for lagging or is shutting down, the client
+	// reconnects and subscribes again
+	if !sub.stopped.Load() {
+		conn.close(websocket.CloseTryAgainLater, "subscription closed")
+	}
+}
+
+// enqueue never blocks, a client that can't keep up is disconnected so the
+// broadcaster doesn't wait on it
+func (conn *gatewayConn) enqueue(msg gatewayMessage) {
+	select {
+	case conn.send <- msg:
+	case <-conn.done:
+	default:
+		conn.close(websocket.CloseTryAgainLater, "client too slow")
+	}
+}
+
+func (conn *gatewayConn) writeLoop(c context.Context) {
+	ping := time.NewTicker(gatewayPingPeriod)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-conn.done:
+			return
+		case msg := <-conn.send:
+			conn.ws.SetWriteDeadline(time.Now().Add(gatewayWriteWait))
+			if err := conn.ws.WriteJSON(msg); err != nil {
+				conn.close(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		case <-ping.C:
+			if err := conn.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(gatewayWriteWait)); err != nil {
+				conn.close(websocket.CloseAbnormalClosure, "")
+				return
+			}
+
+			conn.touch(c)
+		}
+	}
+}
+
+func (conn *gatewayConn) reply(kind, topic string) {
+	conn.enqueue(gatewayMessage{Type: kind, Topic: topic})
+}
+
+func (conn *gatewayConn) error(message string) {
+	data, _ := json.Marshal(map[string]string{"error": message})
+	conn.enqueue(gatewayMessage{Type: "error", Data: data})
+}
+
+func (conn *gatewayConn) topicError(topic string, err error) {
+	var topicErr gatewayTopicError
+	if errors.As(err, &topicErr) {
+		conn.error(topicErr.Error())
+		return
+	}
+
+	conn.app.logger.Errorw("error subscribing", "user_id", conn.user.ID, "topic", topic, "error", err)
+	conn.error("internal server error")
+}
+
+// touch keeps the user online for as long as the connection answers pings
+func (conn *gatewayConn) touch(c context.Context) {
+	online, err := conn.app.cacheStore.Presence.Touch(c, conn.user.ID, conn.id, gatewayPongWait+gatewayWriteWait)
+	if err != nil {
+		conn.app.logger.Errorw("error updating presence", "user_id", conn.user.ID, "error", err)
+		return
+	}
+
+	if online {
+		conn.publishPresence(c, true)
+	}
+}
+
+func (conn *gatewayConn) cleanup(c context.Context) {
+	conn.close(websocket.CloseNormalClosure, "")
+
+	for _, sub := range conn.topics {
+		sub.stopped.Store(true)
+		sub.Close()
+	}
+
+	offline, err := conn.app.cacheStore.Presence.Leave(c, conn.user.ID, conn.id)
+	if err != nil {
+		conn.app.logger.Errorw("error updating presence", "user_id", conn.user.ID, "error", err)
+		return
+	}
+
+	if offline {
+		conn.publishPresence(c, false)
+	}
+}
+
+func (conn *gatewayConn) publishPresence(c context.Context, online bool) {
+	data, _ := json.Marshal(presence{UserID: conn.user.ID, Online: online})
+	if err := conn.app.broker.Publish(c, stream.Event{Type: "presence", Data: data}, presenceTopic(conn.user.ID)); err != nil {
+		conn.app.logger.Errorw("error publishing presence", "user_id", conn.user.ID, "error", err)
+	}
+}
+
+func (conn *gatewayConn) close(code int, reason string) {
+	conn.once.Do(func() {
+		close(conn.done)
+
+		if code != websocket.CloseAbnormalClosure {
+			msg := websocket.FormatCloseMessage(code, reason)
+			conn.ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(gatewayWriteWait))
+		}
+
+		conn.ws.Close()
+	})
+}
+
+type gatewayTopicError string
+
+func (e gatewayTopicError) Error() string {
+	return string(e)
+}
+
+// gatewayTopic checks that user may subscribe to a client topic and returns
+// the broker topic behind it. Topics are notifications, presence:<userID>
+// and post:<postID>.
+func (app *application) gatewayTopic(c context.Context, user *store.User, topic string) (string, error) {
+	kind, id, _ := strings.Cut(topic, ":")
+	switch kind {
+	case "notifications":
+		if id == "" {
+			return notificationsTopic(user.ID), nil
+		}
+	case "presence":
+		userID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			break
+		}
+
+		// blocked users don't get to see each other come online
+		if userID != user.ID {
+			unblocked, err := app.store.Block.NotBlocked(c, user.ID, userID)
+			if err != nil {
+				return "", err
+			}
+			if !unblocked {
+				return "", gatewayTopicError("user not found")
+			}
+		}
+
+		return presenceTopic(userID), nil
+	case "post":
+		postID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			break
+		}
+
+		post, err := app.store.Posts.GetByID(c, postID)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				return "", gatewayTopicError("post not found")
+			}
+			return "", err
+		}
+
+		visible, err := app.store.Follower.CanSee(c, user.ID, post.UserID)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return "", err
+		}
+		if !visible {
+			return "", gatewayTopicError("post not found")
+		}
+
+		return fmt.Sprintf("gateway-post-%d", postID), nil
+	}
+
+	return "", gatewayTopicError(fmt.Sprintf("unknown topic %q", topic))
+}
+
+func notificationsTopic(userID int64) string {
+	return fmt.Sprintf("gateway-notifications-%d", userID)
+}
+
+func presenceTopic(userID int64) string {
+	return fmt.Sprintf("gateway-presence-%d", userID)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ekachaikeaw/social/internal/ratelimiter"
+	"github.com/ekachaikeaw/social/internal/store"
+	"github.com/gorilla/websocket"
+)
+
+func TestGateway(t *testing.T) {
+	cfg := config{
+		gateway: gatewayConfig{
+			rateLimiter: ratelimiter.Config{
+				RequestPerTimeFrame: 5,
+				TimeFram:            time.Second * 5,
+				Enable:              true,
+			},
+		},
+	}
+	app := newTestApplication(t, cfg)
+	// user 3 blocked the user of the mock token
+	app.store.Block = &memoryBlockStore{blocks: []store.BlockedUser{{UserID: 3, BlockedUserID: 1}}}
+	ts := httptest.NewServer(app.mount())
+	defer ts.Close()
+
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/v1/gateway"
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dial := func(t *testing.T, header http.Header) *websocket.Conn {
+		t.Helper()
+
+		ws, _, err := websocket.DefaultDialer.Dial(url, header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { ws.Close() })
+
+		return ws
+	}
+
+	read := func(t *testing.T, ws *websocket.Conn) gatewayMessage {
+		t.Helper()
+
+		ws.SetReadDeadline(time.Now().Add(time.Second))
+
+		var msg gatewayMessage
+		if err := ws.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+
+		return msg
+	}
+
+	t.Run("should not allow unauthenticated connections", func(t *testing.T) {
+		_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+		if err == nil {
+			t.Fatal("expected the handshake to fail")
+		}
+
+		checkResponseCode(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("should authenticate with the access token subprotocol", func(t *testing.T) {
+		dialer := websocket.Dialer{Subprotocols: []string{gatewayProtocol, testToken}}
+
+		ws, _, err := dialer.Dial(url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ws.Close()
+
+		if ws.Subprotocol() != gatewayProtocol {
+			t.Errorf("expected subprotocol %s. Got %s", gatewayProtocol, ws.Subprotocol())
+		}
+	})
+
+	t.Run("should deliver notifications and typing", func(t *testing.T) {
+		ws := dial(t, http.Header{"Authorization": {"Bearer " + testToken}})
+
+		if err := ws.WriteJSON(gatewayMessage{Type: "subscribe", Topic: "post:1"}); err != nil {
+			t.Fatal(err)
+		}
+		if msg := read(t, ws); msg.Type != "subscribed" || msg.Topic != "post:1" {
+			t.Fatalf("unexpected message %+v", msg)
+		}
+
+		if err := ws.WriteJSON(gatewayMessage{Type: "typing", Topic: "post:1"}); err != nil {
+			t.Fatal(err)
+		}
+		if msg := read(t, ws); msg.Type != "typing" || msg.Topic != "post:1" {
+			t.Fatalf("unexpected message %+v", msg)
+		}
+
+		// the mock token is the one of user 1
+		app.notify(context.Background(), 1, notification{Kind: "follow", UserID: 2})
+
+		msg := read(t, ws)
+		if msg.Type != "notification" || msg.Topic != "notifications" {
+			t.Fatalf("unexpected message %+v", msg)
+		}
+
+		var n notification
+		if err := json.Unmarshal(msg.Data, &n); err != nil {
+			t.Fatal(err)
+		}
+		if n.Kind != "follow" || n.UserID != 2 {
+			t.Errorf("unexpected notification %+v", n)
+		}
+	})
+
+	t.Run("should reject unknown topics", func(t *testing.T) {
+		ws := dial(t, http.Header{"Authorization": {"Bearer " + testToken}})
+
+		if err := ws.WriteJSON(gatewayMessage{Type: "subscribe", Topic: "notifications:1"}); err != nil {
+			t.Fatal(err)
+		}
+		if msg := read(t, ws); msg.Type != "error" {
+			t.Fatalf("expected an error. Got %+v", msg)
+		}
+	})
+
+	t.Run("should hide the presence of users who blocked each other", func(t *testing.T) {
+		ws := dial(t, http.Header{"Authorization": {"Bearer " + testToken}})
+
+		if err := ws.WriteJSON(gatewayMessage{Type: "subscribe", Topic: "presence:3"}); err != nil {
+			t.Fatal(err)
+		}
+		if msg := read(t, ws); msg.Type != "error" || !strings.Contains(string(msg.Data), "user not found") {
+			t.Fatalf("expected an error. Got %+v", msg)
+		}
+
+		if err := ws.WriteJSON(gatewayMessage{Type: "subscribe", Topic: "presence:2"}); err != nil {
+			t.Fatal(err)
+		}
+		if msg := read(t, ws); msg.Type != "subscribed" || msg.Topic != "presence:2" {
+			t.Fatalf("unexpected message %+v", msg)
+		}
+	})
+
+	t.Run("should rate limit messages per connection", func(t *testing.T) {
+		ws := dial(t, http.Header{"Authorization": {"Bearer " + testToken}})
+
+		for i := 0; i < cfg.gateway.rateLimiter.RequestPerTimeFrame+1; i++ {
+			if err := ws.WriteJSON(gatewayMessage{Type: "subscribe", Topic: "presence:1"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var limited bool
+		for i := 0; i < cfg.gateway.rateLimiter.RequestPerTimeFrame*2+1; i++ {
+			msg := read(t, ws)
+			if msg.Type == "error" && strings.Contains(string(msg.Data), "rate limit") {
+				limited = true
+				break
+			}
+		}
+
+		if !limited {
+			t.Error("expected the connection to be rate limited")
+		}
+	})
+}
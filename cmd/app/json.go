@@ -14,7 +14,11 @@ func init() {
 }
 
 func writeJson(w http.ResponseWriter, status int, data any) error {
-	w.Header().Set("Content-Type", "application/json")
+	return writeContentJson(w, status, "application/json", data)
+}
+
+func writeContentJson(w http.ResponseWriter, status int, contentType string, data any) error {
+	w.Header().Set("Content-Type", contentType)
 	w.WriteHeader(status)
 	return json.NewEncoder(w).Encode(data)
 }
@@ -46,3 +50,12 @@ func (a *application) jsonResponse(w http.ResponseWriter, status int, data any)
 
 	return writeJson(w, status, &envelope{Data: data})
 }
+
+func (a *application) paginatedResponse(w http.ResponseWriter, status int, data any, nextCursor string) error {
+	type envelope struct {
+		Data       any    `json:"data"`
+		NextCursor string `json:"next_cursor,omitempty"`
+	}
+
+	return writeJson(w, status, &envelope{Data: data, NextCursor: nextCursor})
+}
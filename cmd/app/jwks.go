@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/ekachaikeaw/social/internal/auth"
+)
+
+// newKeyAuthenticator loads the signing key and the extra verification keys
+// of cfg, the files of rotated out keys may hold public keys only
+func newKeyAuthenticator(cfg tokenConfig) (*auth.JWTAuthenticator, error) {
+	signing, err := auth.LoadKeyFile(cfg.signingKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var verify []*auth.Key
+	for _, path := range cfg.verificationKeyFiles {
+		if path == "" {
+			continue
+		}
+
+		key, err := auth.LoadKeyFile(path)
+		if err != nil {
+			return nil, err
+		}
+		verify = append(verify, key)
+	}
+
+	return auth.NewKeyAuthenticator(signing, verify, cfg.iss, cfg.iss)
+}
+
+// jwksHandler godoc
+//
+//	@Summary		JSON Web Key Set
+//	@Description	Lists the public keys access tokens are verified with, empty while tokens are signed with a shared secret
+//	@Tags			authentication
+//	@Produce		json
+//	@Success		200	{object}	auth.JWKS
+//	@Router			/.well-known/jwks.json [get]
+func (app *application) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	if err := writeContentJson(w, http.StatusOK, "application/jwk-set+json", app.authenticator.JWKS()); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
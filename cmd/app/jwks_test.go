@@ -0,0 +1,34 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/ekachaikeaw/social/internal/auth"
+)
+
+func TestJWKS(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	req, err := http.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := executeRequest(req, mux)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+
+	if ct := rr.Header().Get("Content-Type"); ct != "application/jwk-set+json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	var set auth.JWKS
+	if err := json.NewDecoder(rr.Body).Decode(&set); err != nil {
+		t.Fatal(err)
+	}
+	if set.Keys == nil {
+		t.Error("keys should be an empty list, not null")
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+)
+
+type LogoutPayload struct {
+	RefreshToken string `json:"refresh_token" validate:"max=255"`
+}
+
+// logoutHandler godoc
+//
+//	@Summary		Logs out
+//	@Description	Revokes the access token of the request and, when given, the refresh token of the same login. Closes the gateway connections opened with the access token.
+//	@Tags			authentication
+//	@Accept			json
+//	@Param			payload	body	LogoutPayload	false	"Refresh token"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		401	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/authentication/logout [post]
+func (a *application) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	// the body is optional, without it only the access token is revoked
+	var payload LogoutPayload
+	if err := readJson(w, r, &payload); err != nil && !errors.Is(err, io.EOF) {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	c := r.Context()
+	user := getUserFromCtx(r)
+	claims := getClaimsFromCtx(r)
+
+	jti, _ := claims["jti"].(string)
+	exp, err := claims.GetExpirationTime()
+	if err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	if err := a.cacheStore.Revocations.Revoke(c, jti, time.Until(exp.Time)); err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	if payload.RefreshToken != "" {
+		if err := a.store.RefreshToken.Revoke(c, user.ID, payload.RefreshToken); err != nil {
+			a.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	a.closeGateway(c, user.ID, jti)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// logoutAllHandler godoc
+//
+//	@Summary		Logs out everywhere
+//	@Description	Revokes every access and refresh token of the authenticated user, including the one of the request, and closes their gateway connections
+//	@Tags			authentication
+//	@Success		204
+//	@Failure		401	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/authentication/logout-all [post]
+func (a *application) logoutAllHandler(w http.ResponseWriter, r *http.Request) {
+	c := r.Context()
+	user := getUserFromCtx(r)
+
+	if err := a.store.RefreshToken.RevokeAll(c, user.ID); err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	// tokens issued before the current second go, like on a password change
+	// a login within the same second stays valid. The token of the request
+	// may be of this second so it is revoked on its own, access tokens are
+	// at most token.exp old.
+	claims := getClaimsFromCtx(r)
+	jti, _ := claims["jti"].(string)
+	exp, err := claims.GetExpirationTime()
+	if err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	if err := a.cacheStore.Revocations.Revoke(c, jti, time.Until(exp.Time)); err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	if err := a.cacheStore.Revocations.RevokeUser(c, user.ID, time.Now(), a.config.auth.token.exp); err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	a.closeGateway(c, user.ID, "")
+
+	w.WriteHeader(http.StatusNoContent)
+}
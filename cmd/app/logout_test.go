@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ekachaikeaw/social/internal/auth"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+)
+
+func TestLogout(t *testing.T) {
+	cfg := config{
+		auth: authConfig{
+			token: tokenConfig{exp: time.Hour},
+		},
+	}
+
+	request := func(t *testing.T, app *application, method, url, token, body string) int {
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return executeRequest(req, app.mount()).Code
+	}
+
+	t.Run("should revoke the token on logout", func(t *testing.T) {
+		app := newTestApplication(t, cfg)
+		testToken, err := app.authenticator.GenerateToken(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		checkResponseCode(t, http.StatusOK, request(t, app, http.MethodGet, "/v1/users/1", testToken, ""))
+		checkResponseCode(t, http.StatusNoContent, request(t, app, http.MethodPost, "/v1/authentication/logout", testToken, `{"refresh_token":"valid"}`))
+		checkResponseCode(t, http.StatusUnauthorized, request(t, app, http.MethodGet, "/v1/users/1", testToken, ""))
+	})
+
+	t.Run("should log out without a refresh token", func(t *testing.T) {
+		app := newTestApplication(t, cfg)
+		testToken, err := app.authenticator.GenerateToken(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		checkResponseCode(t, http.StatusNoContent, request(t, app, http.MethodPost, "/v1/authentication/logout", testToken, ""))
+	})
+
+	t.Run("should revoke every token on logout-all", func(t *testing.T) {
+		app := newTestApplication(t, cfg)
+		testToken, err := app.authenticator.GenerateToken(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		checkResponseCode(t, http.StatusNoContent, request(t, app, http.MethodPost, "/v1/authentication/logout-all", testToken, ""))
+
+		revoked, err := app.cacheStore.Revocations.IsRevoked(context.Background(), "other-jti", 1, time.Now().Add(-time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !revoked {
+			t.Error("expected tokens issued before logout-all to be revoked")
+		}
+
+		revoked, err = app.cacheStore.Revocations.IsRevoked(context.Background(), "other-jti", 1, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if revoked {
+			t.Error("expected a login after logout-all to stay valid")
+		}
+
+		checkResponseCode(t, http.StatusUnauthorized, request(t, app, http.MethodGet, "/v1/users/1", testToken, ""))
+	})
+
+	t.Run("should close the gateway connections", func(t *testing.T) {
+		app := newTestApplication(t, config{
+			auth: authConfig{token: tokenConfig{exp: time.Hour, iss: "test-aud"}},
+		})
+		app.authenticator = auth.NewJWTAuthenticator("test", "test-aud", "test-aud")
+		ts := httptest.NewServer(app.mount())
+		defer ts.Close()
+
+		token := func(jti string) string {
+			token, err := app.authenticator.GenerateToken(jwt.MapClaims{
+				"jti": jti,
+				"sub": int64(1),
+				"iat": time.Now().Unix(),
+				"exp": time.Now().Add(time.Hour).Unix(),
+				"iss": "test-aud",
+				"aud": "test-aud",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return token
+		}
+
+		dial := func(token string) *websocket.Conn {
+			url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/v1/gateway"
+			ws, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Authorization": {"Bearer " + token}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { ws.Close() })
+
+			// once a subscription is answered the notifications one is open
+			if err := ws.WriteJSON(gatewayMessage{Type: "subscribe", Topic: "presence:2"}); err != nil {
+				t.Fatal(err)
+			}
+			var msg gatewayMessage
+			if err := ws.ReadJSON(&msg); err != nil || msg.Type != "subscribed" {
+				t.Fatalf("unexpected message %+v: %v", msg, err)
+			}
+			return ws
+		}
+
+		// closed reports whether the server closed ws as revoked, a
+		// connection left open times out instead
+		closed := func(ws *websocket.Conn, wait time.Duration) bool {
+			ws.SetReadDeadline(time.Now().Add(wait))
+			for {
+				if _, _, err := ws.ReadMessage(); err != nil {
+					return websocket.IsCloseError(err, websocket.ClosePolicyViolation)
+				}
+			}
+		}
+
+		first, second := token("first"), token("second")
+		firstWS, secondWS := dial(first), dial(second)
+
+		checkResponseCode(t, http.StatusNoContent, request(t, app, http.MethodPost, "/v1/authentication/logout", first, ""))
+		if !closed(firstWS, time.Second) {
+			t.Error("expected the connection of the token to be closed")
+		}
+		if closed(secondWS, 100*time.Millisecond) {
+			t.Error("expected the connection of another login to stay open")
+		}
+
+		secondWS = dial(second)
+		checkResponseCode(t, http.StatusNoContent, request(t, app, http.MethodPost, "/v1/authentication/logout-all", second, ""))
+		if !closed(secondWS, time.Second) {
+			t.Error("expected every connection to be closed")
+		}
+	})
+
+	t.Run("should not log out unauthenticated", func(t *testing.T) {
+		app := newTestApplication(t, cfg)
+
+		checkResponseCode(t, http.StatusUnauthorized, request(t, app, http.MethodPost, "/v1/authentication/logout", "", ""))
+	})
+}
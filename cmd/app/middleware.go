@@ -5,10 +5,13 @@ import (
 	"encoding/base64"
 	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ekachaikeaw/social/internal/store"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/golang-jwt/jwt/v5"
 )
 
@@ -27,33 +30,93 @@ func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		token := parts[1]
-		jwtToken, err := app.authenticator.ValidateToken(token)
-		if err != nil {
-			app.unauthorizedErrorResponse(w, r, err)
-			return
-		}
-
-		claims, _ := jwtToken.Claims.(jwt.MapClaims)
-		userID, err := strconv.ParseInt(fmt.Sprintf("%.f", claims["sub"]), 10, 64)
-		if err != nil {
-			app.unauthorizedErrorResponse(w, r, err)
-			return
-		}
-
 		c := r.Context()
-		user, err := app.getUser(c, userID)
+		user, claims, err := app.authenticate(c, parts[1])
 		if err != nil {
 			app.unauthorizedErrorResponse(w, r, err)
 			return
 		}
 
 		c = context.WithValue(c, userKey{}, user)
+		c = context.WithValue(c, claimsKey{}, claims)
 
 		next.ServeHTTP(w, r.WithContext(c))
 	})
 }
 
+type claimsKey struct{}
+
+// authenticate validates a bearer token, checks it wasn't revoked and loads
+// the user it was issued to
+func (app *application) authenticate(c context.Context, token string) (*store.User, jwt.MapClaims, error) {
+	jwtToken, err := app.authenticator.ValidateToken(token)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	claims, _ := jwtToken.Claims.(jwt.MapClaims)
+	userID, err := strconv.ParseInt(fmt.Sprintf("%.f", claims["sub"]), 10, 64)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	jti, _ := claims["jti"].(string)
+	iat, _ := claims.GetIssuedAt()
+	if jti == "" || iat == nil {
+		return nil, nil, fmt.Errorf("token has no id or issue time")
+	}
+
+	// checked before loading the user, a single lookup in redis or memory
+	revoked, err := app.cacheStore.Revocations.IsRevoked(c, jti, userID, iat.Time)
+	if err != nil {
+		return nil, nil, err
+	}
+	if revoked {
+		return nil, nil, fmt.Errorf("token was revoked")
+	}
+
+	user, err := app.getUser(c, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// changing the password signs out every session started before, both
+	// times are in whole seconds so a token of the same second stays valid
+	if user.PasswordChangedAt != nil {
+		if iat.Unix() < user.PasswordChangedAt.Unix() {
+			return nil, nil, fmt.Errorf("token was issued before the last password change")
+		}
+	}
+
+	return user, claims, nil
+}
+
+func getClaimsFromCtx(r *http.Request) jwt.MapClaims {
+	claims, _ := r.Context().Value(claimsKey{}).(jwt.MapClaims)
+	return claims
+}
+
+// TimeoutMiddleware is middleware.Timeout except for the paths in
+// longLived, the event stream and websocket routes that stay open for as
+// long as the client is connected. Only the path counts, what the client
+// asks for with its headers doesn't.
+func (app *application) TimeoutMiddleware(timeout time.Duration, longLived ...string) func(http.Handler) http.Handler {
+	withTimeout := middleware.Timeout(timeout)
+
+	return func(next http.Handler) http.Handler {
+		timed := withTimeout(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if slices.Contains(longLived, r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			timed.ServeHTTP(w, r)
+		})
+	}
+}
+
 func (app *application) BasicAuthMiddleware() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ekachaikeaw/social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+type MuteUserPayload struct {
+	ExpiresAt *time.Time `json:"expires_at" validate:"omitempty,gt"`
+}
+
+type MuteKeywordPayload struct {
+	Keyword   string     `json:"keyword" validate:"required,max=100"`
+	Regex     bool       `json:"regex"`
+	ExpiresAt *time.Time `json:"expires_at" validate:"omitempty,gt"`
+}
+
+// GetMutedUsers godoc
+//
+//	@Summary		Lists muted users
+//	@Description	Lists the users muted by the authenticated user, expired mutes are left out
+//	@Tags			mutes
+//	@Produce		json
+//	@Success		200	{array}		store.MutedUser
+//	@Failure		401	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/mutes/users [get]
+func (a *application) getMutedUsersHandler(w http.ResponseWriter, r *http.Request) {
+	muted, err := a.store.Mute.GetMutedUsers(r.Context(), getUserFromCtx(r).ID)
+	if err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	if err := a.jsonResponse(w, http.StatusOK, muted); err != nil {
+		a.internalServerError(w, r, err)
+	}
+}
+
+// MuteUser godoc
+//
+//	@Summary		Mutes a user
+//	@Description	Hides the posts of a user from the feed, explore and search, until expires_at or for good
+//	@Tags			mutes
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int				true	"User ID"
+//	@Param			payload	body		MuteUserPayload	false	"Mute payload"
+//	@Success		200		{object}	store.MutedUser
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/mutes/users/{userID} [put]
+func (a *application) muteUserHandler(w http.ResponseWriter, r *http.Request) {
+	mutedID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	// the body is optional, without it the mute doesn't expire
+	var payload MuteUserPayload
+	if err := readJson(w, r, &payload); err != nil && !errors.Is(err, io.EOF) {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+	if mutedID == user.ID {
+		a.badRequestResponse(w, r, errors.New("you can't mute yourself"))
+		return
+	}
+
+	muted := &store.MutedUser{
+		UserID:      user.ID,
+		MutedUserID: mutedID,
+		ExpiresAt:   payload.ExpiresAt,
+	}
+
+	if err := a.store.Mute.MuteUser(r.Context(), muted); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			a.notFoundErr(w, r, err)
+		default:
+			a.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	a.dropSuggestions(r.Context(), user.ID)
+
+	if err := a.jsonResponse(w, http.StatusOK, muted); err != nil {
+		a.internalServerError(w, r, err)
+	}
+}
+
+// UnmuteUser godoc
+//
+//	@Summary		Unmutes a user
+//	@Description	Unmutes a user
+//	@Tags			mutes
+//	@Param			userID	path	int	true	"User ID"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/mutes/users/{userID} [delete]
+func (a *application) unmuteUserHandler(w http.ResponseWriter, r *http.Request) {
+	mutedID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := a.store.Mute.UnmuteUser(r.Context(), getUserFromCtx(r).ID, mutedID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			a.notFoundErr(w, r, err)
+		default:
+			a.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetMutedKeywords godoc
+//
+//	@Summary		Lists muted keywords
+//	@Description	Lists the keywords and patterns muted by the authenticated user, expired mutes are left out
+//	@Tags			mutes
+//	@Produce		json
+//	@Success		200	{array}		store.MutedKeyword
+//	@Failure		401	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/mutes/keywords [get]
+func (a *application) getMutedKeywordsHandler(w http.ResponseWriter, r *http.Request) {
+	keywords, err := a.store.Mute.GetKeywords(r.Context(), getUserFromCtx(r).ID)
+	if err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	if err := a.jsonResponse(w, http.StatusOK, keywords); err != nil {
+		a.internalServerError(w, r, err)
+	}
+}
+
+// MuteKeyword godoc
+//
+//	@Summary		Mutes a keyword
+//	@Description	Hides posts containing a phrase, or matching a case insensitive POSIX regular expression when regex is set
+//	@Tags			mutes
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		MuteKeywordPayload	true	"Keyword payload"
+//	@Success		201		{object}	store.MutedKeyword
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/mutes/keywords [post]
+func (a *application) muteKeywordHandler(w http.ResponseWriter, r *http.Request) {
+	var payload MuteKeywordPayload
+	if err := readJson(w, r, &payload); err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	keyword := &store.MutedKeyword{
+		UserID:    getUserFromCtx(r).ID,
+		Keyword:   payload.Keyword,
+		IsRegex:   payload.Regex,
+		ExpiresAt: payload.ExpiresAt,
+	}
+
+	if err := a.store.Mute.CreateKeyword(r.Context(), keyword); err != nil {
+		switch err {
+		case store.ErrInvalidRegex:
+			a.badRequestResponse(w, r, err)
+		default:
+			a.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := a.jsonResponse(w, http.StatusCreated, keyword); err != nil {
+		a.internalServerError(w, r, err)
+	}
+}
+
+// UnmuteKeyword godoc
+//
+//	@Summary		Unmutes a keyword
+//	@Description	Unmutes a keyword
+//	@Tags			mutes
+//	@Param			keywordID	path	int	true	"Keyword ID"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/mutes/keywords/{keywordID} [delete]
+func (a *application) unmuteKeywordHandler(w http.ResponseWriter, r *http.Request) {
+	keywordID, err := strconv.ParseInt(chi.URLParam(r, "keywordID"), 10, 64)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := a.store.Mute.DeleteKeyword(r.Context(), getUserFromCtx(r).ID, keywordID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			a.notFoundErr(w, r, err)
+		default:
+			a.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
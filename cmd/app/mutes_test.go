@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMutes(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	future := time.Now().Add(time.Hour).Format(time.RFC3339)
+	past := time.Now().Add(-time.Hour).Format(time.RFC3339)
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		body   string
+		code   int
+	}{
+		{"should mute a user", http.MethodPut, "/v1/mutes/users/2", "", http.StatusOK},
+		{"should mute a user until a time", http.MethodPut, "/v1/mutes/users/2", `{"expires_at":"` + future + `"}`, http.StatusOK},
+		{"should reject an expiry in the past", http.MethodPut, "/v1/mutes/users/2", `{"expires_at":"` + past + `"}`, http.StatusBadRequest},
+		{"should not mute yourself", http.MethodPut, "/v1/mutes/users/1", "", http.StatusBadRequest},
+		{"should unmute a user", http.MethodDelete, "/v1/mutes/users/2", "", http.StatusNoContent},
+		{"should list muted users", http.MethodGet, "/v1/mutes/users", "", http.StatusOK},
+		{"should mute a keyword", http.MethodPost, "/v1/mutes/keywords", `{"keyword":"spoiler"}`, http.StatusCreated},
+		{"should mute a pattern", http.MethodPost, "/v1/mutes/keywords", `{"keyword":"^breaking","regex":true}`, http.StatusCreated},
+		{"should require a keyword", http.MethodPost, "/v1/mutes/keywords", `{"keyword":""}`, http.StatusBadRequest},
+		{"should unmute a keyword", http.MethodDelete, "/v1/mutes/keywords/1", "", http.StatusNoContent},
+		{"should list muted keywords", http.MethodGet, "/v1/mutes/keywords", "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("Authorization", "Bearer "+testToken)
+			rr := executeRequest(req, mux)
+
+			checkResponseCode(t, tt.code, rr.Code)
+		})
+	}
+
+	t.Run("should not allow unauthenticated request", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/mutes/users", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+	})
+}
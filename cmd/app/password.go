@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/ekachaikeaw/social/internal/mailer"
+	"github.com/ekachaikeaw/social/internal/store"
+	"github.com/google/uuid"
+)
+
+type ChangePasswordPayload struct {
+	CurrentPassword string `json:"current_password" validate:"required,max=72"`
+	NewPassword     string `json:"new_password" validate:"required,min=3,max=72"`
+}
+
+type ForgotPasswordPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+type ResetPasswordPayload struct {
+	Token    string `json:"token" validate:"required,max=255"`
+	Password string `json:"password" validate:"required,min=3,max=72"`
+}
+
+// changePasswordHandler godoc
+//
+//	@Summary		Changes the password
+//	@Description	Changes the password of the authenticated user. Every other session is signed out, the response carries new tokens.
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		ChangePasswordPayload	true	"Passwords"
+//	@Success		200		{object}	TokenPair				"Tokens"
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/password [put]
+func (a *application) changePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ChangePasswordPayload
+	if err := readJson(w, r, &payload); err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	c := r.Context()
+
+	// the cached user has no password hash
+	user, err := a.store.Users.GetByID(c, getUserFromCtx(r).ID)
+	if err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	if err := user.Password.Compare(payload.CurrentPassword); err != nil {
+		a.badRequestResponse(w, r, errors.New("current password is incorrect"))
+		return
+	}
+
+	if err := user.Password.Set(payload.NewPassword); err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	if err := a.store.Users.ChangePassword(c, user); err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	if a.config.redis.enable {
+		a.cacheStore.Users.Delete(c, user.ID)
+	}
+
+	// the refresh tokens were revoked with the old password
+	tokens, err := a.createTokenPair(c, user)
+	if err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	if err := a.jsonResponse(w, http.StatusOK, tokens); err != nil {
+		a.internalServerError(w, r, err)
+	}
+}
+
+// forgotPasswordHandler godoc
+//
+//	@Summary		Requests a password reset
+//	@Description	Emails a single use reset link when the address belongs to an active user. The response is the same either way.
+//	@Tags			authentication
+//	@Accept			json
+//	@Param			payload	body		ForgotPasswordPayload	true	"Email"
+//	@Success		202		{string}	string					"Accepted"
+//	@Failure		400		{object}	error
+//	@Router			/authentication/forgot-password [post]
+func (a *application) forgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ForgotPasswordPayload
+	if err := readJson(w, r, &payload); err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	// sent in the background so the response time doesn't tell whether
+	// the address has an account
+	go a.sendPasswordReset(payload.Email)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (a *application) sendPasswordReset(email string) {
+	c, cancel := context.WithTimeout(context.Background(), deliveryTimeout)
+	defer cancel()
+
+	user, err := a.store.Users.GetByEmail(c, email)
+	if err != nil {
+		if err != store.ErrNotFound {
+			a.logger.Errorw("error sending password reset", "error", err)
+		}
+		return
+	}
+
+	// hash the token to storage but plain token for email
+	plainToken := uuid.New().String()
+	hash := sha256.Sum256([]byte(plainToken))
+	hashToken := hex.EncodeToString(hash[:])
+
+	if err := a.store.Users.CreatePasswordReset(c, user.ID, hashToken, a.config.mail.resetExp); err != nil {
+		a.logger.Errorw("error sending password reset", "user_id", user.ID, "error", err)
+		return
+	}
+
+	vars := struct {
+		Username string
+		ResetURL string
+		Expiry   string
+	}{
+		Username: user.Username,
+		ResetURL: fmt.Sprintf("%s/reset-password/%s", a.config.frontedURL, plainToken),
+		Expiry:   a.config.mail.resetExp.String(),
+	}
+
+	isProdEnv := a.config.env == "production"
+	if _, err := a.mailer.Send(mailer.PasswordResetTemplate, user.Username, user.Email, vars, !isProdEnv); err != nil {
+		a.logger.Errorw("error sending password reset", "user_id", user.ID, "error", err)
+	}
+}
+
+// resetPasswordHandler godoc
+//
+//	@Summary		Resets the password
+//	@Description	Sets a new password with the token from a reset email. The token works once and every existing session is signed out.
+//	@Tags			authentication
+//	@Accept			json
+//	@Param			payload	body	ResetPasswordPayload	true	"Token and new password"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		500	{object}	error
+//	@Router			/authentication/reset-password [post]
+func (a *application) resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ResetPasswordPayload
+	if err := readJson(w, r, &payload); err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	var user store.User
+	if err := user.Password.Set(payload.Password); err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	c := r.Context()
+	if err := a.store.Users.ResetPassword(c, payload.Token, &user); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			a.badRequestResponse(w, r, errors.New("reset token is invalid or expired"))
+		default:
+			a.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if a.config.redis.enable {
+		a.cacheStore.Users.Delete(c, user.ID)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ekachaikeaw/social/internal/auth"
+	"github.com/ekachaikeaw/social/internal/mailer"
+	"github.com/ekachaikeaw/social/internal/store"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// memoryUserStore keeps one user with a real password the way the database
+// does, password_changed_at in whole seconds, and the hashed tokens the
+// handlers store for them
+type memoryUserStore struct {
+	store.MockUserStore
+	mu   sync.Mutex
+	user store.User
+
+	resetToken string
+}
+
+func newMemoryUserStore(t *testing.T, email, password string) *memoryUserStore {
+	t.Helper()
+
+	s := &memoryUserStore{user: store.User{ID: 1, Username: "gopher", Email: email}}
+	if err := s.user.Password.Set(password); err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// hasPassword reports whether password is the current one
+func (s *memoryUserStore) hasPassword(password string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.user.Password.Compare(password) == nil
+}
+
+func (s *memoryUserStore) GetByID(context.Context, int64) (*store.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.user
+	return &user, nil
+}
+
+func (s *memoryUserStore) GetByEmail(c context.Context, email string) (*store.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if email != s.user.Email {
+		return nil, store.ErrNotFound
+	}
+
+	user := s.user
+	return &user, nil
+}
+
+func (s *memoryUserStore) ChangePassword(c context.Context, u *store.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changedAt := time.Now().Truncate(time.Second)
+	u.PasswordChangedAt = &changedAt
+	s.user = *u
+	return nil
+}
+
+func (s *memoryUserStore) CreatePasswordReset(c context.Context, userID int64, token string, exp time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.resetToken = token
+	return nil
+}
+
+func (s *memoryUserStore) ResetPassword(c context.Context, token string, u *store.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.resetToken == "" || hashToken(token) != s.resetToken {
+		return store.ErrNotFound
+	}
+
+	s.resetToken = ""
+	s.user.Password = u.Password
+	u.ID = s.user.ID
+	return nil
+}
+
+// sentMail is a message handed to recordingMailer
+type sentMail struct {
+	template string
+	email    string
+	data     any
+}
+
+// recordingMailer passes the messages it is asked to send on to sent
+type recordingMailer struct {
+	sent chan sentMail
+}
+
+func newRecordingMailer() *recordingMailer {
+	return &recordingMailer{sent: make(chan sentMail, 10)}
+}
+
+func (m *recordingMailer) Send(templateFile, username, email string, data any, isSandbox bool) (int, error) {
+	m.sent <- sentMail{template: templateFile, email: email, data: data}
+	return 200, nil
+}
+
+// next waits for the next message
+func (m *recordingMailer) next(t *testing.T) sentMail {
+	t.Helper()
+
+	select {
+	case mail := <-m.sent:
+		return mail
+	case <-time.After(time.Second):
+		t.Fatal("no email was sent")
+		return sentMail{}
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	app := newTestApplication(t, config{frontedURL: "http://localhost:5173"})
+	users := newMemoryUserStore(t, "gopher@example.com", "password")
+	app.store.Users = users
+	mail := newRecordingMailer()
+	app.mailer = mail
+	mux := app.mount()
+
+	request := func(url, body string) int {
+		req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return executeRequest(req, mux).Code
+	}
+
+	t.Run("should answer the same for unknown addresses", func(t *testing.T) {
+		checkResponseCode(t, http.StatusAccepted, request("/v1/authentication/forgot-password", `{"email":"nobody@example.com"}`))
+		checkResponseCode(t, http.StatusBadRequest, request("/v1/authentication/forgot-password", `{"email":"gopher"}`))
+	})
+
+	var token string
+	t.Run("should email a link carrying the stored token", func(t *testing.T) {
+		checkResponseCode(t, http.StatusAccepted, request("/v1/authentication/forgot-password", `{"email":"gopher@example.com"}`))
+
+		sent := mail.next(t)
+		if sent.template != mailer.PasswordResetTemplate || sent.email != "gopher@example.com" {
+			t.Fatalf("unexpected email %+v", sent)
+		}
+
+		url := sent.data.(struct {
+			Username string
+			ResetURL string
+			Expiry   string
+		}).ResetURL
+		token = strings.TrimPrefix(url, "http://localhost:5173/reset-password/")
+		if hashToken(token) != users.resetToken {
+			t.Errorf("the link %s doesn't match the stored token", url)
+		}
+	})
+
+	t.Run("should not reset with an unknown token", func(t *testing.T) {
+		checkResponseCode(t, http.StatusBadRequest, request("/v1/authentication/reset-password", `{"token":"unknown","password":"secret"}`))
+		if !users.hasPassword("password") {
+			t.Error("expected the password unchanged")
+		}
+	})
+
+	t.Run("should reset the password once", func(t *testing.T) {
+		body := `{"token":"` + token + `","password":"secret"}`
+
+		checkResponseCode(t, http.StatusNoContent, request("/v1/authentication/reset-password", body))
+		if !users.hasPassword("secret") {
+			t.Error("expected the new password")
+		}
+
+		checkResponseCode(t, http.StatusBadRequest, request("/v1/authentication/reset-password", body))
+	})
+}
+
+func TestChangePasswordSessions(t *testing.T) {
+	app := newTestApplication(t, config{
+		auth: authConfig{token: tokenConfig{exp: time.Hour, iss: "test-aud"}},
+	})
+	app.authenticator = auth.NewJWTAuthenticator("test", "test-aud", "test-aud")
+
+	users := newMemoryUserStore(t, "gopher@example.com", "password")
+	app.store.Users = users
+	mux := app.mount()
+
+	// a session started before the change
+	oldToken, err := app.authenticator.GenerateToken(jwt.MapClaims{
+		"jti": "old-session",
+		"sub": int64(1),
+		"iat": time.Now().Add(-2 * time.Second).Unix(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"iss": "test-aud",
+		"aud": "test-aud",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(method, url, token, body string) *http.Response {
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return executeRequest(req, mux).Result()
+	}
+
+	t.Run("should require the current password", func(t *testing.T) {
+		res := request(http.MethodPut, "/v1/users/me/password", oldToken, `{"current_password":"wrong","new_password":"secret"}`)
+		checkResponseCode(t, http.StatusBadRequest, res.StatusCode)
+
+		res = request(http.MethodPut, "/v1/users/me/password", "", `{"current_password":"password","new_password":"secret"}`)
+		checkResponseCode(t, http.StatusUnauthorized, res.StatusCode)
+
+		if !users.hasPassword("password") {
+			t.Error("expected the password unchanged")
+		}
+	})
+
+	res := request(http.MethodPut, "/v1/users/me/password", oldToken, `{"current_password":"password","new_password":"secret"}`)
+	checkResponseCode(t, http.StatusOK, res.StatusCode)
+	if !users.hasPassword("secret") {
+		t.Error("expected the new password")
+	}
+
+	var body struct {
+		Data TokenPair `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should accept the token returned by the change", func(t *testing.T) {
+		res := request(http.MethodGet, "/v1/users/suggestions", body.Data.AccessToken, "")
+		checkResponseCode(t, http.StatusOK, res.StatusCode)
+	})
+
+	t.Run("should refuse the tokens issued before the change", func(t *testing.T) {
+		res := request(http.MethodGet, "/v1/users/suggestions", oldToken, "")
+		checkResponseCode(t, http.StatusUnauthorized, res.StatusCode)
+	})
+}
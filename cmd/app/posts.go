@@ -59,7 +59,7 @@ func (a *application) createPostHandler(w http.ResponseWriter, r *http.Request)
 		UserID:  user.ID,
 	}
 
-	if err := a.store.Posts.Create(ctx, post); err != nil {
+	if err := a.createPost(ctx, post); err != nil {
 		a.internalServerError(w, r, err)
 		return
 	}
@@ -86,7 +86,7 @@ func (a *application) createPostHandler(w http.ResponseWriter, r *http.Request)
 func (a *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 	post := getPostFromCtx(r)
 
-	comments, err := a.store.Comment.GetByPostID(r.Context(), post.ID)
+	comments, err := a.store.Comment.GetByPostID(r.Context(), post.ID, getUserFromCtx(r).ID)
 	if err != nil {
 		a.internalServerError(w, r, err)
 		return
@@ -94,6 +94,10 @@ func (a *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 
 	post.Comments = comments
 
+	if err := a.store.Posts.IncrementViews(r.Context(), post.ID); err != nil {
+		a.logger.Errorw("error counting post view", "post_id", post.ID, "error", err)
+	}
+
 	if err := a.jsonResponse(w, http.StatusOK, post); err != nil {
 		a.internalServerError(w, r, err)
 		return
@@ -212,6 +216,17 @@ func (a *application) postsContextMiddleware(next http.Handler) http.Handler {
 			}
 		}
 
+		// posts of private accounts don't exist for non followers
+		visible, err := a.store.Follower.CanSee(ctx, getUserFromCtx(r).ID, post.UserID)
+		if err != nil && err != store.ErrNotFound {
+			a.internalServerError(w, r, err)
+			return
+		}
+		if !visible {
+			a.notFoundErr(w, r, store.ErrNotFound)
+			return
+		}
+
 		ctx = context.WithValue(ctx, postKey{}, post)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/ekachaikeaw/social/internal/store"
+)
+
+// avatarMaxSize is the largest avatar accepted, in bytes
+const avatarMaxSize = 2 << 20
+
+// avatarTypes maps the accepted image types to their file extensions
+var avatarTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+type UpdateProfilePayload struct {
+	DisplayName *string `json:"display_name" validate:"omitempty,max=50"`
+	Bio         *string `json:"bio" validate:"omitempty,max=500"`
+	Location    *string `json:"location" validate:"omitempty,max=100"`
+	Website     *string `json:"website" validate:"omitempty,max=255,http_url|eq="`
+	IsPrivate   *bool   `json:"is_private"`
+}
+
+// UpdateProfile godoc
+//
+//	@Summary		Updates the profile
+//	@Description	Updates the profile of the authenticated user, fields left out are kept
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		UpdateProfilePayload	true	"Profile payload"
+//	@Success		200		{object}	store.User
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me [patch]
+func (a *application) updateProfileHandler(w http.ResponseWriter, r *http.Request) {
+	var payload UpdateProfilePayload
+	if err := readJson(w, r, &payload); err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := *getUserFromCtx(r)
+	if payload.DisplayName != nil {
+		user.DisplayName = *payload.DisplayName
+	}
+	if payload.Bio != nil {
+		user.Bio = *payload.Bio
+	}
+	if payload.Location != nil {
+		user.Location = *payload.Location
+	}
+	if payload.Website != nil {
+		user.Website = *payload.Website
+	}
+	if payload.IsPrivate != nil {
+		user.IsPrivate = *payload.IsPrivate
+	}
+
+	if err := a.updateProfile(r, &user); err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	if err := a.jsonResponse(w, http.StatusOK, user); err != nil {
+		a.internalServerError(w, r, err)
+	}
+}
+
+// UploadAvatar godoc
+//
+//	@Summary		Uploads an avatar
+//	@Description	Replaces the avatar of the authenticated user with a PNG, JPEG, GIF or WebP image of up to 2MB
+//	@Tags			users
+//	@Accept			multipart/form-data
+//	@Produce		json
+//	@Param			avatar	formData	file	true	"Avatar image"
+//	@Success		200		{object}	store.User
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/avatar [put]
+func (a *application) uploadAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	// leave room for the multipart framing around the file
+	r.Body = http.MaxBytesReader(w, r.Body, avatarMaxSize+4096)
+
+	file, header, err := r.FormFile("avatar")
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+	defer file.Close()
+
+	if header.Size > avatarMaxSize {
+		a.badRequestResponse(w, r, errors.New("avatar must be at most 2MB"))
+		return
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	ext, ok := avatarTypes[http.DetectContentType(head[:n])]
+	if !ok {
+		a.badRequestResponse(w, r, errors.New("avatar must be a png, jpeg, gif or webp image"))
+		return
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	user := *getUserFromCtx(r)
+	previous := user.AvatarURL
+
+	// a new name each time so clients and proxies don't keep the old image
+	name := fmt.Sprintf("avatar-%d-%d%s", user.ID, time.Now().UnixNano(), ext)
+	user.AvatarURL, err = a.media.Put(r.Context(), name, file)
+	if err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	if err := a.updateProfile(r, &user); err != nil {
+		a.media.Delete(r.Context(), user.AvatarURL)
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	if previous != "" {
+		if err := a.media.Delete(r.Context(), previous); err != nil {
+			a.logger.Errorw("error deleting previous avatar", "user_id", user.ID, "error", err)
+		}
+	}
+
+	if err := a.jsonResponse(w, http.StatusOK, user); err != nil {
+		a.internalServerError(w, r, err)
+	}
+}
+
+// updateProfile saves the profile and drops the cached user so the next
+// request sees the change. Follow requests approved by going public are
+// handled like approvals one by one.
+func (a *application) updateProfile(r *http.Request, user *store.User) error {
+	c := r.Context()
+
+	approved, err := a.store.Users.UpdateProfile(c, user)
+	if err != nil {
+		return err
+	}
+
+	if a.config.redis.enable {
+		a.cacheStore.Users.Delete(c, user.ID)
+	}
+
+	for _, followerID := range approved {
+		if a.fanoutEnabled() {
+			a.backfillTimeline(c, followerID, user.ID)
+		}
+
+		a.notify(c, followerID, notification{Kind: "follow_approved", UserID: user.ID})
+	}
+
+	return nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ekachaikeaw/social/internal/store"
+)
+
+func TestUpdateProfile(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{"should update the profile", `{"display_name":"Gopher","bio":"hi","website":"https://go.dev"}`, http.StatusOK},
+		{"should clear the website", `{"website":""}`, http.StatusOK},
+		{"should make the account private", `{"is_private":true}`, http.StatusOK},
+		{"should reject an invalid website", `{"website":"not a url"}`, http.StatusBadRequest},
+		{"should reject a long display name", `{"display_name":"` + strings.Repeat("a", 51) + `"}`, http.StatusBadRequest},
+		{"should reject unknown fields", `{"email":"a@b.c"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPatch, "/v1/users/me", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("Authorization", "Bearer "+testToken)
+			rr := executeRequest(req, mux)
+
+			checkResponseCode(t, tt.code, rr.Code)
+		})
+	}
+}
+
+// publicUserStore approves the pending request of user 2 when the profile
+// is saved public
+type publicUserStore struct {
+	store.MockUserStore
+}
+
+func (s *publicUserStore) UpdateProfile(c context.Context, u *store.User) ([]int64, error) {
+	if u.IsPrivate {
+		return []int64{}, nil
+	}
+	return []int64{2}, nil
+}
+
+func TestGoPublic(t *testing.T) {
+	app := newTestApplication(t, config{})
+	app.store.Users = &publicUserStore{}
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub, err := app.broker.Subscribe(context.Background(), notificationsTopic(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	req, err := http.NewRequest(http.MethodPatch, "/v1/users/me", strings.NewReader(`{"is_private":false}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	checkResponseCode(t, http.StatusOK, executeRequest(req, mux).Code)
+
+	select {
+	case e := <-sub.C:
+		var n notification
+		if err := json.Unmarshal(e.Data, &n); err != nil {
+			t.Fatal(err)
+		}
+		if n.Kind != "follow_approved" || n.UserID != 1 {
+			t.Errorf("unexpected notification %+v", n)
+		}
+	case <-time.After(time.Second):
+		t.Error("expected the approved follower notified")
+	}
+}
+
+func TestUploadAvatar(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upload := func(t *testing.T, content []byte) *http.Request {
+		t.Helper()
+
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		fw, err := mw.CreateFormFile("avatar", "avatar")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(content)
+		mw.Close()
+
+		req, err := http.NewRequest(http.MethodPut, "/v1/users/me/avatar", &body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		return req
+	}
+
+	t.Run("should store and serve an image", func(t *testing.T) {
+		var img bytes.Buffer
+		if err := png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 8, 8))); err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(upload(t, img.Bytes()), mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		var resp struct {
+			Data store.User `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		path := strings.TrimPrefix(resp.Data.AvatarURL, "http://localhost:8080")
+		if !strings.HasSuffix(path, ".png") {
+			t.Fatalf("unexpected avatar url %s", resp.Data.AvatarURL)
+		}
+
+		req, err := http.NewRequest(http.MethodGet, path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr = executeRequest(req, mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		if ct := rr.Header().Get("Content-Type"); ct != "image/png" {
+			t.Errorf("expected content type image/png. Got %s", ct)
+		}
+	})
+
+	t.Run("should reject files that aren't images", func(t *testing.T) {
+		rr := executeRequest(upload(t, []byte("<html><script></script></html>")), mux)
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("should reject large files", func(t *testing.T) {
+		content := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, avatarMaxSize+1)...)
+
+		rr := executeRequest(upload(t, content), mux)
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+}
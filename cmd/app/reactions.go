@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/ekachaikeaw/social/internal/store"
+)
+
+type ReactionPayload struct {
+	Reaction string `json:"reaction" validate:"required,oneof=like love laugh wow sad angry"`
+}
+
+// ReactToPost godoc
+//
+//	@Summary		Reacts to a post
+//	@Description	Adds or replaces the reaction of the user to a post
+//	@Tags			posts
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int				true	"Post ID"
+//	@Param			payload	body		ReactionPayload	true	"Reaction payload"
+//	@Success		200		{object}	store.Reaction
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/reactions [put]
+func (a *application) reactToPostHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ReactionPayload
+	if err := readJson(w, r, &payload); err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	post := getPostFromCtx(r)
+	reaction := &store.Reaction{
+		PostID:   post.ID,
+		UserID:   getUserFromCtx(r).ID,
+		Reaction: payload.Reaction,
+	}
+
+	if err := a.store.Reaction.Upsert(r.Context(), reaction); err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	if post.UserID != reaction.UserID {
+		a.notify(r.Context(), post.UserID, notification{
+			Kind:     "reaction",
+			UserID:   reaction.UserID,
+			PostID:   post.ID,
+			Reaction: reaction.Reaction,
+		})
+	}
+
+	if err := a.jsonResponse(w, http.StatusOK, reaction); err != nil {
+		a.internalServerError(w, r, err)
+	}
+}
+
+// DeleteReaction godoc
+//
+//	@Summary		Removes a reaction
+//	@Description	Removes the reaction of the user to a post
+//	@Tags			posts
+//	@Produce		json
+//	@Param			id	path		int	true	"Post ID"
+//	@Success		204	{string}	string	"Reaction removed"
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/reactions [delete]
+func (a *application) deleteReactionHandler(w http.ResponseWriter, r *http.Request) {
+	err := a.store.Reaction.Delete(r.Context(), getPostFromCtx(r).ID, getUserFromCtx(r).ID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			a.notFoundErr(w, r, err)
+		default:
+			a.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
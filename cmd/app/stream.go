@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ekachaikeaw/social/internal/store"
+	"github.com/ekachaikeaw/social/internal/stream"
+)
+
+// streamReplayLimit caps the posts sent to a client resuming a stream, a
+// client that missed more than that reloads its feed instead
+const streamReplayLimit = 100
+
+// streamBuffer is the number of events held for a slow client before its
+// stream is closed
+const streamBuffer = 64
+
+// streamRetry tells clients how long to wait before reconnecting
+const streamRetry = time.Second * 3
+
+// streamFeedHandler godoc
+//
+//	@Summary		Streams the user feed
+//	@Description	Pushes new posts from followed users as server-sent events. Send Last-Event-ID to resume after a disconnect.
+//	@Tags			feed
+//	@Produce		text/event-stream
+//	@Param			Last-Event-ID	header		string	false	"ID of the last received event"
+//	@Success		200				{string}	string	"Event stream"
+//	@Failure		400				{object}	error
+//	@Failure		401				{object}	error
+//	@Failure		500				{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/feed/stream [get]
+func (app *application) streamFeedHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+	c := r.Context()
+
+	var lastID int64
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		var err error
+		lastID, err = strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, errors.New("invalid Last-Event-ID"))
+			return
+		}
+	}
+
+	rc := http.NewResponseController(w)
+
+	// the stream stays open past the server write timeout
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// subscribe before replaying so posts created in between aren't lost
+	sub, err := app.broker.Subscribe(c, feedTopic(user.ID))
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	defer sub.Close()
+
+	var missed []store.Post
+	if lastID > 0 {
+		missed, err = app.store.Posts.GetFollowedSince(c, user.ID, lastID, streamReplayLimit)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetry.Milliseconds())
+
+	for _, p := range missed {
+		e, err := postEvent(p)
+		if err != nil {
+			app.logger.Errorw("error replaying stream", "user_id", user.ID, "error", err)
+			return
+		}
+
+		writeEvent(w, e)
+		lastID = p.ID
+	}
+
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(app.config.stream.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Done():
+			return
+		case e, ok := <-sub.C:
+			// closed on shutdown or when the client lags behind, it
+			// reconnects and resumes from its last event id
+			if !ok {
+				return
+			}
+
+			if id, _ := strconv.ParseInt(e.ID, 10, 64); id <= lastID {
+				continue
+			}
+
+			writeEvent(w, e)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// publishPost pushes a new post to the streams of the author's followers,
+// except those who muted the author or a keyword of the post
+func (app *application) publishPost(c context.Context, post *store.Post, followers []int64) {
+	if len(followers) == 0 {
+		return
+	}
+
+	followers, err := app.store.Mute.GetNotMuting(c, post.ID, followers)
+	if err != nil {
+		app.logger.Errorw("error publishing post", "post_id", post.ID, "error", err)
+		return
+	}
+	if len(followers) == 0 {
+		return
+	}
+
+	e, err := postEvent(*post)
+	if err != nil {
+		app.logger.Errorw("error publishing post", "post_id", post.ID, "error", err)
+		return
+	}
+
+	topics := make([]string, 0, len(followers))
+	for _, id := range followers {
+		topics = append(topics, feedTopic(id))
+	}
+
+	if err := app.broker.Publish(c, e, topics...); err != nil {
+		app.logger.Errorw("error publishing post", "post_id", post.ID, "error", err)
+	}
+}
+
+func postEvent(p store.Post) (stream.Event, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return stream.Event{}, err
+	}
+
+	return stream.Event{ID: strconv.FormatInt(p.ID, 10), Type: "post", Data: data}, nil
+}
+
+// writeEvent writes e in the text/event-stream format, data is single
+// line JSON
+func writeEvent(w io.Writer, e stream.Event) {
+	fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", e.ID, e.Type, e.Data)
+}
+
+func feedTopic(userID int64) string {
+	return fmt.Sprintf("feed-%d", userID)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ekachaikeaw/social/internal/store"
+)
+
+// mutingStore mutes post 8 for every follower
+type mutingStore struct {
+	store.MockMuteStore
+}
+
+func (s *mutingStore) GetNotMuting(c context.Context, postID int64, userIDs []int64) ([]int64, error) {
+	if postID == 8 {
+		return []int64{}, nil
+	}
+	return userIDs, nil
+}
+
+func TestStreamFeed(t *testing.T) {
+	cfg := config{
+		stream: streamConfig{
+			heartbeat: time.Millisecond * 50,
+		},
+	}
+	app := newTestApplication(t, cfg)
+	app.store.Mute = &mutingStore{}
+	ts := httptest.NewServer(app.mount())
+	defer ts.Close()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	open := func(t *testing.T, lastEventID string) *http.Response {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/v1/users/feed/stream", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Accept", "text/event-stream")
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+
+		return resp
+	}
+
+	// readUntil returns the first line with prefix, failing after a second
+	readUntil := func(t *testing.T, lines <-chan string, prefix string) string {
+		t.Helper()
+
+		timeout := time.After(time.Second)
+		for {
+			select {
+			case line, ok := <-lines:
+				if !ok {
+					t.Fatalf("stream closed before %q", prefix)
+				}
+				if strings.HasPrefix(line, prefix) {
+					return line
+				}
+			case <-timeout:
+				t.Fatalf("timed out waiting for %q", prefix)
+			}
+		}
+	}
+
+	scan := func(body io.Reader) <-chan string {
+		lines := make(chan string)
+		go func() {
+			defer close(lines)
+
+			s := bufio.NewScanner(body)
+			for s.Scan() {
+				lines <- s.Text()
+			}
+		}()
+
+		return lines
+	}
+
+	t.Run("should not allow unauthenticated requests", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/v1/users/feed/stream", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		checkResponseCode(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("should reject a malformed Last-Event-ID", func(t *testing.T) {
+		resp := open(t, "abc")
+		checkResponseCode(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("should push posts and heartbeats until shutdown", func(t *testing.T) {
+		resp := open(t, "")
+		checkResponseCode(t, http.StatusOK, resp.StatusCode)
+
+		if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Errorf("expected content type text/event-stream. Got %s", ct)
+		}
+
+		lines := scan(resp.Body)
+		readUntil(t, lines, "retry:")
+
+		// the mock token is the one of user 1
+		app.publishPost(context.Background(), &store.Post{ID: 7, Title: "hello"}, []int64{1})
+
+		if id := readUntil(t, lines, "id:"); id != "id: 7" {
+			t.Errorf("expected id: 7. Got %s", id)
+		}
+		if data := readUntil(t, lines, "data:"); !strings.Contains(data, `"title":"hello"`) {
+			t.Errorf("unexpected data %s", data)
+		}
+
+		// post 8 is muted, the next event is post 9
+		app.publishPost(context.Background(), &store.Post{ID: 8, Title: "muted"}, []int64{1})
+		app.publishPost(context.Background(), &store.Post{ID: 9, Title: "shown"}, []int64{1})
+		if id := readUntil(t, lines, "id:"); id != "id: 9" {
+			t.Errorf("expected the muted post skipped. Got %s", id)
+		}
+
+		readUntil(t, lines, ": heartbeat")
+
+		app.broker.Close()
+
+		timeout := time.After(time.Second)
+		for {
+			select {
+			case _, ok := <-lines:
+				if !ok {
+					return
+				}
+			case <-timeout:
+				t.Fatal("stream not closed by the broker")
+			}
+		}
+	})
+}
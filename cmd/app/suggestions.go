@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/ekachaikeaw/social/internal/store"
+)
+
+// maxSuggestions is the number of accounts ranked and cached per user, the
+// limit parameter only trims it
+const maxSuggestions = 50
+
+// getSuggestionsHandler godoc
+//
+//	@Summary		Suggests users to follow
+//	@Description	Ranks users the caller doesn't follow by mutual connections, tags shared in recent posts and popularity. Blocked and muted users are left out.
+//	@Tags			users
+//	@Produce		json
+//	@Param			limit	query		int	false	"Limit, 1 to 50, defaults to 10"
+//	@Success		200		{object}	[]store.SuggestedUser
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/suggestions [get]
+func (a *application) getSuggestionsHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 10
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil {
+			a.badRequestResponse(w, r, err)
+			return
+		}
+		if n < 1 || n > maxSuggestions {
+			a.badRequestResponse(w, r, errors.New("limit must be between 1 and 50"))
+			return
+		}
+		limit = n
+	}
+
+	users, err := a.getSuggestions(r.Context(), getUserFromCtx(r).ID)
+	if err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	if len(users) > limit {
+		users = users[:limit]
+	}
+
+	if err := a.jsonResponse(w, http.StatusOK, users); err != nil {
+		a.internalServerError(w, r, err)
+	}
+}
+
+func (a *application) getSuggestions(c context.Context, userID int64) ([]store.SuggestedUser, error) {
+	if !a.config.redis.enable {
+		return a.store.Follower.GetSuggestions(c, userID, maxSuggestions)
+	}
+
+	users, err := a.cacheStore.Suggestions.Get(c, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if users == nil {
+		users, err = a.store.Follower.GetSuggestions(c, userID, maxSuggestions)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := a.cacheStore.Suggestions.Set(c, userID, users); err != nil {
+			return nil, err
+		}
+	}
+
+	return users, nil
+}
+
+// dropSuggestions forgets the cached suggestions of userID once they went
+// stale, after following, unfollowing, blocking or muting someone
+func (a *application) dropSuggestions(c context.Context, userID int64) {
+	if a.config.redis.enable {
+		a.cacheStore.Suggestions.Delete(c, userID)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/ekachaikeaw/social/internal/store"
+)
+
+// rankedFollowerStore suggests users 100 to 114 in that order and counts
+// the rankings it ran
+type rankedFollowerStore struct {
+	store.MockFollowerStore
+	rankings int
+}
+
+func (s *rankedFollowerStore) GetSuggestions(c context.Context, userID int64, limit int) ([]store.SuggestedUser, error) {
+	s.rankings++
+
+	users := []store.SuggestedUser{}
+	for id := int64(100); id < 115 && len(users) < limit; id++ {
+		users = append(users, store.SuggestedUser{ID: id})
+	}
+	return users, nil
+}
+
+// memorySuggestionCache is a suggestion cache in a map
+type memorySuggestionCache struct {
+	users map[int64][]store.SuggestedUser
+}
+
+func newMemorySuggestionCache() *memorySuggestionCache {
+	return &memorySuggestionCache{users: make(map[int64][]store.SuggestedUser)}
+}
+
+func (s *memorySuggestionCache) Get(c context.Context, userID int64) ([]store.SuggestedUser, error) {
+	return s.users[userID], nil
+}
+
+func (s *memorySuggestionCache) Set(c context.Context, userID int64, users []store.SuggestedUser) error {
+	s.users[userID] = users
+	return nil
+}
+
+func (s *memorySuggestionCache) Delete(c context.Context, userID int64) {
+	delete(s.users, userID)
+}
+
+func TestGetSuggestions(t *testing.T) {
+	app := newTestApplication(t, config{redis: redisConfig{enable: true}})
+	follower := &rankedFollowerStore{}
+	app.store.Follower = follower
+	app.cacheStore.Suggestions = newMemorySuggestionCache()
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(url string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		return executeRequest(req, mux).Result()
+	}
+
+	tests := []struct {
+		name string
+		url  string
+		want []int64
+	}{
+		{"should return ten by default", "/v1/users/suggestions", []int64{100, 101, 102, 103, 104, 105, 106, 107, 108, 109}},
+		{"should keep the top of the ranking", "/v1/users/suggestions?limit=3", []int64{100, 101, 102}},
+		{"should return what there is", "/v1/users/suggestions?limit=50", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := request(tt.url)
+			checkResponseCode(t, http.StatusOK, res.StatusCode)
+
+			var body struct {
+				Data []store.SuggestedUser `json:"data"`
+			}
+			if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.want == nil {
+				if len(body.Data) != 15 {
+					t.Errorf("expected all 15 suggestions, got %d", len(body.Data))
+				}
+				return
+			}
+			if len(body.Data) != len(tt.want) {
+				t.Fatalf("expected %d suggestions, got %d", len(tt.want), len(body.Data))
+			}
+			for i, u := range body.Data {
+				if u.ID != tt.want[i] {
+					t.Errorf("suggestion %d is user %d, want %d", i, u.ID, tt.want[i])
+				}
+			}
+		})
+	}
+
+	t.Run("should rank once and serve the rest from the cache", func(t *testing.T) {
+		if follower.rankings != 1 {
+			t.Errorf("expected one ranking, got %d", follower.rankings)
+		}
+	})
+
+	t.Run("should reject invalid limits", func(t *testing.T) {
+		for _, url := range []string{"/v1/users/suggestions?limit=51", "/v1/users/suggestions?limit=0", "/v1/users/suggestions?limit=gopher"} {
+			checkResponseCode(t, http.StatusBadRequest, request(url).StatusCode)
+		}
+	})
+
+	t.Run("should not suggest users unauthenticated", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/suggestions", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkResponseCode(t, http.StatusUnauthorized, executeRequest(req, mux).Code)
+	})
+}
+
+func TestSuggestionsDropped(t *testing.T) {
+	app := newTestApplication(t, config{redis: redisConfig{enable: true}})
+	app.cacheStore.Users = &recordingUserCache{}
+	suggestions := newMemorySuggestionCache()
+	app.cacheStore.Suggestions = suggestions
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		url     string
+		dropped []int64
+	}{
+		{"should drop both users on a block", http.MethodPut, "/v1/blocks/2", []int64{1, 2}},
+		{"should drop the follower on a follow", http.MethodPut, "/v1/users/2/follow", []int64{1}},
+		{"should drop the follower on an unfollow", http.MethodPut, "/v1/users/2/unfollow", []int64{1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, id := range []int64{1, 2, 3} {
+				suggestions.users[id] = []store.SuggestedUser{{ID: 100}}
+			}
+
+			req, err := http.NewRequest(tt.method, tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+testToken)
+			rr := executeRequest(req, mux)
+			if rr.Code >= 300 {
+				t.Fatalf("unexpected status %d", rr.Code)
+			}
+
+			for _, id := range []int64{1, 2, 3} {
+				_, cached := suggestions.users[id]
+				if dropped := slices.Contains(tt.dropped, id); cached == dropped {
+					t.Errorf("user %d: cached %v, want %v", id, cached, !dropped)
+				}
+			}
+		})
+	}
+}
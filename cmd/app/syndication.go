@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ekachaikeaw/social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// syndicationLimit is the number of posts listed in RSS and Atom feeds
+const syndicationLimit = 50
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Published string      `xml:"published"`
+	Updated   string      `xml:"updated"`
+	Link      atomLink    `xml:"link"`
+	Author    atomAuthor  `xml:"author"`
+	Content   atomContent `xml:"content"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+	Description string  `xml:"description"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// syndication is the format independent content of a feed
+type syndication struct {
+	title string
+	link  string
+	self  string
+	posts []store.Post
+}
+
+// getUserAtomFeedHandler godoc
+//
+//	@Summary		Atom feed of a user
+//	@Description	Atom feed of the latest public posts of a user
+//	@Tags			feed
+//	@Produce		xml
+//	@Param			userID	path		int		true	"User ID"
+//	@Success		200		{string}	string	"Atom feed"
+//	@Success		304		{string}	string	"Not modified"
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/users/{userID}/feed.atom [get]
+func (a *application) getUserAtomFeedHandler(w http.ResponseWriter, r *http.Request) {
+	feed, err := a.userSyndication(r)
+	if err != nil {
+		a.syndicationError(w, r, err)
+		return
+	}
+
+	a.writeAtom(w, r, feed)
+}
+
+// getUserRSSFeedHandler godoc
+//
+//	@Summary		RSS feed of a user
+//	@Description	RSS feed of the latest public posts of a user
+//	@Tags			feed
+//	@Produce		xml
+//	@Param			userID	path		int		true	"User ID"
+//	@Success		200		{string}	string	"RSS feed"
+//	@Success		304		{string}	string	"Not modified"
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/users/{userID}/feed.rss [get]
+func (a *application) getUserRSSFeedHandler(w http.ResponseWriter, r *http.Request) {
+	feed, err := a.userSyndication(r)
+	if err != nil {
+		a.syndicationError(w, r, err)
+		return
+	}
+
+	a.writeRSS(w, r, feed)
+}
+
+// getTagAtomFeedHandler godoc
+//
+//	@Summary		Atom feed of a tag
+//	@Description	Atom feed of the latest public posts with a tag
+//	@Tags			feed
+//	@Produce		xml
+//	@Param			tag	path		string	true	"Tag"
+//	@Success		200	{string}	string	"Atom feed"
+//	@Success		304	{string}	string	"Not modified"
+//	@Failure		500	{object}	error
+//	@Router			/tags/{tag}/feed.atom [get]
+func (a *application) getTagAtomFeedHandler(w http.ResponseWriter, r *http.Request) {
+	feed, err := a.tagSyndication(r)
+	if err != nil {
+		a.syndicationError(w, r, err)
+		return
+	}
+
+	a.writeAtom(w, r, feed)
+}
+
+// getTagRSSFeedHandler godoc
+//
+//	@Summary		RSS feed of a tag
+//	@Description	RSS feed of the latest public posts with a tag
+//	@Tags			feed
+//	@Produce		xml
+//	@Param			tag	path		string	true	"Tag"
+//	@Success		200	{string}	string	"RSS feed"
+//	@Success		304	{string}	string	"Not modified"
+//	@Failure		500	{object}	error
+//	@Router			/tags/{tag}/feed.rss [get]
+func (a *application) getTagRSSFeedHandler(w http.ResponseWriter, r *http.Request) {
+	feed, err := a.tagSyndication(r)
+	if err != nil {
+		a.syndicationError(w, r, err)
+		return
+	}
+
+	a.writeRSS(w, r, feed)
+}
+
+func (a *application) userSyndication(r *http.Request) (*syndication, error) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		return nil, store.ErrNotFound
+	}
+
+	c := r.Context()
+	user, err := a.store.Users.GetByID(c, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// feeds are public, private accounts have none
+	if user.IsPrivate {
+		return nil, store.ErrNotFound
+	}
+
+	posts, err := a.store.Posts.GetByUserID(c, user.ID, syndicationLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range posts {
+		posts[i].User.Username = user.Username
+	}
+
+	return &syndication{
+		title: fmt.Sprintf("%s on GopherSocial", user.Username),
+		link:  fmt.Sprintf("%s/users/%d", a.config.frontedURL, user.ID),
+		self:  requestURL(r),
+		posts: posts,
+	}, nil
+}
+
+func (a *application) tagSyndication(r *http.Request) (*syndication, error) {
+	tag := chi.URLParam(r, "tag")
+
+	posts, err := a.store.Posts.GetByTag(r.Context(), tag, syndicationLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &syndication{
+		title: fmt.Sprintf("#%s on GopherSocial", tag),
+		link:  fmt.Sprintf("%s/tags/%s", a.config.frontedURL, tag),
+		self:  requestURL(r),
+		posts: posts,
+	}, nil
+}
+
+func (a *application) writeAtom(w http.ResponseWriter, r *http.Request, s *syndication) {
+	updated := s.updated()
+
+	feed := atomFeed{
+		ID:      s.self,
+		Title:   s.title,
+		Updated: updated.Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: s.self, Rel: "self", Type: "application/atom+xml"},
+			{Href: s.link, Rel: "alternate", Type: "text/html"},
+		},
+	}
+
+	for _, p := range s.posts {
+		link := a.postURL(p)
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:        link,
+			Title:     p.Title,
+			Published: formatPostTime(p.CreatedAt, time.RFC3339),
+			Updated:   formatPostTime(p.UpdatedAt, time.RFC3339),
+			Link:      atomLink{Href: link, Rel: "alternate", Type: "text/html"},
+			Author:    atomAuthor{Name: p.User.Username},
+			Content:   atomContent{Type: "text", Body: p.Content},
+		})
+	}
+
+	a.writeSyndication(w, r, "application/atom+xml; charset=utf-8", updated, feed)
+}
+
+func (a *application) writeRSS(w http.ResponseWriter, r *http.Request, s *syndication) {
+	updated := s.updated()
+
+	feed := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:         s.title,
+			Link:          s.link,
+			Description:   s.title,
+			LastBuildDate: updated.Format(time.RFC1123Z),
+		},
+	}
+
+	for _, p := range s.posts {
+		link := a.postURL(p)
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       p.Title,
+			Link:        link,
+			GUID:        rssGUID{IsPermaLink: true, Value: link},
+			PubDate:     formatPostTime(p.CreatedAt, time.RFC1123Z),
+			Description: p.Content,
+		})
+	}
+
+	a.writeSyndication(w, r, "application/rss+xml; charset=utf-8", updated, feed)
+}
+
+// writeSyndication renders the feed and lets http.ServeContent answer
+// conditional requests from the ETag and Last-Modified headers
+func (a *application) writeSyndication(w http.ResponseWriter, r *http.Request, contentType string, updated time.Time, feed any) {
+	body := bytes.NewBufferString(xml.Header)
+	if err := xml.NewEncoder(body).Encode(feed); err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	hash := sha256.Sum256(body.Bytes())
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(hash[:16])+`"`)
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	http.ServeContent(w, r, "", updated, bytes.NewReader(body.Bytes()))
+}
+
+func (a *application) syndicationError(w http.ResponseWriter, r *http.Request, err error) {
+	switch err {
+	case store.ErrNotFound:
+		a.notFoundErr(w, r, err)
+	default:
+		a.internalServerError(w, r, err)
+	}
+}
+
+func (a *application) postURL(p store.Post) string {
+	return fmt.Sprintf("%s/posts/%d", a.config.frontedURL, p.ID)
+}
+
+// updated is the time of the latest change to any post in the feed
+func (s *syndication) updated() time.Time {
+	var updated time.Time
+	for _, p := range s.posts {
+		for _, v := range []string{p.CreatedAt, p.UpdatedAt} {
+			if t, err := time.Parse(time.RFC3339Nano, v); err == nil && t.After(updated) {
+				updated = t
+			}
+		}
+	}
+
+	if updated.IsZero() {
+		return time.Unix(0, 0).UTC()
+	}
+
+	return updated.UTC()
+}
+
+func formatPostTime(value, layout string) string {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return value
+	}
+
+	return t.UTC().Format(layout)
+}
+
+func requestURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+
+	return fmt.Sprintf("%s://%s%s", scheme, r.Host, r.URL.Path)
+}
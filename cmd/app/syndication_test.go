@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ekachaikeaw/social/internal/store"
+)
+
+func TestSyndicationFeeds(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	tests := []struct {
+		path        string
+		contentType string
+	}{
+		{"/v1/users/1/feed.atom", "application/atom+xml"},
+		{"/v1/users/1/feed.rss", "application/rss+xml"},
+		{"/v1/tags/golang/feed.atom", "application/atom+xml"},
+		{"/v1/tags/golang/feed.rss", "application/rss+xml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := executeRequest(req, mux)
+			checkResponseCode(t, http.StatusOK, rr.Code)
+
+			if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, tt.contentType) {
+				t.Errorf("expected content type %s. Got %s", tt.contentType, ct)
+			}
+
+			etag := rr.Header().Get("ETag")
+			if etag == "" {
+				t.Fatal("expected an ETag")
+			}
+
+			req.Header.Set("If-None-Match", etag)
+			rr = executeRequest(req, mux)
+			checkResponseCode(t, http.StatusNotModified, rr.Code)
+		})
+	}
+}
+
+// syndicationPostStore has an older post and a newer one with markup in it
+type syndicationPostStore struct {
+	store.MockPostStore
+}
+
+func (s *syndicationPostStore) GetByUserID(context.Context, int64, int) ([]store.Post, error) {
+	return []store.Post{
+		{ID: 2, Title: "Tips & <tricks>", Content: "a < b && c", CreatedAt: "2024-05-02T10:00:00Z", UpdatedAt: "2024-05-02T10:00:00Z"},
+		{ID: 1, Title: "Hello", Content: "first", CreatedAt: "2024-05-01T10:00:00Z", UpdatedAt: "2024-05-01T12:00:00Z"},
+	}, nil
+}
+
+func TestSyndicationContent(t *testing.T) {
+	app := newTestApplication(t, config{})
+	app.store.Posts = &syndicationPostStore{}
+	mux := app.mount()
+
+	get := func(t *testing.T, path string) (string, http.Header) {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodGet, path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		return rr.Body.String(), rr.Header()
+	}
+
+	checkEscaped := func(t *testing.T, body string) {
+		t.Helper()
+
+		if strings.Contains(body, "<tricks>") || strings.Contains(body, "b && c") {
+			t.Error("expected the markup of the post escaped")
+		}
+		if !strings.Contains(body, "Tips &amp; &lt;tricks&gt;") || !strings.Contains(body, "a &lt; b &amp;&amp; c") {
+			t.Errorf("expected the escaped title and content in %s", body)
+		}
+	}
+
+	t.Run("atom", func(t *testing.T) {
+		body, header := get(t, "/v1/users/1/feed.atom")
+		checkEscaped(t, body)
+
+		var feed atomFeed
+		if err := xml.Unmarshal([]byte(body), &feed); err != nil {
+			t.Fatal(err)
+		}
+		if feed.Updated != "2024-05-02T10:00:00Z" {
+			t.Errorf("expected updated at the newest post. Got %s", feed.Updated)
+		}
+		if len(feed.Entries) != 2 || feed.Entries[0].Title != "Tips & <tricks>" || feed.Entries[0].Content.Body != "a < b && c" {
+			t.Errorf("unexpected entries %+v", feed.Entries)
+		}
+		if lm := header.Get("Last-Modified"); lm != "Thu, 02 May 2024 10:00:00 GMT" {
+			t.Errorf("expected Last-Modified at the newest post. Got %s", lm)
+		}
+	})
+
+	t.Run("rss", func(t *testing.T) {
+		body, header := get(t, "/v1/users/1/feed.rss")
+		checkEscaped(t, body)
+
+		var feed rssFeed
+		if err := xml.Unmarshal([]byte(body), &feed); err != nil {
+			t.Fatal(err)
+		}
+		if feed.Channel.LastBuildDate != "Thu, 02 May 2024 10:00:00 +0000" {
+			t.Errorf("expected lastBuildDate at the newest post. Got %s", feed.Channel.LastBuildDate)
+		}
+		if len(feed.Channel.Items) != 2 || feed.Channel.Items[0].Title != "Tips & <tricks>" || feed.Channel.Items[0].Description != "a < b && c" {
+			t.Errorf("unexpected items %+v", feed.Channel.Items)
+		}
+		if lm := header.Get("Last-Modified"); lm != "Thu, 02 May 2024 10:00:00 GMT" {
+			t.Errorf("expected Last-Modified at the newest post. Got %s", lm)
+		}
+	})
+}
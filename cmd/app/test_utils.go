@@ -4,11 +4,17 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/ekachaikeaw/social/internal/activitypub"
 	"github.com/ekachaikeaw/social/internal/auth"
+	"github.com/ekachaikeaw/social/internal/mailer"
+	"github.com/ekachaikeaw/social/internal/media"
 	"github.com/ekachaikeaw/social/internal/ratelimiter"
 	"github.com/ekachaikeaw/social/internal/store"
 	"github.com/ekachaikeaw/social/internal/store/cache"
+	"github.com/ekachaikeaw/social/internal/stream"
+	"github.com/ekachaikeaw/social/internal/username"
 	"go.uber.org/zap"
 )
 
@@ -21,16 +27,31 @@ func newTestApplication(t *testing.T, cfg config) *application {
 		cfg.rateLimiter.RequestPerTimeFrame,
 		cfg.rateLimiter.TimeFram,
 	)
+	mailLimiter := ratelimiter.NewFixedWindowRateLimiter(
+		cfg.mail.rateLimiter.RequestPerTimeFrame,
+		cfg.mail.rateLimiter.TimeFram,
+	)
 	mockStore := store.NewMockStore()
 	mockCache := cache.NewMockStore()
 	mockAuth := auth.NewMockAuth()
+	mediaStore, err := media.NewDiskStore(t.TempDir(), "http://localhost:8080/v1/media")
+	if err != nil {
+		t.Fatal(err)
+	}
 	return &application{
 		config:        cfg,
 		logger:        logger,
 		store:         mockStore,
 		cacheStore:    mockCache,
 		authenticator: mockAuth,
+		mailer:        mailer.NewMockClient(),
 		ratelimiter:   rateLimiter,
+		mailLimiter:   mailLimiter,
+		federation:    activitypub.NewLocalClient(time.Second * 5),
+		actorKeys:     activitypub.NewKeyCache(cfg.federation.keyTTL),
+		broker:        stream.NewMemoryBroker(streamBuffer),
+		media:         mediaStore,
+		usernames:     username.NewPolicy(cfg.username.reserved),
 	}
 }
 
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/ekachaikeaw/social/internal/store"
+	"github.com/ekachaikeaw/social/internal/store/cache"
+)
+
+func (app *application) fanoutEnabled() bool {
+	return app.config.redis.enable && app.config.feed.fanout
+}
+
+// getUserFeed reads from the materialized home timeline when fan-out is
+// enabled and the query can be answered from it, otherwise from the SQL feed.
+// It returns the position of the next page if there may be one.
+func (app *application) getUserFeed(c context.Context, userID int64, fq store.PaginatedQuery) ([]store.PostWithMetadata, *store.Cursor, error) {
+	// timelines are kept in chronological order without any filters
+	filtered := fq.Search != "" || len(fq.Tags) > 0 || fq.Since != nil || fq.Until != nil
+	if app.fanoutEnabled() && !filtered && fq.Sort != "top" {
+		feed, next, ok, err := app.getTimelineFeed(c, userID, fq)
+		if err != nil {
+			app.logger.Errorw("error reading timeline, falling back to database", "user_id", userID, "error", err)
+		} else if ok {
+			return feed, next, nil
+		}
+	}
+
+	feed, err := app.store.Posts.GetUserFeed(c, userID, fq)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	next, err := nextFeedCursor(feed, fq)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return feed, next, nil
+}
+
+func (app *application) getTimelineFeed(c context.Context, userID int64, fq store.PaginatedQuery) ([]store.PostWithMetadata, *store.Cursor, bool, error) {
+	entries, ok, err := app.cacheStore.Timelines.Get(c, userID, fq)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	if !ok {
+		if err := app.rebuildTimeline(c, userID); err != nil {
+			return nil, nil, false, err
+		}
+
+		entries, ok, err = app.cacheStore.Timelines.Get(c, userID, fq)
+		if err != nil || !ok {
+			return nil, nil, false, err
+		}
+	}
+
+	ids := make([]int64, 0, len(entries))
+	for _, e := range entries {
+		ids = append(ids, e.PostID)
+	}
+
+	feed, err := app.store.Posts.GetByIDs(c, userID, ids)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	// the cursor comes from the timeline so deleted posts don't end the feed early
+	var next *store.Cursor
+	if len(entries) == fq.Limit {
+		last := entries[len(entries)-1]
+		next = &store.Cursor{CreatedAt: last.CreatedAt, ID: last.PostID}
+	}
+
+	return feed, next, true, nil
+}
+
+func (app *application) rebuildTimeline(c context.Context, userID int64) error {
+	feed, err := app.store.Posts.GetUserFeed(c, userID, store.PaginatedQuery{
+		Limit: cache.TimelineSize,
+		Sort:  "desc",
+		Tags:  []string{},
+	})
+	if err != nil {
+		return err
+	}
+
+	entries := make([]cache.TimelineEntry, 0, len(feed))
+	for _, p := range feed {
+		entry, err := toTimelineEntry(p.Post)
+		if err != nil {
+			return err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return app.cacheStore.Timelines.Set(c, userID, entries)
+}
+
+func (app *application) createPost(c context.Context, post *store.Post) error {
+	if err := app.store.Posts.Create(c, post); err != nil {
+		return err
+	}
+
+	// failures only delay delivery, followers see the post on their next read
+	followers, err := app.store.Follower.GetFollowerIDs(c, post.UserID)
+	if err != nil {
+		app.logger.Errorw("error distributing post", "post_id", post.ID, "error", err)
+	} else {
+		if app.fanoutEnabled() {
+			app.fanoutPost(c, post, followers)
+		}
+
+		app.publishPost(c, post, followers)
+	}
+
+	if app.config.federation.enable {
+		go app.federatePost(*post)
+	}
+
+	return nil
+}
+
+// fanoutPost pushes a new post to the timelines of the author and their
+// followers. Failures are only logged, reads fall back to the database.
+func (app *application) fanoutPost(c context.Context, post *store.Post, followers []int64) {
+	entry, err := toTimelineEntry(*post)
+	if err != nil {
+		app.logger.Errorw("error fanning out post", "post_id", post.ID, "error", err)
+		return
+	}
+
+	if err := app.cacheStore.Timelines.Push(c, entry, append(followers, post.UserID)); err != nil {
+		app.logger.Errorw("error fanning out post", "post_id", post.ID, "error", err)
+	}
+}
+
+// backfillTimeline adds the recent posts of a newly followed user
+func (app *application) backfillTimeline(c context.Context, followerID, followedID int64) {
+	posts, err := app.store.Posts.GetByUserID(c, followedID, cache.TimelineSize)
+	if err != nil {
+		app.logger.Errorw("error backfilling timeline", "user_id", followerID, "error", err)
+		return
+	}
+
+	entries := make([]cache.TimelineEntry, 0, len(posts))
+	for _, p := range posts {
+		entry, err := toTimelineEntry(p)
+		if err != nil {
+			app.logger.Errorw("error backfilling timeline", "user_id", followerID, "error", err)
+			return
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if err := app.cacheStore.Timelines.Add(c, followerID, entries); err != nil {
+		app.logger.Errorw("error backfilling timeline", "user_id", followerID, "error", err)
+	}
+}
+
+// cleanupTimeline removes the posts of an unfollowed user
+func (app *application) cleanupTimeline(c context.Context, followerID, unfollowedID int64) {
+	posts, err := app.store.Posts.GetByUserID(c, unfollowedID, cache.TimelineSize)
+	if err != nil {
+		app.logger.Errorw("error cleaning up timeline", "user_id", followerID, "error", err)
+		return
+	}
+
+	ids := make([]int64, 0, len(posts))
+	for _, p := range posts {
+		ids = append(ids, p.ID)
+	}
+
+	if err := app.cacheStore.Timelines.Remove(c, followerID, ids); err != nil {
+		app.logger.Errorw("error cleaning up timeline", "user_id", followerID, "error", err)
+	}
+}
+
+func toTimelineEntry(p store.Post) (cache.TimelineEntry, error) {
+	createdAt, err := time.Parse(time.RFC3339Nano, p.CreatedAt)
+	if err != nil {
+		return cache.TimelineEntry{}, err
+	}
+
+	return cache.TimelineEntry{PostID: p.ID, CreatedAt: createdAt}, nil
+}
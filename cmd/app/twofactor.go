@@ -0,0 +1,374 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ekachaikeaw/social/internal/store"
+	"github.com/ekachaikeaw/social/internal/totp"
+	"github.com/google/uuid"
+)
+
+// maxChallengeAttempts bounds the codes tried against one challenge, a new
+// challenge needs the password again
+const maxChallengeAttempts = 5
+
+// qrCodeSize is the width in pixels of the enrollment QR code
+const qrCodeSize = 256
+
+var errInvalidCode = errors.New("code is incorrect")
+
+type TOTPCodePayload struct {
+	Code string `json:"code" validate:"required,max=32"`
+}
+
+type TwoFactorTokenPayload struct {
+	ChallengeToken string `json:"challenge_token" validate:"required,max=255"`
+	Code           string `json:"code" validate:"required,max=32"`
+}
+
+// TOTPEnrollment is what an authenticator app needs, QRPNG is OTPAuthURI
+// rendered as a PNG data URI to scan and Secret is for typing it in
+type TOTPEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+	QRPNG      string `json:"qr_png"`
+}
+
+// RecoveryCodes are shown once, each of them logs in once in place of a
+// TOTP code
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// TwoFactorChallenge is the answer to a correct password when 2FA is on,
+// the token is exchanged with a code for the tokens
+type TwoFactorChallenge struct {
+	ChallengeToken string `json:"challenge_token"`
+	ExpiresIn      int64  `json:"expires_in"`
+}
+
+// enrollTOTPHandler godoc
+//
+//	@Summary		Starts 2FA enrollment
+//	@Description	Creates a new TOTP secret for the authenticated user. 2FA is only on once a code of it is confirmed, enrolling again replaces a pending secret.
+//	@Tags			users
+//	@Produce		json
+//	@Success		201	{object}	TOTPEnrollment
+//	@Failure		401	{object}	error
+//	@Failure		409	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/2fa [post]
+func (a *application) enrollTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	if err := a.store.TwoFactor.Enroll(r.Context(), user.ID, secret); err != nil {
+		switch err {
+		case store.ErrTOTPEnabled:
+			a.conflictErr(w, r, err)
+		default:
+			a.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	uri := totp.URI(a.config.auth.totp.issuer, user.Email, secret)
+	qr, err := totp.QRCode(uri, qrCodeSize)
+	if err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	enrollment := TOTPEnrollment{
+		Secret:     secret,
+		OTPAuthURI: uri,
+		QRPNG:      "data:image/png;base64," + base64.StdEncoding.EncodeToString(qr),
+	}
+	if err := a.jsonResponse(w, http.StatusCreated, enrollment); err != nil {
+		a.internalServerError(w, r, err)
+	}
+}
+
+// confirmTOTPHandler godoc
+//
+//	@Summary		Confirms 2FA enrollment
+//	@Description	Turns 2FA on with a code of the pending secret and returns the recovery codes, they are not shown again. Refresh tokens issued before are revoked.
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		TOTPCodePayload	true	"Code"
+//	@Success		200		{object}	RecoveryCodes
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		409		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/2fa/confirm [post]
+func (a *application) confirmTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	var payload TOTPCodePayload
+	if err := readJson(w, r, &payload); err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	c := r.Context()
+	user := getUserFromCtx(r)
+
+	t, err := a.store.TwoFactor.Get(c, user.ID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			a.notFoundErr(w, r, errors.New("no pending 2FA enrollment"))
+		default:
+			a.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if t.Enabled() {
+		a.conflictErr(w, r, store.ErrTOTPEnabled)
+		return
+	}
+
+	counter, ok := totp.Validate(t.Secret, payload.Code, time.Now())
+	if !ok {
+		a.badRequestResponse(w, r, errInvalidCode)
+		return
+	}
+
+	codes, err := totp.GenerateRecoveryCodes(totp.RecoveryCodeCount)
+	if err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	// stored the way they are typed back in, the store only keeps hashes
+	normalized := make([]string, len(codes))
+	for i, code := range codes {
+		normalized[i] = totp.NormalizeRecoveryCode(code)
+	}
+
+	if err := a.store.TwoFactor.Enable(c, user.ID, counter, normalized); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			a.badRequestResponse(w, r, errInvalidCode)
+		default:
+			a.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := a.jsonResponse(w, http.StatusOK, RecoveryCodes{RecoveryCodes: codes}); err != nil {
+		a.internalServerError(w, r, err)
+	}
+}
+
+// disableTOTPHandler godoc
+//
+//	@Summary		Turns 2FA off
+//	@Description	Turns 2FA off for the authenticated user, given a TOTP or recovery code
+//	@Tags			users
+//	@Accept			json
+//	@Param			payload	body		TOTPCodePayload	true	"Code"
+//	@Success		204		{string}	string			"2FA off"
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/2fa [delete]
+func (a *application) disableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	var payload TOTPCodePayload
+	if err := readJson(w, r, &payload); err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	c := r.Context()
+	user := getUserFromCtx(r)
+
+	t, err := a.enabledTOTP(c, user.ID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			a.notFoundErr(w, r, errors.New("2FA is not enabled"))
+		default:
+			a.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	ok, err := a.checkSecondFactor(c, t, payload.Code)
+	if err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+	if !ok {
+		a.badRequestResponse(w, r, errInvalidCode)
+		return
+	}
+
+	if err := a.store.TwoFactor.Disable(c, user.ID); err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// verifyTwoFactorHandler godoc
+//
+//	@Summary		Completes a 2FA login
+//	@Description	Exchanges the challenge token of a login and a TOTP or recovery code for an access token and a refresh token
+//	@Tags			authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		TwoFactorTokenPayload	true	"Challenge and code"
+//	@Success		201		{object}	TokenPair				"Tokens"
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/authentication/token/2fa [post]
+func (a *application) verifyTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var payload TwoFactorTokenPayload
+	if err := readJson(w, r, &payload); err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	c := r.Context()
+
+	userID, err := a.store.TwoFactor.AttemptChallenge(c, payload.ChallengeToken, maxChallengeAttempts)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			a.unauthorizedErrorResponse(w, r, errors.New("invalid challenge token"))
+		default:
+			a.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// 2FA may have been turned off since, the challenge is void then
+	t, err := a.enabledTOTP(c, userID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			a.unauthorizedErrorResponse(w, r, errors.New("invalid challenge token"))
+		default:
+			a.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	ok, err := a.checkSecondFactor(c, t, payload.Code)
+	if err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+	if !ok {
+		a.unauthorizedErrorResponse(w, r, errInvalidCode)
+		return
+	}
+
+	if err := a.store.TwoFactor.DeleteChallenge(c, payload.ChallengeToken); err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	user, err := a.store.Users.GetByID(c, userID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			a.unauthorizedErrorResponse(w, r, err)
+		default:
+			a.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// logging in during the grace period keeps the account
+	if err := a.cancelDeletion(c, user); err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	tokens, err := a.createTokenPair(c, user)
+	if err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	if err := a.jsonResponse(w, http.StatusCreated, tokens); err != nil {
+		a.internalServerError(w, r, err)
+	}
+}
+
+// createChallenge starts the second step of a login of userID, the hash of
+// the token is stored and the plain token only goes to the client
+func (a *application) createChallenge(c context.Context, userID int64) (*TwoFactorChallenge, error) {
+	plainToken := uuid.New().String()
+	hash := sha256.Sum256([]byte(plainToken))
+	hashToken := hex.EncodeToString(hash[:])
+
+	if err := a.store.TwoFactor.CreateChallenge(c, userID, hashToken, a.config.auth.totp.challengeExp); err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorChallenge{
+		ChallengeToken: plainToken,
+		ExpiresIn:      int64(a.config.auth.totp.challengeExp.Seconds()),
+	}, nil
+}
+
+// enabledTOTP is the TOTP of userID, ErrNotFound unless 2FA is on
+func (a *application) enabledTOTP(c context.Context, userID int64) (*store.TOTP, error) {
+	t, err := a.store.TwoFactor.Get(c, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !t.Enabled() {
+		return nil, store.ErrNotFound
+	}
+
+	return t, nil
+}
+
+// checkSecondFactor accepts a TOTP code once per time step, anything else is
+// tried as a recovery code
+func (a *application) checkSecondFactor(c context.Context, t *store.TOTP, code string) (bool, error) {
+	if counter, ok := totp.Validate(t.Secret, code, time.Now()); ok {
+		return a.store.TwoFactor.UseCode(c, t.UserID, counter)
+	}
+
+	return a.store.TwoFactor.UseRecoveryCode(c, t.UserID, totp.NormalizeRecoveryCode(code))
+}
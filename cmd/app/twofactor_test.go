@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ekachaikeaw/social/internal/store"
+	"github.com/ekachaikeaw/social/internal/totp"
+)
+
+func TestTwoFactorEnrollment(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := totp.Code(store.MockTOTPSecret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		body   string
+		auth   bool
+		code   int
+	}{
+		{"should start an enrollment", http.MethodPost, "/v1/users/me/2fa", "", true, http.StatusCreated},
+		{"should confirm with a code", http.MethodPost, "/v1/users/me/2fa/confirm", fmt.Sprintf(`{"code":%q}`, code), true, http.StatusOK},
+		{"should reject a wrong code", http.MethodPost, "/v1/users/me/2fa/confirm", `{"code":"abcdef"}`, true, http.StatusBadRequest},
+		{"should require a code", http.MethodPost, "/v1/users/me/2fa/confirm", `{}`, true, http.StatusBadRequest},
+		{"should not disable 2FA that is not on", http.MethodDelete, "/v1/users/me/2fa", fmt.Sprintf(`{"code":%q}`, code), true, http.StatusNotFound},
+		{"should not enroll unauthenticated", http.MethodPost, "/v1/users/me/2fa", "", false, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.auth {
+				req.Header.Set("Authorization", "Bearer "+testToken)
+			}
+			rr := executeRequest(req, mux)
+
+			checkResponseCode(t, tt.code, rr.Code)
+		})
+	}
+
+	t.Run("should return an otpauth uri and its qr code", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/v1/users/me/2fa", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		rr := executeRequest(req, mux)
+
+		var body struct {
+			Data TOTPEnrollment `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(body.Data.OTPAuthURI, "otpauth://totp/") || !strings.Contains(body.Data.OTPAuthURI, body.Data.Secret) {
+			t.Errorf("unexpected enrollment %+v", body.Data)
+		}
+
+		data, ok := strings.CutPrefix(body.Data.QRPNG, "data:image/png;base64,")
+		if !ok {
+			t.Fatalf("expected a png data uri, got %.40q", body.Data.QRPNG)
+		}
+		raw, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := png.Decode(bytes.NewReader(raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size := img.Bounds().Dx(); size != qrCodeSize {
+			t.Errorf("expected a %dpx qr code, got %dpx", qrCodeSize, size)
+		}
+	})
+
+	t.Run("should return the recovery codes", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/v1/users/me/2fa/confirm", strings.NewReader(fmt.Sprintf(`{"code":%q}`, code)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		rr := executeRequest(req, mux)
+
+		var body struct {
+			Data RecoveryCodes `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if len(body.Data.RecoveryCodes) != totp.RecoveryCodeCount {
+			t.Errorf("expected %d recovery codes, got %v", totp.RecoveryCodeCount, body.Data.RecoveryCodes)
+		}
+	})
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	t.Run("should return a challenge instead of tokens", func(t *testing.T) {
+		body := `{"email":"totp@example.com","password":"password"}`
+		req, err := http.NewRequest(http.MethodPost, "/v1/authentication/token", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusAccepted, rr.Code)
+
+		var resp struct {
+			Data TwoFactorChallenge `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Data.ChallengeToken == "" {
+			t.Error("expected a challenge token")
+		}
+	})
+
+	code, err := totp.Code(store.MockTOTPSecret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{"should exchange a TOTP code", fmt.Sprintf(`{"challenge_token":"valid","code":%q}`, code), http.StatusCreated},
+		{"should exchange a recovery code", `{"challenge_token":"valid","code":"ABCDE-FGHIJ"}`, http.StatusCreated},
+		{"should reject a wrong code", `{"challenge_token":"valid","code":"vwxyz-vwxyz"}`, http.StatusUnauthorized},
+		{"should reject an unknown challenge", fmt.Sprintf(`{"challenge_token":"unknown","code":%q}`, code), http.StatusUnauthorized},
+		{"should require a code", `{"challenge_token":"valid"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "/v1/authentication/token/2fa", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := executeRequest(req, mux)
+
+			checkResponseCode(t, tt.code, rr.Code)
+			if tt.code != http.StatusCreated {
+				return
+			}
+
+			var body struct {
+				Data TokenPair `json:"data"`
+			}
+			if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Data.AccessToken == "" || body.Data.RefreshToken == "" {
+				t.Errorf("expected a token pair, got %+v", body.Data)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ekachaikeaw/social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+type UsernameAvailability struct {
+	Username  string `json:"username"`
+	Available bool   `json:"available"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// usernameAvailableHandler godoc
+//
+//	@Summary		Checks a username
+//	@Description	Reports whether a username can be registered, with the reason when it can't. Usernames are compared case insensitively and lookalikes of taken or reserved names are refused.
+//	@Tags			users
+//	@Produce		json
+//	@Param			username	query		string	true	"Username"
+//	@Success		200			{object}	UsernameAvailability
+//	@Failure		400			{object}	error
+//	@Failure		500			{object}	error
+//	@Router			/users/available [get]
+func (a *application) usernameAvailableHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("username")
+	if name == "" {
+		a.badRequestResponse(w, r, errors.New("username is required"))
+		return
+	}
+
+	result := UsernameAvailability{Username: name}
+
+	normalized, err := a.usernames.Check(name)
+	if err != nil {
+		result.Reason = err.Error()
+	} else {
+		result.Username = normalized
+		result.Available, err = a.store.Users.UsernameAvailable(r.Context(), normalized)
+		if err != nil {
+			a.internalServerError(w, r, err)
+			return
+		}
+		if !result.Available {
+			result.Reason = "username is taken"
+		}
+	}
+
+	if err := a.jsonResponse(w, http.StatusOK, result); err != nil {
+		a.internalServerError(w, r, err)
+	}
+}
+
+type ChangeUsernamePayload struct {
+	Username string `json:"username" validate:"required,max=100"`
+}
+
+type UsernameChangeResult struct {
+	Username     string    `json:"username"`
+	NextChangeAt time.Time `json:"next_change_at"`
+}
+
+// changeUsernameHandler godoc
+//
+//	@Summary		Changes the username
+//	@Description	Renames the authenticated user. The old name resolves to them and can't be registered by others for a while. Usernames can only be changed once per cooldown.
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		ChangeUsernamePayload	true	"New username"
+//	@Success		200		{object}	UsernameChangeResult
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		429		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/username [put]
+func (a *application) changeUsernameHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ChangeUsernamePayload
+	if err := readJson(w, r, &payload); err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	name, err := a.usernames.Check(payload.Username)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	c := r.Context()
+
+	// the cached user may predate the last change
+	user, err := a.store.Users.GetByID(c, getUserFromCtx(r).ID)
+	if err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	if name == user.Username {
+		a.badRequestResponse(w, r, errors.New("username is unchanged"))
+		return
+	}
+
+	cooldown := a.config.username.changeCooldown
+	if user.UsernameChangedAt != nil {
+		if wait := time.Until(user.UsernameChangedAt.Add(cooldown)); wait > 0 {
+			a.rateLimitExeededResponse(w, r, wait.Round(time.Second).String())
+			return
+		}
+	}
+
+	changedAt, err := a.store.Users.ChangeUsername(c, user.ID, name, cooldown, a.config.username.hold)
+	if err != nil {
+		switch err {
+		case store.ErrUsernameCooldown:
+			// changedAt is the change that started the cooldown
+			a.rateLimitExeededResponse(w, r, time.Until(changedAt.Add(cooldown)).Round(time.Second).String())
+		case store.ErrDuplicateUsername:
+			a.badRequestResponse(w, r, err)
+		default:
+			a.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if a.config.redis.enable {
+		a.cacheStore.Users.Delete(c, user.ID)
+	}
+
+	result := UsernameChangeResult{Username: name, NextChangeAt: changedAt.Add(cooldown)}
+	if err := a.jsonResponse(w, http.StatusOK, result); err != nil {
+		a.internalServerError(w, r, err)
+	}
+}
+
+// getUsernameHistoryHandler godoc
+//
+//	@Summary		Lists previous usernames
+//	@Description	Lists the usernames the authenticated user gave up and until when each is held for them, most recent first
+//	@Tags			users
+//	@Produce		json
+//	@Success		200	{object}	[]store.UsernameChange
+//	@Failure		401	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/usernames [get]
+func (a *application) getUsernameHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	history, err := a.store.Users.GetUsernameHistory(r.Context(), getUserFromCtx(r).ID)
+	if err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	if err := a.jsonResponse(w, http.StatusOK, history); err != nil {
+		a.internalServerError(w, r, err)
+	}
+}
+
+type UsernameRedirect struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+// getUserByUsernameHandler godoc
+//
+//	@Summary		Fetches a user profile by username
+//	@Description	Fetches the profile of the user with a username. A previous username answers with a temporary redirect to the current one, the old name may be registered by someone else once its hold ends.
+//	@Tags			users
+//	@Produce		json
+//	@Param			username	path		string	true	"Username"
+//	@Success		200			{object}	UserProfile
+//	@Success		307			{object}	UsernameRedirect
+//	@Failure		401			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/by-username/{username} [get]
+func (a *application) getUserByUsernameHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "username")
+
+	user, err := a.store.Users.ResolveUsername(r.Context(), name)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			a.notFoundErr(w, r, err)
+		default:
+			a.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// not permanent, the old name is freed once the hold ends
+	if !strings.EqualFold(name, user.Username) {
+		w.Header().Set("Location", "/v1/users/by-username/"+url.PathEscape(user.Username))
+		if err := a.jsonResponse(w, http.StatusTemporaryRedirect, UsernameRedirect{ID: user.ID, Username: user.Username}); err != nil {
+			a.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	a.userProfileResponse(w, r, user.ID)
+}
+
+// skeletonBatchSize is the number of users the skeleton backfill loads at once
+const skeletonBatchSize = 500
+
+// backfillSkeletons fills in the username skeletons of the accounts created
+// before they were stored, Skeleton only exists in Go
+func (app *application) backfillSkeletons(c context.Context) {
+	filled, skipped, err := app.store.Users.BackfillSkeletons(c, skeletonBatchSize)
+	if err != nil {
+		app.logger.Errorw("error backfilling username skeletons", "error", err)
+		return
+	}
+
+	if filled > 0 || skipped > 0 {
+		app.logger.Infow("backfilled username skeletons", "filled", filled, "lookalikes", skipped)
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUsernameAvailable(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	tests := []struct {
+		name      string
+		url       string
+		code      int
+		available bool
+	}{
+		{"should report a free username", "/v1/users/available?username=gopher", http.StatusOK, true},
+		{"should report a taken username", "/v1/users/available?username=taken", http.StatusOK, false},
+		{"should report a reserved username", "/v1/users/available?username=R00t", http.StatusOK, false},
+		{"should report an invalid username", "/v1/users/available?username=go%20pher", http.StatusOK, false},
+		{"should require a username", "/v1/users/available", http.StatusBadRequest, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := executeRequest(req, mux)
+
+			checkResponseCode(t, tt.code, rr.Code)
+			if tt.code != http.StatusOK {
+				return
+			}
+
+			var body struct {
+				Data UsernameAvailability `json:"data"`
+			}
+			if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Data.Available != tt.available {
+				t.Errorf("expected available %v, got %v (%s)", tt.available, body.Data.Available, body.Data.Reason)
+			}
+		})
+	}
+}
+
+func TestRegisterUsernamePolicy(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	tests := []struct {
+		name     string
+		username string
+		code     int
+	}{
+		{"should register a valid username", "gopher", http.StatusCreated},
+		{"should reject a reserved username", "support", http.StatusBadRequest},
+		{"should reject a blank username", "    ", http.StatusBadRequest},
+		{"should reject a mixed script username", "gорher", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := json.Marshal(RegisterUserPayload{
+				Username: tt.username,
+				Email:    "gopher@example.com",
+				Password: "password",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req, err := http.NewRequest(http.MethodPost, "/v1/authentication/user", bytes.NewReader(payload))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := executeRequest(req, mux)
+
+			checkResponseCode(t, tt.code, rr.Code)
+		})
+	}
+}
+
+func TestChangeUsername(t *testing.T) {
+	app := newTestApplication(t, config{username: usernameConfig{changeCooldown: 24 * time.Hour}})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		auth     bool
+		code     int
+	}{
+		{"should change the username", "gopher", true, http.StatusOK},
+		{"should reject a reserved username", "admin", true, http.StatusBadRequest},
+		{"should reject an invalid username", "go pher", true, http.StatusBadRequest},
+		{"should not change the username unauthenticated", "gopher", false, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := json.Marshal(ChangeUsernamePayload{Username: tt.username})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req, err := http.NewRequest(http.MethodPut, "/v1/users/me/username", bytes.NewReader(payload))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.auth {
+				req.Header.Set("Authorization", "Bearer "+testToken)
+			}
+			rr := executeRequest(req, mux)
+
+			checkResponseCode(t, tt.code, rr.Code)
+		})
+	}
+
+	t.Run("should ask to retry once the cooldown ends", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPut, "/v1/users/me/username", strings.NewReader(`{"username":"recent"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusTooManyRequests, rr.Code)
+		// the mock changed the name an hour ago
+		if got := rr.Header().Get("Retry-After"); got != "23h0m0s" {
+			t.Errorf("expected Retry-After 23h0m0s, got %q", got)
+		}
+	})
+
+	t.Run("should list previous usernames", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/me/usernames", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+}
+
+func TestGetUserByUsername(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		code     int
+		location string
+	}{
+		{"should return the profile", "gopher", http.StatusOK, ""},
+		{"should redirect a previous username", "oldgopher", http.StatusTemporaryRedirect, "/v1/users/by-username/gopher"},
+		{"should not find an unknown username", "nobody", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "/v1/users/by-username/"+tt.username, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("Authorization", "Bearer "+testToken)
+			rr := executeRequest(req, mux)
+
+			checkResponseCode(t, tt.code, rr.Code)
+			if got := rr.Header().Get("Location"); got != tt.location {
+				t.Errorf("expected location %q, got %q", tt.location, got)
+			}
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -10,15 +12,21 @@ import (
 
 type userKey struct{}
 
+// UserProfile is a user with the counts and relationship to the caller
+type UserProfile struct {
+	*store.User
+	store.UserStats
+}
+
 // GetUser godoc
 //
 //	@Summary		Fetches a user profile
-//	@Description	Fetches a user profile by ID
+//	@Description	Fetches a user profile by ID with follower, following and post counts and whether the caller and the user follow each other
 //	@Tags			users
 //	@Accept			json
 //	@Produce		json
 //	@Param			id	path		int	true	"User ID"
-//	@Success		200	{object}	store.User
+//	@Success		200	{object}	UserProfile
 //	@Failure		400	{object}	error
 //	@Failure		404	{object}	error
 //	@Failure		500	{object}	error
@@ -31,6 +39,10 @@ func (a *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	a.userProfileResponse(w, r, userID)
+}
+
+func (a *application) userProfileResponse(w http.ResponseWriter, r *http.Request, userID int64) {
 	c := r.Context()
 
 	user, err := a.getUser(c, userID)
@@ -44,7 +56,130 @@ func (a *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
-	a.jsonResponse(w, http.StatusOK, user)
+
+	// counts change too often and depend on the caller, so they are never
+	// part of the cached user
+	stats, err := a.store.Users.GetStats(c, userID, getUserFromCtx(r).ID)
+	if err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	a.jsonResponse(w, http.StatusOK, UserProfile{User: user, UserStats: *stats})
+}
+
+// getFollowersHandler godoc
+//
+//	@Summary		Lists the followers of a user
+//	@Description	Lists the users following a user, most recent first. Private accounts only show their lists to followers.
+//	@Tags			users
+//	@Produce		json
+//	@Param			userID	path		int		true	"User ID"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Param			sort	query		string	false	"Sort by follow date, asc or desc"
+//	@Success		200		{object}	[]store.FollowUser
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/followers [get]
+func (a *application) getFollowersHandler(w http.ResponseWriter, r *http.Request) {
+	a.followListResponse(w, r, a.store.Follower.GetFollowers)
+}
+
+// getFollowingHandler godoc
+//
+//	@Summary		Lists the users a user follows
+//	@Description	Lists the users a user follows, most recent first. Private accounts only show their lists to followers.
+//	@Tags			users
+//	@Produce		json
+//	@Param			userID	path		int		true	"User ID"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Param			sort	query		string	false	"Sort by follow date, asc or desc"
+//	@Success		200		{object}	[]store.FollowUser
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/following [get]
+func (a *application) getFollowingHandler(w http.ResponseWriter, r *http.Request) {
+	a.followListResponse(w, r, a.store.Follower.GetFollowing)
+}
+
+type followListFunc func(c context.Context, userID int64, fq store.PaginatedQuery) ([]store.FollowUser, error)
+
+func (a *application) followListResponse(w http.ResponseWriter, r *http.Request, list followListFunc) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	fq, err := parseListQuery(r)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	c := r.Context()
+
+	if _, err := a.getUser(c, userID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			a.notFoundErr(w, r, err)
+		default:
+			a.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// the lists of private accounts are hidden like their posts, from non
+	// followers and from blocked users
+	visible, err := a.store.Follower.CanSee(c, getUserFromCtx(r).ID, userID)
+	if err != nil && err != store.ErrNotFound {
+		a.internalServerError(w, r, err)
+		return
+	}
+	if !visible {
+		a.notFoundErr(w, r, store.ErrNotFound)
+		return
+	}
+
+	users, err := list(c, userID, fq)
+	if err != nil {
+		a.internalServerError(w, r, err)
+		return
+	}
+
+	if err := a.jsonResponse(w, http.StatusOK, users); err != nil {
+		a.internalServerError(w, r, err)
+	}
+}
+
+// parseListQuery reads the limit, offset and asc or desc sort of a user list
+func parseListQuery(r *http.Request) (store.PaginatedQuery, error) {
+	fq := store.PaginatedQuery{
+		Limit:  20,
+		Offset: 0,
+		Sort:   "desc",
+	}
+
+	fq, err := fq.Parse(r)
+	if err != nil {
+		return fq, err
+	}
+
+	if err := Validate.Struct(fq); err != nil {
+		return fq, err
+	}
+
+	if fq.Sort == "top" {
+		return fq, errors.New("sort must be asc or desc")
+	}
+
+	return fq, nil
 }
 
 type UserPayload struct {
@@ -54,13 +189,15 @@ type UserPayload struct {
 // FollowUser godoc
 //
 //	@Summary		Follows a user
-//	@Description	Follows a user by ID
+//	@Description	Follows a user by ID, following a private account sends a follow request instead
 //	@Tags			users
 //	@Accept			json
 //	@Produce		json
 //	@Param			userID	path		int		true	"User ID"
+//	@Success		202		{string}	string	"Follow requested"
 //	@Success		204		{string}	string	"User followed"
 //	@Failure		400		{object}	error	"User payload missing"
+//	@Failure		403		{object}	error	"User blocked"
 //	@Failure		404		{object}	error	"User not found"
 //	@Security		ApiKeyAuth
 //	@Router			/users/{userID}/follow [put]
@@ -74,18 +211,38 @@ func (a *application) followUserHandler(w http.ResponseWriter, r *http.Request)
 	}
 
 	c := r.Context()
-	err = a.store.Follower.Follow(c, followerUser.ID, followedID)
+	pending, err := a.store.Follower.Follow(c, followerUser.ID, followedID)
 	if err != nil {
 		switch err {
 		case store.ErrConflict:
 			a.conflictErr(w, r, err)
 			return
+		case store.ErrNotFound:
+			a.notFoundErr(w, r, err)
+			return
+		case store.ErrBlocked:
+			a.forbiddenResponse(w, r)
+			return
 		default:
 			a.internalServerError(w, r, err)
 			return
 		}
 	}
 
+	a.dropSuggestions(c, followerUser.ID)
+
+	if pending {
+		a.notify(c, followedID, notification{Kind: "follow_request", UserID: followerUser.ID})
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	if a.fanoutEnabled() {
+		a.backfillTimeline(c, followerUser.ID, followedID)
+	}
+
+	a.notify(c, followedID, notification{Kind: "follow", UserID: followerUser.ID})
+
 	if err := a.jsonResponse(w, http.StatusNoContent, nil); err != nil {
 		a.internalServerError(w, r, err)
 		return
@@ -95,7 +252,7 @@ func (a *application) followUserHandler(w http.ResponseWriter, r *http.Request)
 // UnfollowUser gdoc
 //
 //	@Summary		Unfollow a user
-//	@Description	Unfollow a user by ID
+//	@Description	Unfollow a user by ID, a pending follow request is withdrawn
 //	@Tags			users
 //	@Accept			json
 //	@Produce		json
@@ -122,6 +279,12 @@ func (a *application) unfollowUserHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	a.dropSuggestions(c, follower.ID)
+
+	if a.fanoutEnabled() {
+		a.cleanupTimeline(c, follower.ID, unfollowedID)
+	}
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"net/http"
 	"testing"
+
+	"github.com/ekachaikeaw/social/internal/store"
 )
 
 func TestGetUser(t *testing.T) {
@@ -35,4 +39,75 @@ func TestGetUser(t *testing.T) {
 
 		checkResponseCode(t, http.StatusOK, rr.Code)
 	})
+
+	t.Run("should include counts and relationship", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		rr := executeRequest(req, mux)
+
+		var body struct {
+			Data map[string]any `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, key := range []string{"username", "followers_count", "following_count", "posts_count", "is_following", "follows_you"} {
+			if _, ok := body.Data[key]; !ok {
+				t.Errorf("expected %q in the profile", key)
+			}
+		}
+	})
+}
+
+// hiddenFollowerStore hides user 2 from everyone else, a private account
+// or one that blocked them
+type hiddenFollowerStore struct {
+	store.MockFollowerStore
+}
+
+func (s *hiddenFollowerStore) CanSee(c context.Context, viewerID, authorID int64) (bool, error) {
+	return authorID != 2, nil
+}
+
+func TestFollowLists(t *testing.T) {
+	app := newTestApplication(t, config{})
+	app.store.Follower = &hiddenFollowerStore{}
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		url  string
+		code int
+	}{
+		{"should list followers", "/v1/users/1/followers", http.StatusOK},
+		{"should list following", "/v1/users/1/following?sort=asc&limit=5&offset=5", http.StatusOK},
+		{"should reject the top sort", "/v1/users/1/followers?sort=top", http.StatusBadRequest},
+		{"should reject a large limit", "/v1/users/1/following?limit=100", http.StatusBadRequest},
+		{"should hide the followers of a hidden account", "/v1/users/2/followers", http.StatusNotFound},
+		{"should hide the following of a hidden account", "/v1/users/2/following", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("Authorization", "Bearer "+testToken)
+			rr := executeRequest(req, mux)
+
+			checkResponseCode(t, tt.code, rr.Code)
+		})
+	}
 }
@@ -0,0 +1,162 @@
+package activitypub
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+const (
+	ContentType     = "application/activity+json"
+	PublicAudience  = "https://www.w3.org/ns/activitystreams#Public"
+	activityStreams = "https://www.w3.org/ns/activitystreams"
+	securityV1      = "https://w3id.org/security/v1"
+)
+
+var ErrUnsupported = errors.New("unsupported activity")
+
+type Actor struct {
+	Context           []string   `json:"@context,omitempty"`
+	ID                string     `json:"id"`
+	Type              string     `json:"type"`
+	PreferredUsername string     `json:"preferredUsername"`
+	Name              string     `json:"name,omitempty"`
+	URL               string     `json:"url,omitempty"`
+	Inbox             string     `json:"inbox"`
+	Outbox            string     `json:"outbox,omitempty"`
+	Followers         string     `json:"followers,omitempty"`
+	Endpoints         *Endpoints `json:"endpoints,omitempty"`
+	PublicKey         PublicKey  `json:"publicKey"`
+}
+
+type Endpoints struct {
+	SharedInbox string `json:"sharedInbox,omitempty"`
+}
+
+type PublicKey struct {
+	ID           string `json:"id"`
+	Owner        string `json:"owner"`
+	PublicKeyPem string `json:"publicKeyPem"`
+}
+
+// Activity is kept loose, Object may be an embedded object or an id
+type Activity struct {
+	Context any             `json:"@context,omitempty"`
+	ID      string          `json:"id"`
+	Type    string          `json:"type"`
+	Actor   string          `json:"actor"`
+	Object  json.RawMessage `json:"object"`
+	To      []string        `json:"to,omitempty"`
+	Cc      []string        `json:"cc,omitempty"`
+}
+
+// ObjectID returns the id of the activity object whether it was embedded
+// or referenced
+func (a *Activity) ObjectID() string {
+	var id string
+	if err := json.Unmarshal(a.Object, &id); err == nil {
+		return id
+	}
+
+	var object struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(a.Object, &object); err == nil {
+		return object.ID
+	}
+
+	return ""
+}
+
+// EmbeddedActivity decodes the object as an activity, e.g. the Follow in an Undo
+func (a *Activity) EmbeddedActivity() (*Activity, error) {
+	var inner Activity
+	if err := json.Unmarshal(a.Object, &inner); err != nil {
+		return nil, ErrUnsupported
+	}
+
+	return &inner, nil
+}
+
+type Note struct {
+	Context      any      `json:"@context,omitempty"`
+	ID           string   `json:"id"`
+	Type         string   `json:"type"`
+	AttributedTo string   `json:"attributedTo"`
+	Content      string   `json:"content"`
+	Published    string   `json:"published"`
+	URL          string   `json:"url,omitempty"`
+	To           []string `json:"to"`
+	Cc           []string `json:"cc,omitempty"`
+	Tag          []Tag    `json:"tag,omitempty"`
+}
+
+type Tag struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+type OrderedCollection struct {
+	Context      any    `json:"@context,omitempty"`
+	ID           string `json:"id"`
+	Type         string `json:"type"`
+	TotalItems   int    `json:"totalItems"`
+	OrderedItems []any  `json:"orderedItems,omitempty"`
+}
+
+// WebFinger is the JRD document served from /.well-known/webfinger
+type WebFinger struct {
+	Subject string          `json:"subject"`
+	Aliases []string        `json:"aliases,omitempty"`
+	Links   []WebFingerLink `json:"links"`
+}
+
+type WebFingerLink struct {
+	Rel  string `json:"rel"`
+	Type string `json:"type,omitempty"`
+	Href string `json:"href"`
+}
+
+func NewActor(id, username, url, publicKeyPem string) *Actor {
+	return &Actor{
+		Context:           []string{activityStreams, securityV1},
+		ID:                id,
+		Type:              "Person",
+		PreferredUsername: username,
+		Name:              username,
+		URL:               url,
+		Inbox:             id + "/inbox",
+		Outbox:            id + "/outbox",
+		Followers:         id + "/followers",
+		PublicKey: PublicKey{
+			ID:           id + "#main-key",
+			Owner:        id,
+			PublicKeyPem: publicKeyPem,
+		},
+	}
+}
+
+func NewActivity(id, kind, actor string, object any, to ...string) (*Activity, error) {
+	raw, err := json.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Activity{
+		Context: activityStreams,
+		ID:      id,
+		Type:    kind,
+		Actor:   actor,
+		Object:  raw,
+		To:      to,
+	}, nil
+}
+
+func NewOrderedCollection(id string, items []any) *OrderedCollection {
+	return &OrderedCollection{
+		Context:      activityStreams,
+		ID:           id,
+		Type:         "OrderedCollection",
+		TotalItems:   len(items),
+		OrderedItems: items,
+	}
+}
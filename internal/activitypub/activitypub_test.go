@@ -0,0 +1,179 @@
+package activitypub
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+// standIn is a local remote server publishing one actor and an inbox that
+// verifies signatures the way the app does
+type standIn struct {
+	server   *httptest.Server
+	client   *Client
+	actor    *Actor
+	key      *rsa.PrivateKey
+	received chan *Activity
+	verified chan error
+}
+
+func newStandIn(t *testing.T) *standIn {
+	t.Helper()
+
+	privatePem, publicPem, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ParsePrivateKey(privatePem)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &standIn{
+		client:   NewLocalClient(5 * time.Second),
+		key:      key,
+		received: make(chan *Activity, 1),
+		verified: make(chan error, 1),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users/alice", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		json.NewEncoder(w).Encode(s.actor)
+	})
+	mux.HandleFunc("/users/alice/inbox", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		_, err := Verify(r, body, func(keyID string) (*rsa.PublicKey, error) {
+			_, key, err := s.client.FetchKey(r.Context(), keyID)
+			return key, err
+		})
+		s.verified <- err
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var activity Activity
+		json.Unmarshal(body, &activity)
+		s.received <- &activity
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	s.server = httptest.NewServer(mux)
+	t.Cleanup(s.server.Close)
+
+	s.actor = NewActor(s.server.URL+"/users/alice", "alice", "", publicPem)
+
+	return s
+}
+
+func TestDeliverSignedActivity(t *testing.T) {
+	s := newStandIn(t)
+
+	follow, err := NewActivity(s.server.URL+"/follows/1", "Follow", s.actor.ID, "https://social.test/ap/users/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.client.Deliver(context.Background(), s.actor.Inbox, follow, s.actor.PublicKey.ID, s.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := <-s.verified; err != nil {
+		t.Fatalf("expected a valid signature. Got %v", err)
+	}
+
+	got := <-s.received
+	if got.Type != "Follow" || got.ObjectID() != "https://social.test/ap/users/1" {
+		t.Errorf("unexpected activity %+v", got)
+	}
+}
+
+func TestVerifyRejectsTamperedBody(t *testing.T) {
+	s := newStandIn(t)
+
+	req := httptest.NewRequest(http.MethodPost, "https://social.test/ap/users/1/inbox", nil)
+	if err := Sign(req, []byte(`{"type":"Follow"}`), s.actor.PublicKey.ID, s.key); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := Verify(req, []byte(`{"type":"Undo"}`), func(keyID string) (*rsa.PublicKey, error) {
+		_, key, err := s.client.FetchKey(context.Background(), keyID)
+		return key, err
+	})
+	if err == nil {
+		t.Fatal("expected a tampered body to be rejected")
+	}
+}
+
+func TestVerifyRejectsUnknownKey(t *testing.T) {
+	s := newStandIn(t)
+	other := newStandIn(t)
+
+	req := httptest.NewRequest(http.MethodPost, "https://social.test/ap/users/1/inbox", nil)
+	body := []byte(`{"type":"Follow"}`)
+
+	// signed with one key but claiming the other actor's key id
+	if err := Sign(req, body, other.actor.PublicKey.ID, s.key); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := Verify(req, body, func(keyID string) (*rsa.PublicKey, error) {
+		_, key, err := s.client.FetchKey(context.Background(), keyID)
+		return key, err
+	})
+	if err != ErrInvalidSignature {
+		t.Fatalf("expected %v. Got %v", ErrInvalidSignature, err)
+	}
+}
+
+func TestClientRefusesLocalAddresses(t *testing.T) {
+	s := newStandIn(t)
+	tls := httptest.NewTLSServer(http.NotFoundHandler())
+	t.Cleanup(tls.Close)
+
+	client := NewClient(5 * time.Second)
+
+	for _, url := range []string{s.actor.ID, tls.URL + "/users/alice", "file:///etc/passwd"} {
+		if _, err := client.FetchActor(context.Background(), url); !errors.Is(err, ErrForbiddenAddress) {
+			t.Errorf("FetchActor(%s) error = %v, want %v", url, err, ErrForbiddenAddress)
+		}
+	}
+}
+
+func TestPublicAddress(t *testing.T) {
+	tests := []struct {
+		addr   string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:4700::1111", true},
+		{"127.0.0.1", false},
+		{"10.0.0.1", false},
+		{"172.16.5.4", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"::1", false},
+		{"fd00::1", false},
+		{"fe80::1", false},
+		{"::ffff:127.0.0.1", false},
+	}
+
+	for _, tt := range tests {
+		if got := PublicAddress(netip.MustParseAddr(tt.addr)); got != tt.public {
+			t.Errorf("PublicAddress(%s) = %v, want %v", tt.addr, got, tt.public)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package activitypub
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// maxResponseBytes caps documents read from remote servers
+const maxResponseBytes = 1 << 20
+
+// maxRedirects bounds the redirects followed for one request
+const maxRedirects = 5
+
+var ErrForbiddenAddress = errors.New("remote address not allowed")
+
+// reservedPrefixes are the ranges that aren't on the internet besides
+// private, loopback and link-local ones
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+// Client talks to remote servers on behalf of requests anyone can send, so
+// it only reaches public addresses over https
+type Client struct {
+	http  *http.Client
+	local bool
+}
+
+func NewClient(timeout time.Duration) *Client {
+	// the address is checked once resolved, right before connecting, so a
+	// name can't resolve to a public address first and a private one next
+	dialer := &net.Dialer{Timeout: timeout, Control: checkAddress}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &Client{
+		http: &http.Client{
+			Timeout:       timeout,
+			Transport:     transport,
+			CheckRedirect: checkRedirect,
+		},
+	}
+}
+
+// NewLocalClient reaches any address over http or https, for tests and
+// instances federating on a private network
+func NewLocalClient(timeout time.Duration) *Client {
+	return &Client{
+		http:  &http.Client{Timeout: timeout},
+		local: true,
+	}
+}
+
+// PublicAddress reports whether addr is routed on the internet
+func PublicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func checkAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+
+	if !PublicAddress(addr) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, addr)
+	}
+
+	return nil
+}
+
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+
+	return checkScheme(req.URL)
+}
+
+func checkScheme(u *url.URL) error {
+	if u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("%w: %s is not an https url", ErrForbiddenAddress, u.Redacted())
+	}
+
+	return nil
+}
+
+// newRequest builds a request to a remote url, which has to be https
+// unless the client is local
+func (c *Client) newRequest(ctx context.Context, method, rawURL string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if !c.local {
+		if err := checkScheme(req.URL); err != nil {
+			return nil, err
+		}
+	}
+
+	return req, nil
+}
+
+// FetchActor retrieves a remote actor document, keyID may include a fragment
+func (c *Client) FetchActor(ctx context.Context, actorID string) (*Actor, error) {
+	actorID, _, _ = strings.Cut(actorID, "#")
+
+	req, err := c.newRequest(ctx, http.MethodGet, actorID, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", ContentType)
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching actor %s: status %d", actorID, res.StatusCode)
+	}
+
+	if res.ContentLength > maxResponseBytes {
+		return nil, fmt.Errorf("fetching actor %s: document too large", actorID)
+	}
+
+	var actor Actor
+	if err := json.NewDecoder(io.LimitReader(res.Body, maxResponseBytes)).Decode(&actor); err != nil {
+		return nil, err
+	}
+
+	if actor.ID != actorID {
+		return nil, fmt.Errorf("fetching actor %s: got id %s", actorID, actor.ID)
+	}
+
+	return &actor, nil
+}
+
+// FetchKey resolves the public key of a signature key id
+func (c *Client) FetchKey(ctx context.Context, keyID string) (*Actor, *rsa.PublicKey, error) {
+	actor, err := c.FetchActor(ctx, keyID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if actor.PublicKey.ID != keyID && actor.ID != keyID {
+		return nil, nil, fmt.Errorf("%w: key %s not published by %s", ErrInvalidSignature, keyID, actor.ID)
+	}
+
+	key, err := ParsePublicKey(actor.PublicKey.PublicKeyPem)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return actor, key, nil
+}
+
+// Deliver posts a signed activity to a remote inbox
+func (c *Client) Deliver(ctx context.Context, inbox string, activity any, keyID string, key *rsa.PrivateKey) error {
+	body, err := json.Marshal(activity)
+	if err != nil {
+		return err
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, inbox, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", ContentType)
+
+	if err := Sign(req, body, keyID, key); err != nil {
+		return err
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("delivering to %s: status %d", inbox, res.StatusCode)
+	}
+
+	return nil
+}
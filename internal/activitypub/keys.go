@@ -0,0 +1,150 @@
+package activitypub
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"sync"
+	"time"
+)
+
+const keySize = 2048
+
+var ErrInvalidKey = errors.New("invalid key")
+
+// GenerateKey returns a new RSA key pair encoded as PEM, the format actor
+// documents publish their keys in
+func GenerateKey() (privatePem, publicPem string, err error) {
+	key, err := rsa.GenerateKey(rand.Reader, keySize)
+	if err != nil {
+		return "", "", err
+	}
+
+	private, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", "", err
+	}
+
+	public, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	privatePem = string(pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: private,
+	}))
+	publicPem = string(pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: public,
+	}))
+
+	return privatePem, publicPem, nil
+}
+
+// KeyCache keeps the actors and public keys resolved from signature key ids
+// for ttl, so inboxes don't fetch the actor document of every request
+type KeyCache struct {
+	sync.Mutex
+	ttl  time.Duration
+	keys map[string]cachedKey
+}
+
+type cachedKey struct {
+	actor     *Actor
+	key       *rsa.PublicKey
+	expiresAt time.Time
+}
+
+func NewKeyCache(ttl time.Duration) *KeyCache {
+	return &KeyCache{ttl: ttl, keys: make(map[string]cachedKey)}
+}
+
+// Get returns the actor and key cached for keyID, ok is false when there is
+// none or it expired
+func (k *KeyCache) Get(keyID string) (*Actor, *rsa.PublicKey, bool) {
+	k.Lock()
+	defer k.Unlock()
+
+	cached, ok := k.keys[keyID]
+	if !ok || time.Now().After(cached.expiresAt) {
+		return nil, nil, false
+	}
+
+	return cached.actor, cached.key, true
+}
+
+func (k *KeyCache) Set(keyID string, actor *Actor, key *rsa.PublicKey) {
+	if k.ttl <= 0 {
+		return
+	}
+
+	k.Lock()
+	defer k.Unlock()
+
+	k.sweep()
+	k.keys[keyID] = cachedKey{actor: actor, key: key, expiresAt: time.Now().Add(k.ttl)}
+}
+
+func (k *KeyCache) Delete(keyID string) {
+	k.Lock()
+	defer k.Unlock()
+
+	delete(k.keys, keyID)
+}
+
+// sweep drops the keys that expired, the lock must be held
+func (k *KeyCache) sweep() {
+	now := time.Now()
+
+	for keyID, cached := range k.keys {
+		if now.After(cached.expiresAt) {
+			delete(k.keys, keyID)
+		}
+	}
+}
+
+func ParsePrivateKey(privatePem string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(privatePem))
+	if block == nil {
+		return nil, ErrInvalidKey
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, ErrInvalidKey
+	}
+
+	return rsaKey, nil
+}
+
+func ParsePublicKey(publicPem string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(publicPem))
+	if block == nil {
+		return nil, ErrInvalidKey
+	}
+
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return nil, ErrInvalidKey
+		}
+
+		return rsaKey, nil
+	}
+}
@@ -0,0 +1,162 @@
+package activitypub
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// MaxClockSkew bounds how far the Date of a signed request may drift
+const MaxClockSkew = time.Hour
+
+var (
+	ErrMissingSignature = errors.New("missing http signature")
+	ErrInvalidSignature = errors.New("invalid http signature")
+)
+
+// signedHeaders are the headers covered by outgoing signatures, the set
+// Mastodon requires for POSTs
+var signedHeaders = []string{"(request-target)", "host", "date", "digest"}
+
+// Sign adds Date, Digest and a draft-cavage HTTP Signature header to req
+func Sign(req *http.Request, body []byte, keyID string, key *rsa.PrivateKey) error {
+	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("Digest", digest(body))
+	if req.Host == "" {
+		req.Host = req.URL.Host
+	}
+
+	hash := sha256.Sum256([]byte(signingString(req, signedHeaders)))
+	sig, err := rsa.SignPKCS1v15(nil, key, crypto.SHA256, hash[:])
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Signature", fmt.Sprintf(
+		`keyId="%s",algorithm="rsa-sha256",headers="%s",signature="%s"`,
+		keyID,
+		strings.Join(signedHeaders, " "),
+		base64.StdEncoding.EncodeToString(sig),
+	))
+
+	return nil
+}
+
+// KeyFetcher resolves the key id of a signature to the signer's public key
+type KeyFetcher func(keyID string) (*rsa.PublicKey, error)
+
+// Verify checks the signature of an incoming request and its body digest,
+// returning the id of the key that signed it
+func Verify(req *http.Request, body []byte, fetch KeyFetcher) (string, error) {
+	header := req.Header.Get("Signature")
+	if header == "" {
+		return "", ErrMissingSignature
+	}
+
+	params := parseSignature(header)
+	keyID, sig := params["keyId"], params["signature"]
+	if keyID == "" || sig == "" {
+		return "", ErrInvalidSignature
+	}
+
+	if alg := params["algorithm"]; alg != "" && alg != "rsa-sha256" && alg != "hs2019" {
+		return "", fmt.Errorf("%w: unsupported algorithm %s", ErrInvalidSignature, alg)
+	}
+
+	headers := strings.Fields(strings.ToLower(params["headers"]))
+	if len(headers) == 0 {
+		headers = []string{"date"}
+	}
+
+	for _, required := range []string{"(request-target)", "host", "date"} {
+		if !contains(headers, required) {
+			return "", fmt.Errorf("%w: %s is not signed", ErrInvalidSignature, required)
+		}
+	}
+
+	date, err := http.ParseTime(req.Header.Get("Date"))
+	if err != nil {
+		return "", fmt.Errorf("%w: bad date", ErrInvalidSignature)
+	}
+
+	if d := time.Since(date); d > MaxClockSkew || d < -MaxClockSkew {
+		return "", fmt.Errorf("%w: date out of range", ErrInvalidSignature)
+	}
+
+	if len(body) > 0 {
+		if !contains(headers, "digest") || req.Header.Get("Digest") != digest(body) {
+			return "", fmt.Errorf("%w: digest mismatch", ErrInvalidSignature)
+		}
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		return "", ErrInvalidSignature
+	}
+
+	key, err := fetch(keyID)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256([]byte(signingString(req, headers)))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], raw); err != nil {
+		return "", ErrInvalidSignature
+	}
+
+	return keyID, nil
+}
+
+func signingString(req *http.Request, headers []string) string {
+	lines := make([]string, 0, len(headers))
+	for _, h := range headers {
+		var value string
+		switch h {
+		case "(request-target)":
+			value = strings.ToLower(req.Method) + " " + req.URL.RequestURI()
+		case "host":
+			value = req.Host
+		default:
+			value = req.Header.Get(h)
+		}
+
+		lines = append(lines, h+": "+value)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func parseSignature(header string) map[string]string {
+	params := make(map[string]string)
+	for _, part := range strings.Split(header, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+
+		params[k] = strings.Trim(v, `"`)
+	}
+
+	return params
+}
+
+func digest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "SHA-256=" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -7,4 +7,5 @@ import (
 type Authenticator interface {
 	GenerateToken(claims jwt.Claims) (string, error)
 	ValidateToken(token string) (*jwt.Token, error)
+	JWKS() JWKS
 }
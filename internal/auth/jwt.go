@@ -1,26 +1,81 @@
 package auth
 
 import (
+	"errors"
 	"fmt"
+	"slices"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+var (
+	ErrNoSigningKey = errors.New("signing key has no private key")
+	ErrSharedSecret = errors.New("shared secrets can't be mixed with key pairs")
+)
+
+// JWTAuthenticator signs tokens with one key and verifies them with any of
+// its keys, picked by the kid header
 type JWTAuthenticator struct {
-	secret string
-	aud    string
-	iss    string
+	signing *Key
+	keys    map[string]*Key
+	methods []string
+	aud     string
+	iss     string
 }
 
+// NewJWTAuthenticator signs and verifies with HS256 and a shared secret.
+// Other services can't verify such tokens, it is meant for development.
 func NewJWTAuthenticator(secret, aud, iss string) *JWTAuthenticator {
-	return &JWTAuthenticator{secret, aud, iss}
+	key := NewHMACKey(secret)
+
+	return &JWTAuthenticator{
+		signing: key,
+		keys:    map[string]*Key{key.ID: key},
+		methods: []string{key.Method.Alg()},
+		aud:     aud,
+		iss:     iss,
+	}
+}
+
+// NewKeyAuthenticator signs with signing and verifies with it and the keys
+// in verify, the rotated out keys whose tokens may still be alive or the
+// keys of the next rotation
+func NewKeyAuthenticator(signing *Key, verify []*Key, aud, iss string) (*JWTAuthenticator, error) {
+	if !signing.CanSign() {
+		return nil, ErrNoSigningKey
+	}
+
+	a := &JWTAuthenticator{
+		signing: signing,
+		keys:    make(map[string]*Key),
+		aud:     aud,
+		iss:     iss,
+	}
+
+	for _, key := range append([]*Key{signing}, verify...) {
+		if key.isHMAC() {
+			return nil, ErrSharedSecret
+		}
+		if _, ok := a.keys[key.ID]; ok {
+			continue
+		}
+
+		a.keys[key.ID] = key
+		if !slices.Contains(a.methods, key.Method.Alg()) {
+			a.methods = append(a.methods, key.Method.Alg())
+		}
+	}
+
+	return a, nil
 }
 
 func (a *JWTAuthenticator) GenerateToken(claims jwt.Claims) (string, error) {
-	// NewWithClaims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	// SignedString
-	tokenString, err := token.SignedString([]byte(a.secret))
+	token := jwt.NewWithClaims(a.signing.Method, claims)
+	if a.signing.ID != "" {
+		token.Header["kid"] = a.signing.ID
+	}
+
+	tokenString, err := token.SignedString(a.signing.sign)
 	if err != nil {
 		return "", err
 	}
@@ -30,15 +85,48 @@ func (a *JWTAuthenticator) GenerateToken(claims jwt.Claims) (string, error) {
 
 func (a *JWTAuthenticator) ValidateToken(token string) (*jwt.Token, error) {
 	return jwt.Parse(token, func(t *jwt.Token) (any, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+		kid, _ := t.Header["kid"].(string)
+		key, ok := a.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key %q", kid)
+		}
+
+		// the key decides the algorithm, never the token
+		if t.Method.Alg() != key.Method.Alg() {
 			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
 		}
 
-		return []byte(a.secret), nil
+		return key.verify, nil
 	},
 		jwt.WithExpirationRequired(),
 		jwt.WithAudience(a.aud),
 		jwt.WithIssuer(a.iss),
-		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}),
+		jwt.WithValidMethods(a.methods),
 	)
 }
+
+// JWKS lists the public keys tokens are verified with, the signing key
+// first. It is empty with a shared secret.
+func (a *JWTAuthenticator) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+
+	if jwk, ok := a.signing.JWK(); ok {
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	ids := make([]string, 0, len(a.keys))
+	for id := range a.keys {
+		if id != a.signing.ID {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+
+	for _, id := range ids {
+		if jwk, ok := a.keys[id].JWK(); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+
+	return set
+}
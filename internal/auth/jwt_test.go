@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func testClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"aud": "test-aud",
+		"iss": "test-aud",
+		"sub": int64(1),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func writePEM(t *testing.T, typ string, der []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func newEdKey(t *testing.T) (*Key, ed25519.PublicKey) {
+	t.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := LoadKeyFile(writePEM(t, "PRIVATE KEY", der))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key, pub
+}
+
+func TestKeyAuthenticator(t *testing.T) {
+	rsaPriv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := LoadKeyFile(writePEM(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaPriv)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	edKey, _ := newEdKey(t)
+
+	for _, key := range []*Key{rsaKey, edKey} {
+		t.Run(key.Method.Alg(), func(t *testing.T) {
+			a, err := NewKeyAuthenticator(key, nil, "test-aud", "test-aud")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			token, err := a.GenerateToken(testClaims())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			parsed, err := a.ValidateToken(token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.Header["kid"] != key.ID {
+				t.Errorf("kid = %v, want %s", parsed.Header["kid"], key.ID)
+			}
+
+			set := a.JWKS()
+			if len(set.Keys) != 1 || set.Keys[0].Kid != key.ID || set.Keys[0].Alg != key.Method.Alg() {
+				t.Errorf("JWKS() = %+v", set)
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	oldKey, oldPub := newEdKey(t)
+	newKey, _ := newEdKey(t)
+
+	oldAuth, err := NewKeyAuthenticator(oldKey, nil, "test-aud", "test-aud")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := oldAuth.GenerateToken(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the rotated out key is only known by its public half
+	der, err := x509.MarshalPKIXPublicKey(oldPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldPublic, err := LoadKeyFile(writePEM(t, "PUBLIC KEY", der))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if oldPublic.ID != oldKey.ID {
+		t.Fatalf("public key id = %s, want %s", oldPublic.ID, oldKey.ID)
+	}
+	if _, err := NewKeyAuthenticator(oldPublic, nil, "test-aud", "test-aud"); err != ErrNoSigningKey {
+		t.Errorf("signing with a public key error = %v, want %v", err, ErrNoSigningKey)
+	}
+
+	rotated, err := NewKeyAuthenticator(newKey, []*Key{oldPublic}, "test-aud", "test-aud")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rotated.ValidateToken(token); err != nil {
+		t.Errorf("token of the rotated out key: %v", err)
+	}
+	if set := rotated.JWKS(); len(set.Keys) != 2 || set.Keys[0].Kid != newKey.ID {
+		t.Errorf("JWKS() = %+v", set)
+	}
+
+	retired, err := NewKeyAuthenticator(newKey, nil, "test-aud", "test-aud")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := retired.ValidateToken(token); err == nil {
+		t.Error("token of a retired key was accepted")
+	}
+}
+
+func TestRejectAlgorithmConfusion(t *testing.T) {
+	key, pub := newEdKey(t)
+
+	a, err := NewKeyAuthenticator(key, nil, "test-aud", "test-aud")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// HS256 signed with the public key, under the kid of the key pair
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+	forged.Header["kid"] = key.ID
+	token, err := forged.SignedString([]byte(pub))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := a.ValidateToken(token); err == nil {
+		t.Error("HS256 token was accepted by a key pair")
+	}
+
+	if _, err := NewKeyAuthenticator(key, []*Key{NewHMACKey("example")}, "test-aud", "test-aud"); err != ErrSharedSecret {
+		t.Errorf("mixing a shared secret error = %v, want %v", err, ErrSharedSecret)
+	}
+}
+
+func TestSharedSecret(t *testing.T) {
+	a := NewJWTAuthenticator("example", "test-aud", "test-aud")
+
+	token, err := a.GenerateToken(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := a.ValidateToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := parsed.Header["kid"]; ok {
+		t.Error("shared secret tokens should have no kid")
+	}
+
+	if set := a.JWKS(); len(set.Keys) != 0 {
+		t.Errorf("shared secret was published: %+v", set)
+	}
+}
@@ -12,6 +12,8 @@ var mockClaims = jwt.MapClaims{
 	"aud": "test-aud",
 	"iss": "test-aud",
 	"sub": int64(1),
+	"jti": "test-jti",
+	"iat": time.Now().Unix(),
 	"exp": time.Now().Add(time.Hour).Unix(),
 }
 
@@ -31,3 +33,7 @@ func (a *mockAuth) ValidateToken(token string) (*jwt.Token, error) {
 		return []byte(secret), nil
 	})
 }
+
+func (a *mockAuth) JWKS() JWKS {
+	return JWKS{Keys: []JWK{}}
+}
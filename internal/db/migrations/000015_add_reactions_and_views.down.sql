@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS reactions;
+
+ALTER TABLE posts
+    DROP COLUMN views;
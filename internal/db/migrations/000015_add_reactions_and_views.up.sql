@@ -0,0 +1,13 @@
+ALTER TABLE posts
+    ADD COLUMN views bigint NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS reactions (
+    post_id bigint NOT NULL,
+    user_id bigint NOT NULL,
+    reaction varchar(20) NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (post_id, user_id),
+    FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
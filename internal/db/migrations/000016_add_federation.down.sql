@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS remote_followers;
+
+DROP TABLE IF EXISTS actor_keys;
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS actor_keys (
+    user_id bigint PRIMARY KEY,
+    public_key text NOT NULL,
+    private_key text NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS remote_followers (
+    user_id bigint NOT NULL,
+    actor_id text NOT NULL,
+    inbox text NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (user_id, actor_id),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
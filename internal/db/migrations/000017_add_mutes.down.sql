@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS muted_keywords;
+
+DROP TABLE IF EXISTS muted_users;
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS muted_users (
+    user_id bigint NOT NULL,
+    muted_user_id bigint NOT NULL,
+    expires_at timestamp(0) with time zone,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (user_id, muted_user_id),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (muted_user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS muted_keywords (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    keyword varchar(100) NOT NULL,
+    is_regex boolean NOT NULL DEFAULT false,
+    expires_at timestamp(0) with time zone,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_muted_keywords_user_id ON muted_keywords (user_id);
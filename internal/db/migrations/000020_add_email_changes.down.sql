@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS email_reverts;
+DROP TABLE IF EXISTS email_changes;
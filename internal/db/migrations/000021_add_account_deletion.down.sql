@@ -0,0 +1,15 @@
+ALTER TABLE user_invitations
+    DROP CONSTRAINT IF EXISTS fk_user_invitations_user;
+
+ALTER TABLE comments
+    DROP CONSTRAINT IF EXISTS fk_comments_user,
+    DROP CONSTRAINT IF EXISTS fk_comments_post;
+
+ALTER TABLE posts
+    DROP CONSTRAINT IF EXISTS fk_user,
+    ADD CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users (id);
+
+DROP INDEX IF EXISTS idx_users_delete_after;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS delete_after;
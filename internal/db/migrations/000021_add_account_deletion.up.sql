@@ -0,0 +1,25 @@
+ALTER TABLE users
+    ADD COLUMN delete_after timestamp(0) with time zone;
+
+CREATE INDEX IF NOT EXISTS idx_users_delete_after ON users (delete_after)
+    WHERE delete_after IS NOT NULL;
+
+-- content goes with its author, comments and invitations had no foreign
+-- keys at all so rows left behind by earlier deletes are dropped first
+ALTER TABLE posts
+    DROP CONSTRAINT IF EXISTS fk_user,
+    ADD CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+
+DELETE FROM comments c
+WHERE NOT EXISTS (SELECT 1 FROM posts p WHERE p.id = c.post_id)
+    OR NOT EXISTS (SELECT 1 FROM users u WHERE u.id = c.user_id);
+
+ALTER TABLE comments
+    ADD CONSTRAINT fk_comments_post FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
+    ADD CONSTRAINT fk_comments_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+
+DELETE FROM user_invitations ui
+WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.id = ui.user_id);
+
+ALTER TABLE user_invitations
+    ADD CONSTRAINT fk_user_invitations_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS users_username_skeleton_key;
+
+ALTER TABLE users DROP COLUMN IF EXISTS username_lookalike;
+ALTER TABLE users DROP COLUMN IF EXISTS username_skeleton;
+
+ALTER TABLE users ALTER COLUMN username TYPE varchar(255);
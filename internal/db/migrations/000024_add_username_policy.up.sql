@@ -0,0 +1,12 @@
+-- usernames compare case insensitively, this fails while two accounts
+-- still differ only by case and they have to be renamed first
+ALTER TABLE users ALTER COLUMN username TYPE citext;
+
+-- the skeletons of existing users are filled in by the application with
+-- username.Skeleton when it starts, lookalikes of an older account stay
+-- NULL and are covered by its skeleton. They are flagged so the backfill
+-- doesn't look at them again on the next start.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS username_skeleton varchar(255);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS username_lookalike boolean NOT NULL DEFAULT false;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_username_skeleton_key ON users (username_skeleton);
@@ -0,0 +1,16 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS username_changed_at timestamp(0) with time zone;
+
+CREATE TABLE IF NOT EXISTS username_history (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    username citext NOT NULL,
+    username_skeleton varchar(255) NOT NULL,
+    changed_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    held_until timestamp(0) with time zone NOT NULL,
+
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_username_history_user_id ON username_history (user_id);
+CREATE INDEX IF NOT EXISTS idx_username_history_username ON username_history (username);
+CREATE INDEX IF NOT EXISTS idx_username_history_username_skeleton ON username_history (username_skeleton);
@@ -40,4 +40,18 @@ func GetBool(key string, fallback bool) bool {
 	}
 
 	return boolVal
-}
\ No newline at end of file
+}
+
+func GetFloat(key string, fallback float64) float64 {
+	val, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+
+	floatVal, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return fallback
+	}
+
+	return floatVal
+}
@@ -6,6 +6,9 @@ const (
 	FromName = "GopherSocial"
 	maxRetries = 3
 	UserWelcomeTemplate = "user_invitation.tmpl"
+	PasswordResetTemplate = "password_reset.tmpl"
+	EmailChangeTemplate = "email_change.tmpl"
+	EmailChangedTemplate = "email_changed.tmpl"
 )
 
 //go:embed "templates" 
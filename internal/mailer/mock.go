@@ -0,0 +1,11 @@
+package mailer
+
+type mockClient struct{}
+
+func NewMockClient() *mockClient {
+	return &mockClient{}
+}
+
+func (m *mockClient) Send(templateFile, username, email string, data any, isSandbox bool) (int, error) {
+	return 200, nil
+}
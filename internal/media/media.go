@@ -0,0 +1,12 @@
+package media
+
+import (
+	"context"
+	"io"
+)
+
+// Store keeps uploaded files and returns the public url they are served at
+type Store interface {
+	Put(c context.Context, name string, r io.Reader) (string, error)
+	Delete(c context.Context, url string) error
+}
@@ -0,0 +1,305 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// UserExport is everything a user has put into the service, as handed out
+// by the data export
+type UserExport struct {
+	Profile   *User
+	Posts     []ExportedPost
+	Comments  []ExportedComment
+	Following []ExportedFollow
+	Followers []ExportedFollow
+	Reactions []Reaction
+}
+
+type ExportedPost struct {
+	ID        int64    `json:"id"`
+	Title     string   `json:"title"`
+	Content   string   `json:"content"`
+	Tags      []string `json:"tags"`
+	CreatedAt string   `json:"created_at"`
+	UpdatedAt string   `json:"updated_at"`
+}
+
+type ExportedComment struct {
+	ID        int64  `json:"id"`
+	PostID    int64  `json:"post_id"`
+	Content   string `json:"content"`
+	CreatedAt string `json:"created_at"`
+}
+
+type ExportedFollow struct {
+	UserID    int64  `json:"user_id"`
+	Username  string `json:"username"`
+	CreatedAt string `json:"created_at"`
+}
+
+// Export collects the data of userID from a single snapshot
+func (s *UserStore) Export(c context.Context, userID int64) (*UserExport, error) {
+	tx, err := s.db.BeginTx(c, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	// empty lists rather than null in the exported files
+	export := UserExport{
+		Profile:   &User{},
+		Posts:     []ExportedPost{},
+		Comments:  []ExportedComment{},
+		Following: []ExportedFollow{},
+		Followers: []ExportedFollow{},
+		Reactions: []Reaction{},
+	}
+
+	query := `
+		SELECT id, username, email, created_at, display_name, bio, avatar_url, location, website
+		FROM users WHERE id = $1;
+	`
+	p := export.Profile
+	err = tx.QueryRowContext(c, query, userID).Scan(
+		&p.ID, &p.Username, &p.Email, &p.CreatedAt,
+		&p.DisplayName, &p.Bio, &p.AvatarURL, &p.Location, &p.Website,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	query = `
+		SELECT id, title, content, tags, created_at, updated_at
+		FROM posts WHERE user_id = $1 ORDER BY id;
+	`
+	err = queryRows(c, tx, query, userID, func(rows *sql.Rows) error {
+		var p ExportedPost
+		if err := rows.Scan(&p.ID, &p.Title, &p.Content, pq.Array(&p.Tags), &p.CreatedAt, &p.UpdatedAt); err != nil {
+			return err
+		}
+		export.Posts = append(export.Posts, p)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	query = `SELECT id, post_id, content, created_at FROM comments WHERE user_id = $1 ORDER BY id;`
+	err = queryRows(c, tx, query, userID, func(rows *sql.Rows) error {
+		var cm ExportedComment
+		if err := rows.Scan(&cm.ID, &cm.PostID, &cm.Content, &cm.CreatedAt); err != nil {
+			return err
+		}
+		export.Comments = append(export.Comments, cm)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT u.id, u.username, f.created_at FROM followers f
+		JOIN users u ON u.id = f.user_id
+		WHERE f.follower_id = $1 ORDER BY f.created_at;
+	`
+	err = queryRows(c, tx, query, userID, func(rows *sql.Rows) error {
+		var f ExportedFollow
+		if err := rows.Scan(&f.UserID, &f.Username, &f.CreatedAt); err != nil {
+			return err
+		}
+		export.Following = append(export.Following, f)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT u.id, u.username, f.created_at FROM followers f
+		JOIN users u ON u.id = f.follower_id
+		WHERE f.user_id = $1 ORDER BY f.created_at;
+	`
+	err = queryRows(c, tx, query, userID, func(rows *sql.Rows) error {
+		var f ExportedFollow
+		if err := rows.Scan(&f.UserID, &f.Username, &f.CreatedAt); err != nil {
+			return err
+		}
+		export.Followers = append(export.Followers, f)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	query = `SELECT post_id, user_id, reaction, created_at FROM reactions WHERE user_id = $1 ORDER BY created_at;`
+	err = queryRows(c, tx, query, userID, func(rows *sql.Rows) error {
+		var r Reaction
+		if err := rows.Scan(&r.PostID, &r.UserID, &r.Reaction, &r.CreatedAt); err != nil {
+			return err
+		}
+		export.Reactions = append(export.Reactions, r)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &export, nil
+}
+
+func queryRows(c context.Context, tx *sql.Tx, query string, arg any, scan func(*sql.Rows) error) error {
+	rows, err := tx.QueryContext(c, query, arg)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// ScheduleDeletion marks the account of userID for removal once at has
+// passed and revokes its refresh tokens, so only logging in again keeps it
+func (s *UserStore) ScheduleDeletion(c context.Context, userID int64, at time.Time) error {
+	query := `
+		WITH revoked AS (
+			DELETE FROM refresh_tokens WHERE user_id = $2
+		)
+		UPDATE users SET delete_after = $1 WHERE id = $2 AND is_active = true;
+	`
+
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(c, query, at, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// CancelDeletion keeps the account of userID
+func (s *UserStore) CancelDeletion(c context.Context, userID int64) error {
+	query := `UPDATE users SET delete_after = NULL WHERE id = $1;`
+
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(c, query, userID)
+	return err
+}
+
+// anonymizeQueries strip an account down to a placeholder that still owns
+// its posts and comments
+var anonymizeQueries = []string{
+	`UPDATE users SET
+		username = 'deleted-' || id, username_skeleton = NULL, email = 'deleted-' || id || '@invalid', password = '',
+		display_name = '', bio = '', avatar_url = '', location = '', website = '',
+		is_private = false, is_active = false, delete_after = NULL
+	WHERE id = ANY($1);`,
+	`DELETE FROM followers WHERE user_id = ANY($1) OR follower_id = ANY($1);`,
+	`DELETE FROM follow_requests WHERE user_id = ANY($1) OR follower_id = ANY($1);`,
+	`DELETE FROM reactions WHERE user_id = ANY($1);`,
+	`DELETE FROM muted_users WHERE user_id = ANY($1) OR muted_user_id = ANY($1);`,
+	`DELETE FROM muted_keywords WHERE user_id = ANY($1);`,
+	`DELETE FROM blocks WHERE user_id = ANY($1) OR blocked_user_id = ANY($1);`,
+	`DELETE FROM actor_keys WHERE user_id = ANY($1);`,
+	`DELETE FROM remote_followers WHERE user_id = ANY($1);`,
+	`DELETE FROM user_invitations WHERE user_id = ANY($1);`,
+	`DELETE FROM password_resets WHERE user_id = ANY($1);`,
+	`DELETE FROM email_changes WHERE user_id = ANY($1);`,
+	`DELETE FROM email_reverts WHERE user_id = ANY($1);`,
+	`DELETE FROM username_history WHERE user_id = ANY($1);`,
+	`DELETE FROM refresh_tokens WHERE user_id = ANY($1);`,
+	`DELETE FROM user_totp WHERE user_id = ANY($1);`,
+	`DELETE FROM recovery_codes WHERE user_id = ANY($1);`,
+	`DELETE FROM two_factor_challenges WHERE user_id = ANY($1);`,
+}
+
+// PurgeDeleted removes up to limit accounts whose deletion is due. With
+// anonymize their posts and comments stay under a placeholder account,
+// otherwise everything they own is deleted. The returned users carry the
+// id and avatar url so callers can clean up outside the database.
+func (s *UserStore) PurgeDeleted(c context.Context, anonymize bool, limit int) ([]User, error) {
+	var users []User
+
+	err := withTx(s.db, c, func(tx *sql.Tx) error {
+		c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+		defer cancel()
+
+		query := `
+			SELECT id, avatar_url FROM users
+			WHERE delete_after <= NOW()
+			ORDER BY delete_after
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED;
+		`
+		rows, err := tx.QueryContext(c, query, limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		var ids []int64
+		for rows.Next() {
+			var u User
+			if err := rows.Scan(&u.ID, &u.AvatarURL); err != nil {
+				return err
+			}
+			users = append(users, u)
+			ids = append(ids, u.ID)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if len(ids) == 0 {
+			return nil
+		}
+
+		if !anonymize {
+			_, err := tx.ExecContext(c, `DELETE FROM users WHERE id = ANY($1);`, pq.Array(ids))
+			return err
+		}
+
+		for _, query := range anonymizeQueries {
+			if _, err := tx.ExecContext(c, query, pq.Array(ids)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
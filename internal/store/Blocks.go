@@ -0,0 +1,142 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// ErrBlocked is returned when one of two users blocked the other
+var ErrBlocked = errors.New("user is blocked")
+
+type BlockedUser struct {
+	UserID        int64  `json:"-"`
+	BlockedUserID int64  `json:"blocked_user_id"`
+	Username      string `json:"username"`
+	CreatedAt     string `json:"created_at"`
+}
+
+type BlockStore struct {
+	db *sql.DB
+}
+
+// notBlockedSQL excludes the rows whose author, in column, blocked or was
+// blocked by the user passed as parameter n
+func notBlockedSQL(n int, column string) string {
+	return fmt.Sprintf(`
+		NOT EXISTS (
+			SELECT 1 FROM blocks b
+			WHERE (b.user_id = $%[1]d AND b.blocked_user_id = %[2]s)
+				OR (b.user_id = %[2]s AND b.blocked_user_id = $%[1]d)
+		)`, n, column)
+}
+
+// Block blocks b.BlockedUserID for b.UserID and drops every follow and
+// follow request between the two. Unknown users return ErrNotFound and
+// blocking twice ErrConflict.
+func (s *BlockStore) Block(c context.Context, b *BlockedUser) error {
+	return withTx(s.db, c, func(tx *sql.Tx) error {
+		c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+		defer cancel()
+
+		query := `
+			INSERT INTO blocks (user_id, blocked_user_id)
+			VALUES ($1, $2)
+			RETURNING created_at;
+		`
+		err := tx.QueryRowContext(c, query, b.UserID, b.BlockedUserID).Scan(&b.CreatedAt)
+		if err != nil {
+			if pqErr, ok := err.(*pq.Error); ok {
+				switch pqErr.Code {
+				case "23503":
+					return ErrNotFound
+				case "23505":
+					return ErrConflict
+				}
+			}
+			return err
+		}
+
+		for _, table := range []string{"followers", "follow_requests"} {
+			query := `
+				DELETE FROM ` + table + `
+				WHERE (user_id = $1 AND follower_id = $2) OR (user_id = $2 AND follower_id = $1);
+			`
+			if _, err := tx.ExecContext(c, query, b.UserID, b.BlockedUserID); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Unblock lifts the block, follows dropped by it are not restored
+func (s *BlockStore) Unblock(c context.Context, userID, blockedUserID int64) error {
+	query := `DELETE FROM blocks WHERE user_id = $1 AND blocked_user_id = $2;`
+
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(c, query, userID, blockedUserID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// NotBlocked reports whether neither of userID and otherID blocked the other
+func (s *BlockStore) NotBlocked(c context.Context, userID, otherID int64) (bool, error) {
+	query := `SELECT` + notBlockedSQL(1, "$2") + `;`
+
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	var unblocked bool
+	err := s.db.QueryRowContext(c, query, userID, otherID).Scan(&unblocked)
+	return unblocked, err
+}
+
+// GetBlockedUsers returns the users blocked by userID, newest first
+func (s *BlockStore) GetBlockedUsers(c context.Context, userID int64) ([]BlockedUser, error) {
+	query := `
+		SELECT b.blocked_user_id, u.username, b.created_at
+		FROM blocks b
+		JOIN users u ON u.id = b.blocked_user_id
+		WHERE b.user_id = $1
+		ORDER BY b.created_at DESC;
+	`
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(c, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	blocked := []BlockedUser{}
+	for rows.Next() {
+		b := BlockedUser{UserID: userID}
+		if err := rows.Scan(&b.BlockedUserID, &b.Username, &b.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		blocked = append(blocked, b)
+	}
+
+	return blocked, rows.Err()
+}
@@ -19,18 +19,20 @@ type CommentStore struct {
 	db *sql.DB
 }
 
-func (s *CommentStore) GetByPostID(c context.Context, id int64) ([]Comment, error) {
+// GetByPostID returns the comments of a post, leaving out those of users
+// blocking or blocked by viewerID
+func (s *CommentStore) GetByPostID(c context.Context, id, viewerID int64) ([]Comment, error) {
 	query := `
         SELECT c.id, c.post_id, c.user_id, c.content, c.created_at, users.username, users.id FROM comments c 
         JOIN users ON users.id = c.user_id 
-        WHERE c.post_id = $1
+        WHERE c.post_id = $1 AND` + notBlockedSQL(2, "c.user_id") + `
         ORDER BY c.created_at DESC; 
     `
 
 	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
 	defer cancel()
 
-	rows, err := s.db.QueryContext(c, query, id)
+	rows, err := s.db.QueryContext(c, query, id, viewerID)
 	if err != nil {
 		return nil, err
 	}
@@ -49,10 +51,13 @@ func (s *CommentStore) GetByPostID(c context.Context, id int64) ([]Comment, erro
 	return comments, nil
 }
 
-func (s *CommentStore) Create(c context.Context, comment *Comment) error{
+// Create adds a comment to a post. Commenting on the post of a user blocking
+// or blocked by the commenter returns ErrBlocked, unknown posts ErrNotFound.
+func (s *CommentStore) Create(c context.Context, comment *Comment) error {
 	query := `
 		INSERT INTO comments (user_id, post_id, content)
-		VALUES ($1, $2, $3) 
+		SELECT $1, p.id, $3 FROM posts p
+		WHERE p.id = $2 AND` + notBlockedSQL(1, "p.user_id") + `
 		RETURNING id, created_at;	
 	`
 	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
@@ -60,9 +65,21 @@ func (s *CommentStore) Create(c context.Context, comment *Comment) error{
 
 	err := s.db.QueryRowContext(c, query, comment.UserID, comment.PostID, comment.Content).
 		Scan(&comment.ID, &comment.CreatedAt)
+	if err == sql.ErrNoRows {
+		var exists bool
+		query := `SELECT EXISTS (SELECT 1 FROM posts WHERE id = $1);`
+		if err := s.db.QueryRowContext(c, query, comment.PostID).Scan(&exists); err != nil {
+			return err
+		}
+
+		if exists {
+			return ErrBlocked
+		}
+		return ErrNotFound
+	}
 	if err != nil {
 		return err
 	}
 	
 	return nil
-}
\ No newline at end of file
+}
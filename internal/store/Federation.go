@@ -0,0 +1,114 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+// ActorKey is the key pair a user signs ActivityPub deliveries with
+type ActorKey struct {
+	UserID     int64  `json:"user_id"`
+	PublicKey  string `json:"public_key"`
+	PrivateKey string `json:"-"`
+}
+
+// RemoteFollower is an actor on another server following a local user,
+// the counterpart of the followers table for federated follows
+type RemoteFollower struct {
+	UserID    int64  `json:"user_id"`
+	ActorID   string `json:"actor_id"`
+	Inbox     string `json:"inbox"`
+	CreatedAt string `json:"created_at"`
+}
+
+type FederationStore struct {
+	db *sql.DB
+}
+
+func (s *FederationStore) GetActorKey(c context.Context, userID int64) (*ActorKey, error) {
+	query := `SELECT user_id, public_key, private_key FROM actor_keys WHERE user_id = $1;`
+
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	var key ActorKey
+	err := s.db.QueryRowContext(c, query, userID).Scan(&key.UserID, &key.PublicKey, &key.PrivateKey)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &key, nil
+}
+
+// CreateActorKey keeps the first key stored for a user, if two requests
+// race the loser reads back the winner's key
+func (s *FederationStore) CreateActorKey(c context.Context, key *ActorKey) error {
+	query := `
+		INSERT INTO actor_keys (user_id, public_key, private_key)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET user_id = EXCLUDED.user_id
+		RETURNING public_key, private_key;
+	`
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	return s.db.QueryRowContext(c, query, key.UserID, key.PublicKey, key.PrivateKey).
+		Scan(&key.PublicKey, &key.PrivateKey)
+}
+
+func (s *FederationStore) AddRemoteFollower(c context.Context, f *RemoteFollower) error {
+	query := `
+		INSERT INTO remote_followers (user_id, actor_id, inbox)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, actor_id) DO UPDATE SET inbox = EXCLUDED.inbox
+		RETURNING created_at;
+	`
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	return s.db.QueryRowContext(c, query, f.UserID, f.ActorID, f.Inbox).Scan(&f.CreatedAt)
+}
+
+func (s *FederationStore) RemoveRemoteFollower(c context.Context, userID int64, actorID string) error {
+	query := `DELETE FROM remote_followers WHERE user_id = $1 AND actor_id = $2;`
+
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(c, query, userID, actorID)
+	return err
+}
+
+func (s *FederationStore) GetRemoteFollowers(c context.Context, userID int64) ([]RemoteFollower, error) {
+	query := `
+		SELECT user_id, actor_id, inbox, created_at
+		FROM remote_followers
+		WHERE user_id = $1
+		ORDER BY created_at;
+	`
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(c, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var followers []RemoteFollower
+	for rows.Next() {
+		var f RemoteFollower
+		if err := rows.Scan(&f.UserID, &f.ActorID, &f.Inbox, &f.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		followers = append(followers, f)
+	}
+
+	return followers, rows.Err()
+}
@@ -3,6 +3,7 @@ package store
 import (
 	"context"
 	"database/sql"
+	"fmt"
 
 	"github.com/lib/pq"
 )
@@ -16,26 +17,74 @@ type FollowerStore struct {
 	db *sql.DB
 }
 
-func (s *FollowerStore) Follow(c context.Context, followerID, userID int64) error {
-	query := `
-		INSERT INTO followers (user_id, follower_id)
-		VALUES ($1, $2);
-	`
-	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
-	defer cancel()
+// Follow makes followerID follow userID. Following a private account files
+// a follow request instead and reports pending. Existing follows and
+// requests return ErrConflict, unknown users ErrNotFound and users blocking
+// or blocked by followerID ErrBlocked.
+func (s *FollowerStore) Follow(c context.Context, followerID, userID int64) (bool, error) {
+	var pending bool
 
-	_, err := s.db.ExecContext(c, query, userID, followerID)
+	err := withTx(s.db, c, func(tx *sql.Tx) error {
+		c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+		defer cancel()
+
+		query := `SELECT is_private FROM users WHERE id = $1 AND is_active = true FOR SHARE;`
+		if err := tx.QueryRowContext(c, query, userID).Scan(&pending); err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		var unblocked bool
+		query = `SELECT` + notBlockedSQL(1, "$2") + `;`
+		if err := tx.QueryRowContext(c, query, followerID, userID).Scan(&unblocked); err != nil {
+			return err
+		}
+		if !unblocked {
+			return ErrBlocked
+		}
+
+		if pending {
+			var following bool
+			query = `SELECT EXISTS (SELECT 1 FROM followers WHERE user_id = $1 AND follower_id = $2);`
+			if err := tx.QueryRowContext(c, query, userID, followerID).Scan(&following); err != nil {
+				return err
+			}
+			if following {
+				return ErrConflict
+			}
+
+			query = `INSERT INTO follow_requests (user_id, follower_id) VALUES ($1, $2);`
+		} else {
+			query = `INSERT INTO followers (user_id, follower_id) VALUES ($1, $2);`
+		}
+
+		if _, err := tx.ExecContext(c, query, userID, followerID); err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+				return ErrConflict
+			}
+			return err
+		}
+
+		return nil
+	})
 	if err != nil {
-		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
-			return ErrConflict
-		} 
+		return false, err
 	}
 
-	return nil
+	return pending, nil
 }
 
+// Unfollow stops followerID from following userID and withdraws a pending
+// request
 func (s *FollowerStore) Unfollow(c context.Context, followerID, userID int64) error {
 	query := `
+		WITH withdrawn AS (
+			DELETE FROM follow_requests WHERE user_id = $1 AND follower_id = $2
+		)
 		DELETE FROM followers
 		WHERE user_id = $1 AND follower_id = $2;	
 	`
@@ -49,4 +98,193 @@ func (s *FollowerStore) Unfollow(c context.Context, followerID, userID int64) er
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// ApproveRequest turns the pending request of followerID into a follow of
+// userID
+func (s *FollowerStore) ApproveRequest(c context.Context, userID, followerID int64) error {
+	return withTx(s.db, c, func(tx *sql.Tx) error {
+		c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+		defer cancel()
+
+		query := `DELETE FROM follow_requests WHERE user_id = $1 AND follower_id = $2;`
+		res, err := tx.ExecContext(c, query, userID, followerID)
+		if err != nil {
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			return ErrNotFound
+		}
+
+		query = `INSERT INTO followers (user_id, follower_id) VALUES ($1, $2) ON CONFLICT DO NOTHING;`
+		_, err = tx.ExecContext(c, query, userID, followerID)
+		return err
+	})
+}
+
+// RejectRequest drops the pending request of followerID to follow userID
+func (s *FollowerStore) RejectRequest(c context.Context, userID, followerID int64) error {
+	query := `DELETE FROM follow_requests WHERE user_id = $1 AND follower_id = $2;`
+
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(c, query, userID, followerID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// CanSee reports whether viewerID may see the posts of authorID: the account
+// is their own, or is public or followed by viewerID and neither blocked the
+// other
+func (s *FollowerStore) CanSee(c context.Context, viewerID, authorID int64) (bool, error) {
+	query := `
+		SELECT u.id = $1 OR (
+			(NOT u.is_private OR EXISTS (SELECT 1 FROM followers WHERE user_id = u.id AND follower_id = $1))
+			AND` + notBlockedSQL(1, "u.id") + `
+		)
+		FROM users u
+		WHERE u.id = $2;
+	`
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	var visible bool
+	err := s.db.QueryRowContext(c, query, viewerID, authorID).Scan(&visible)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return false, ErrNotFound
+		default:
+			return false, err
+		}
+	}
+
+	return visible, nil
+}
+
+// GetFollowerIDs returns the ids of everyone following userID
+func (s *FollowerStore) GetFollowerIDs(c context.Context, userID int64) ([]int64, error) {
+	query := `SELECT follower_id FROM followers WHERE user_id = $1;`
+
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(c, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// visibleSQL keeps the posts (alias p) the user passed as parameter n may
+// see: their own, those of public accounts and those of accounts they follow
+func visibleSQL(n int) string {
+	return fmt.Sprintf(`
+		(p.user_id = $%[1]d OR NOT EXISTS (
+			SELECT 1 FROM users pu WHERE pu.id = p.user_id AND pu.is_private
+		) OR EXISTS (
+			SELECT 1 FROM followers vf WHERE vf.user_id = p.user_id AND vf.follower_id = $%[1]d
+		))`, n)
+}
+
+// FollowUser is an entry of a followers, following or follow request list,
+// FollowedAt is when the follow or the request was made
+type FollowUser struct {
+	ID          int64  `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	AvatarURL   string `json:"avatar_url"`
+	FollowedAt  string `json:"followed_at"`
+}
+
+// GetFollowers lists the active users following userID, newest first unless
+// fq.Sort is asc
+func (s *FollowerStore) GetFollowers(c context.Context, userID int64, fq PaginatedQuery) ([]FollowUser, error) {
+	return s.list(c, "followers", "f.follower_id", "f.user_id", userID, fq)
+}
+
+// GetFollowing lists the active users userID follows, newest first unless
+// fq.Sort is asc
+func (s *FollowerStore) GetFollowing(c context.Context, userID int64, fq PaginatedQuery) ([]FollowUser, error) {
+	return s.list(c, "followers", "f.user_id", "f.follower_id", userID, fq)
+}
+
+// GetIncomingRequests lists the users waiting for userID to approve their
+// follow request
+func (s *FollowerStore) GetIncomingRequests(c context.Context, userID int64, fq PaginatedQuery) ([]FollowUser, error) {
+	return s.list(c, "follow_requests", "f.follower_id", "f.user_id", userID, fq)
+}
+
+// GetOutgoingRequests lists the private accounts userID asked to follow
+func (s *FollowerStore) GetOutgoingRequests(c context.Context, userID int64, fq PaginatedQuery) ([]FollowUser, error) {
+	return s.list(c, "follow_requests", "f.user_id", "f.follower_id", userID, fq)
+}
+
+// list pages through table, followers or follow_requests, joining the user
+// in column listed for the rows whose column owner is userID
+func (s *FollowerStore) list(c context.Context, table, listed, owner string, userID int64, fq PaginatedQuery) ([]FollowUser, error) {
+	order := "DESC"
+	if fq.Sort == "asc" {
+		order = "ASC"
+	}
+
+	query := `
+		SELECT u.id, u.username, u.display_name, u.avatar_url, f.created_at
+		FROM ` + table + ` f
+		JOIN users u ON u.id = ` + listed + `
+		WHERE ` + owner + ` = $1 AND u.is_active = true
+		ORDER BY f.created_at ` + order + `, u.id ` + order + `
+		LIMIT $2 OFFSET $3;
+	`
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(c, query, userID, fq.Limit, fq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []FollowUser{}
+	for rows.Next() {
+		var u FollowUser
+		if err := rows.Scan(&u.ID, &u.Username, &u.DisplayName, &u.AvatarURL, &u.FollowedAt); err != nil {
+			return nil, err
+		}
+
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
@@ -0,0 +1,247 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var ErrInvalidRegex = errors.New("invalid regular expression")
+
+type MutedUser struct {
+	UserID      int64      `json:"-"`
+	MutedUserID int64      `json:"muted_user_id"`
+	Username    string     `json:"username"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	CreatedAt   string     `json:"created_at"`
+}
+
+type MutedKeyword struct {
+	ID        int64      `json:"id"`
+	UserID    int64      `json:"-"`
+	Keyword   string     `json:"keyword"`
+	IsRegex   bool       `json:"is_regex"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	CreatedAt string     `json:"created_at"`
+}
+
+type MuteStore struct {
+	db *sql.DB
+}
+
+// notMutedSQL excludes the posts (alias p) that the user passed as
+// parameter n has muted, by author or by keyword. Keywords match title,
+// content and tags, case insensitively. Untagged posts have NULL tags,
+// which would make the whole text NULL.
+func notMutedSQL(n int) string {
+	return notMutedBySQL(fmt.Sprintf("$%d", n))
+}
+
+// notMutedBySQL is notMutedSQL for the user in the column or expression
+// user
+func notMutedBySQL(user string) string {
+	return fmt.Sprintf(`
+		NOT EXISTS (
+			SELECT 1 FROM muted_users mu
+			WHERE mu.user_id = %[1]s AND mu.muted_user_id = p.user_id
+				AND (mu.expires_at IS NULL OR mu.expires_at > NOW())
+		) AND NOT EXISTS (
+			SELECT 1 FROM muted_keywords mk
+			WHERE mk.user_id = %[1]s
+				AND (mk.expires_at IS NULL OR mk.expires_at > NOW())
+				AND CASE WHEN mk.is_regex
+					THEN (p.title || ' ' || p.content || ' ' || coalesce(array_to_string(p.tags, ' '), '')) ~* mk.keyword
+					ELSE strpos(lower(p.title || ' ' || p.content || ' ' || coalesce(array_to_string(p.tags, ' '), '')), lower(mk.keyword)) > 0
+				END
+		)`, user)
+}
+
+// MuteUser mutes a user until m.ExpiresAt, or for good when it is nil.
+// Muting again replaces the expiry.
+func (s *MuteStore) MuteUser(c context.Context, m *MutedUser) error {
+	query := `
+		INSERT INTO muted_users (user_id, muted_user_id, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, muted_user_id) DO UPDATE SET expires_at = EXCLUDED.expires_at, created_at = NOW()
+		RETURNING created_at;
+	`
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(c, query, m.UserID, m.MutedUserID, m.ExpiresAt).Scan(&m.CreatedAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (s *MuteStore) UnmuteUser(c context.Context, userID, mutedUserID int64) error {
+	query := `DELETE FROM muted_users WHERE user_id = $1 AND muted_user_id = $2;`
+
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(c, query, userID, mutedUserID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetMutedUsers returns the mutes of a user that haven't expired
+func (s *MuteStore) GetMutedUsers(c context.Context, userID int64) ([]MutedUser, error) {
+	query := `
+		SELECT mu.muted_user_id, u.username, mu.expires_at, mu.created_at
+		FROM muted_users mu
+		JOIN users u ON u.id = mu.muted_user_id
+		WHERE mu.user_id = $1 AND (mu.expires_at IS NULL OR mu.expires_at > NOW())
+		ORDER BY mu.created_at DESC;
+	`
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(c, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	muted := []MutedUser{}
+	for rows.Next() {
+		m := MutedUser{UserID: userID}
+		if err := rows.Scan(&m.MutedUserID, &m.Username, &m.ExpiresAt, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		muted = append(muted, m)
+	}
+
+	return muted, rows.Err()
+}
+
+// CreateKeyword mutes a phrase or, with IsRegex, a case insensitive POSIX
+// regular expression. Patterns the database can't compile are rejected
+// with ErrInvalidRegex.
+func (s *MuteStore) CreateKeyword(c context.Context, k *MutedKeyword) error {
+	query := `
+		INSERT INTO muted_keywords (user_id, keyword, is_regex, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at;
+	`
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	if k.IsRegex {
+		var matched bool
+		if err := s.db.QueryRowContext(c, `SELECT '' ~* $1;`, k.Keyword).Scan(&matched); err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "2201B" {
+				return ErrInvalidRegex
+			}
+			return err
+		}
+	}
+
+	return s.db.QueryRowContext(c, query, k.UserID, k.Keyword, k.IsRegex, k.ExpiresAt).Scan(&k.ID, &k.CreatedAt)
+}
+
+func (s *MuteStore) DeleteKeyword(c context.Context, userID, keywordID int64) error {
+	query := `DELETE FROM muted_keywords WHERE id = $1 AND user_id = $2;`
+
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(c, query, keywordID, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetNotMuting returns those of userIDs that haven't muted the post postID,
+// by author or by keyword
+func (s *MuteStore) GetNotMuting(c context.Context, postID int64, userIDs []int64) ([]int64, error) {
+	query := `
+		SELECT u.id
+		FROM unnest($1::bigint[]) AS u(id)
+		JOIN posts p ON p.id = $2
+		WHERE` + notMutedBySQL("u.id") + `;
+	`
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(c, query, pq.Array(userIDs), postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// GetKeywords returns the muted keywords of a user that haven't expired
+func (s *MuteStore) GetKeywords(c context.Context, userID int64) ([]MutedKeyword, error) {
+	query := `
+		SELECT id, keyword, is_regex, expires_at, created_at
+		FROM muted_keywords
+		WHERE user_id = $1 AND (expires_at IS NULL OR expires_at > NOW())
+		ORDER BY created_at DESC, id DESC;
+	`
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(c, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keywords := []MutedKeyword{}
+	for rows.Next() {
+		k := MutedKeyword{UserID: userID}
+		if err := rows.Scan(&k.ID, &k.Keyword, &k.IsRegex, &k.ExpiresAt, &k.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		keywords = append(keywords, k)
+	}
+
+	return keywords, rows.Err()
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"log"
+	"time"
 
 	"github.com/lib/pq"
 )
@@ -24,7 +26,10 @@ type Post struct {
 
 type PostWithMetadata struct {
 	Post
-	CommentCount int64 `json:"comment_count"`
+	CommentCount  int64   `json:"comment_count"`
+	ReactionCount int64   `json:"reaction_count"`
+	Views         int64   `json:"views"`
+	Score         float64 `json:"score,omitempty"`
 }
 
 type PostStore struct {
@@ -32,26 +37,96 @@ type PostStore struct {
 }
 
 func (s *PostStore) GetUserFeed(c context.Context, followerID int64, fq PaginatedQuery) ([]PostWithMetadata, error) {
+	audience := `(p.user_id = $1 OR p.user_id IN (SELECT user_id FROM followers WHERE follower_id = $1))`
+
+	return s.queryFeed(c, audience, followerID, fq)
+}
+
+// GetExplore returns posts from public users that userID doesn't follow
+func (s *PostStore) GetExplore(c context.Context, userID int64, fq PaginatedQuery) ([]PostWithMetadata, error) {
+	audience := `p.user_id <> $1 AND p.user_id NOT IN (SELECT user_id FROM followers WHERE follower_id = $1) AND` + visibleSQL(1)
+
+	return s.queryFeed(c, audience, userID, fq)
+}
+
+// queryFeed pages through the posts matching audience, a condition on the
+// posts alias p that may refer to userID as $1
+func (s *PostStore) queryFeed(c context.Context, audience string, userID int64, fq PaginatedQuery) ([]PostWithMetadata, error) {
+	args := []any{userID, fq.Limit, fq.Offset, fq.Search, pq.Array(fq.Tags)}
+
+	filters := ""
+	if fq.Since != nil {
+		args = append(args, *fq.Since)
+		filters += fmt.Sprintf(" AND p.created_at >= $%d", len(args))
+	}
+
+	if fq.Until != nil {
+		args = append(args, *fq.Until)
+		filters += fmt.Sprintf(" AND p.created_at <= $%d", len(args))
+	}
+
+	score := "0"
+	keyset := ""
+	order := "created_at " + fq.Sort + ", id " + fq.Sort
+	if fq.Sort == "top" {
+		ranking := fq.Ranking
+		if ranking == (Ranking{}) {
+			ranking = DefaultRanking
+		}
+
+		// scores are computed against a fixed time so the order is stable
+		// while paging through the feed
+		rankedAt := fq.RankedAt
+		if rankedAt.IsZero() {
+			rankedAt = time.Now()
+		}
+
+		score = ranking.scoreSQL(len(args) + 1)
+		args = append(args, ranking.args()...)
+		args = append(args, rankedAt)
+		order = "score DESC, id DESC"
+
+		if fq.After != nil {
+			args = append(args, fq.After.Score, fq.After.ID)
+			keyset = fmt.Sprintf("WHERE (score, id) < ($%d, $%d)", len(args)-1, len(args))
+		}
+	} else if fq.After != nil {
+		// keyset pagination, the cursor replaces the offset
+		op := "<"
+		if fq.Sort == "asc" {
+			op = ">"
+		}
+
+		args = append(args, fq.After.CreatedAt, fq.After.ID)
+		filters += fmt.Sprintf(" AND (p.created_at, p.id) %s ($%d, $%d)", op, len(args)-1, len(args))
+	}
+
 	query := `
-		SELECT p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags,
-			count(c.id) AS comment_count, u.username
-		FROM posts p
-		LEFT JOIN comments c ON c.post_id = p.id
-		LEFT JOIN users u ON u.id = p.user_id
-		JOIN followers f ON f.follower_id = p.user_id OR p.user_id = $1
-		WHERE 
-			f.user_id = $1 AND 
-			(p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%') AND
-			(p.tags @> $5 OR $5 = '{}') 
-		GROUP BY p.id, u.username
-		ORDER BY p.created_at ` + fq.Sort + ` 
+		SELECT id, user_id, title, content, created_at, version, tags,
+			comment_count, reaction_count, views, username, score
+		FROM (
+			SELECT p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags,
+				count(c.id) AS comment_count,
+				(SELECT count(*) FROM reactions r WHERE r.post_id = p.id) AS reaction_count,
+				p.views, u.username, ` + score + ` AS score
+			FROM posts p
+			LEFT JOIN comments c ON c.post_id = p.id AND` + notBlockedSQL(1, "c.user_id") + `
+			LEFT JOIN users u ON u.id = p.user_id
+			WHERE 
+				` + audience + ` AND 
+				(p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%') AND
+				(p.tags @> $5 OR $5 = '{}') AND` + notMutedSQL(1) + ` AND` + notBlockedSQL(1, "p.user_id") + filters + `
+			GROUP BY p.id, u.username
+		) feed
+		` + keyset + `
+		ORDER BY ` + order + `
 		LIMIT $2 OFFSET $3;	
 	`
 	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
 	defer cancel()
 
 	log.Println(pq.Array(fq.Tags))
-	rows, err := s.db.QueryContext(c, query, followerID, fq.Limit, fq.Offset, fq.Search, pq.Array(fq.Tags))
+	rows, err := s.db.QueryContext(c, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -70,7 +145,10 @@ func (s *PostStore) GetUserFeed(c context.Context, followerID int64, fq Paginate
 			&p.Version,
 			pq.Array(&p.Tags),
 			&p.CommentCount,
+			&p.ReactionCount,
+			&p.Views,
 			&p.User.Username,
+			&p.Score,
 		)
 		if err != nil {
 			return nil, err
@@ -82,6 +160,197 @@ func (s *PostStore) GetUserFeed(c context.Context, followerID int64, fq Paginate
 	return feed, nil
 }
 
+// GetByIDs hydrates posts from the materialized timeline of userID. Missing
+// (deleted) posts, posts muted by userID, posts of private accounts userID
+// no longer follows and posts of blocked users are skipped, the order of
+// ids is kept.
+func (s *PostStore) GetByIDs(c context.Context, userID int64, ids []int64) ([]PostWithMetadata, error) {
+	query := `
+		SELECT p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags,
+			count(c.id) AS comment_count,
+			(SELECT count(*) FROM reactions r WHERE r.post_id = p.id) AS reaction_count,
+			p.views, u.username
+		FROM posts p
+		LEFT JOIN comments c ON c.post_id = p.id AND` + notBlockedSQL(2, "c.user_id") + `
+		LEFT JOIN users u ON u.id = p.user_id
+		WHERE p.id = ANY($1) AND` + notMutedSQL(2) + ` AND` + visibleSQL(2) + ` AND` + notBlockedSQL(2, "p.user_id") + `
+		GROUP BY p.id, u.username;
+	`
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(c, query, pq.Array(ids), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := make(map[int64]PostWithMetadata, len(ids))
+	for rows.Next() {
+		var p PostWithMetadata
+		err := rows.Scan(
+			&p.ID,
+			&p.UserID,
+			&p.Title,
+			&p.Content,
+			&p.CreatedAt,
+			&p.Version,
+			pq.Array(&p.Tags),
+			&p.CommentCount,
+			&p.ReactionCount,
+			&p.Views,
+			&p.User.Username,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		byID[p.ID] = p
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	posts := make([]PostWithMetadata, 0, len(byID))
+	for _, id := range ids {
+		if p, ok := byID[id]; ok {
+			posts = append(posts, p)
+		}
+	}
+
+	return posts, nil
+}
+
+// GetByUserID returns the latest posts of a user, newest first
+func (s *PostStore) GetByUserID(c context.Context, userID int64, limit int) ([]Post, error) {
+	query := `
+		SELECT id, user_id, title, content, tags, version, created_at, updated_at
+		FROM posts
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2;
+	`
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(c, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []Post
+	for rows.Next() {
+		var p Post
+		err := rows.Scan(
+			&p.ID,
+			&p.UserID,
+			&p.Title,
+			&p.Content,
+			pq.Array(&p.Tags),
+			&p.Version,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		posts = append(posts, p)
+	}
+
+	return posts, rows.Err()
+}
+
+// GetFollowedSince returns the posts of users followed by userID created
+// after the post afterID, oldest first. Muted and blocked posts are left
+// out like in the feed.
+func (s *PostStore) GetFollowedSince(c context.Context, userID, afterID int64, limit int) ([]Post, error) {
+	query := `
+		SELECT p.id, p.user_id, p.title, p.content, p.tags, p.version, p.created_at, p.updated_at
+		FROM posts p
+		WHERE p.user_id IN (SELECT user_id FROM followers WHERE follower_id = $1)
+			AND p.id > $2
+			AND` + notMutedSQL(1) + ` AND` + notBlockedSQL(1, "p.user_id") + `
+		ORDER BY p.id ASC
+		LIMIT $3;
+	`
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(c, query, userID, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []Post
+	for rows.Next() {
+		var p Post
+		err := rows.Scan(
+			&p.ID,
+			&p.UserID,
+			&p.Title,
+			&p.Content,
+			pq.Array(&p.Tags),
+			&p.Version,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		posts = append(posts, p)
+	}
+
+	return posts, rows.Err()
+}
+
+// GetByTag returns the latest public posts tagged with tag, newest first
+func (s *PostStore) GetByTag(c context.Context, tag string, limit int) ([]Post, error) {
+	query := `
+		SELECT p.id, p.user_id, p.title, p.content, p.tags, p.version, p.created_at, p.updated_at, u.username
+		FROM posts p
+		JOIN users u ON u.id = p.user_id
+		WHERE p.tags @> ARRAY[$1]::varchar(100)[] AND NOT u.is_private
+		ORDER BY p.created_at DESC, p.id DESC
+		LIMIT $2;
+	`
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(c, query, tag, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []Post
+	for rows.Next() {
+		var p Post
+		err := rows.Scan(
+			&p.ID,
+			&p.UserID,
+			&p.Title,
+			&p.Content,
+			pq.Array(&p.Tags),
+			&p.Version,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+			&p.User.Username,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		posts = append(posts, p)
+	}
+
+	return posts, rows.Err()
+}
+
 func (s *PostStore) Create(c context.Context, p *Post) error {
 	query := `
 		INSERT INTO posts (content, title, user_id, tags)
@@ -189,3 +458,13 @@ func (s *PostStore) Update(c context.Context, p *Post) error {
 
 	return nil
 }
+
+func (s *PostStore) IncrementViews(c context.Context, postID int64) error {
+	query := `UPDATE posts SET views = views + 1 WHERE id = $1;`
+
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(c, query, postID)
+	return err
+}
@@ -0,0 +1,54 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+type Reaction struct {
+	PostID    int64  `json:"post_id"`
+	UserID    int64  `json:"user_id"`
+	Reaction  string `json:"reaction"`
+	CreatedAt string `json:"created_at"`
+}
+
+type ReactionStore struct {
+	db *sql.DB
+}
+
+// Upsert stores the reaction of a user to a post, replacing any earlier one
+func (s *ReactionStore) Upsert(c context.Context, r *Reaction) error {
+	query := `
+		INSERT INTO reactions (post_id, user_id, reaction)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (post_id, user_id) DO UPDATE SET reaction = EXCLUDED.reaction, created_at = NOW()
+		RETURNING created_at;
+	`
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	return s.db.QueryRowContext(c, query, r.PostID, r.UserID, r.Reaction).Scan(&r.CreatedAt)
+}
+
+func (s *ReactionStore) Delete(c context.Context, postID, userID int64) error {
+	query := `DELETE FROM reactions WHERE post_id = $1 AND user_id = $2;`
+
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(c, query, postID, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
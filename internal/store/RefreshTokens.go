@@ -0,0 +1,133 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrRefreshTokenReused = errors.New("refresh token was already used")
+
+// RefreshTokenStore keeps the hashes of refresh tokens. Each login starts a
+// family, every refresh replaces the token with a new one of the same
+// family and keeps the used one around to detect replays.
+type RefreshTokenStore struct {
+	db *sql.DB
+}
+
+// Create stores the hash of a refresh token starting a new family for
+// userID, dropping the expired tokens of the user on the way
+func (s *RefreshTokenStore) Create(c context.Context, userID int64, token string, exp time.Duration) error {
+	return withTx(s.db, c, func(tx *sql.Tx) error {
+		c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+		defer cancel()
+
+		query := `DELETE FROM refresh_tokens WHERE user_id = $1 AND expiry <= NOW();`
+		if _, err := tx.ExecContext(c, query, userID); err != nil {
+			return err
+		}
+
+		query = `
+			INSERT INTO refresh_tokens (token, family_id, user_id, expiry)
+			VALUES ($1, $2, $3, $4);
+		`
+		_, err := tx.ExecContext(c, query, token, uuid.New(), userID, time.Now().Add(exp))
+		return err
+	})
+}
+
+// Rotate consumes a refresh token and stores the hash newToken in its place
+// for exp, returning the id of the user. Unknown and expired tokens, or
+// tokens of inactive users, return ErrNotFound. A token that was already
+// rotated revokes its whole family and returns ErrRefreshTokenReused.
+func (s *RefreshTokenStore) Rotate(c context.Context, token, newToken string, exp time.Duration) (int64, error) {
+	var userID int64
+	var reused bool
+
+	err := withTx(s.db, c, func(tx *sql.Tx) error {
+		c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+		defer cancel()
+
+		hash := sha256.Sum256([]byte(token))
+		hashToken := hex.EncodeToString(hash[:])
+
+		query := `
+			SELECT rt.family_id, rt.user_id, rt.used_at IS NOT NULL
+			FROM refresh_tokens rt
+			JOIN users u ON u.id = rt.user_id
+			WHERE rt.token = $1 AND rt.expiry > NOW() AND u.is_active = true
+			FOR UPDATE OF rt;
+		`
+		var family string
+		if err := tx.QueryRowContext(c, query, hashToken).Scan(&family, &userID, &reused); err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		// committed, a replayed token must not leave the family usable
+		if reused {
+			_, err := tx.ExecContext(c, `DELETE FROM refresh_tokens WHERE family_id = $1;`, family)
+			return err
+		}
+
+		query = `UPDATE refresh_tokens SET used_at = NOW() WHERE token = $1;`
+		if _, err := tx.ExecContext(c, query, hashToken); err != nil {
+			return err
+		}
+
+		query = `
+			INSERT INTO refresh_tokens (token, family_id, user_id, expiry)
+			VALUES ($1, $2, $3, $4);
+		`
+		_, err := tx.ExecContext(c, query, newToken, family, userID, time.Now().Add(exp))
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if reused {
+		return 0, ErrRefreshTokenReused
+	}
+
+	return userID, nil
+}
+
+// Revoke drops the family of the refresh token token when it belongs to
+// userID
+func (s *RefreshTokenStore) Revoke(c context.Context, userID int64, token string) error {
+	query := `
+		DELETE FROM refresh_tokens
+		WHERE family_id = (
+			SELECT family_id FROM refresh_tokens WHERE token = $1 AND user_id = $2
+		);
+	`
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	hash := sha256.Sum256([]byte(token))
+	hashToken := hex.EncodeToString(hash[:])
+
+	_, err := s.db.ExecContext(c, query, hashToken, userID)
+	return err
+}
+
+// RevokeAll drops every refresh token of userID
+func (s *RefreshTokenStore) RevokeAll(c context.Context, userID int64) error {
+	query := `DELETE FROM refresh_tokens WHERE user_id = $1;`
+
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(c, query, userID)
+	return err
+}
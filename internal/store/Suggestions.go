@@ -0,0 +1,101 @@
+package store
+
+import (
+	"context"
+)
+
+// SuggestedUser is an account userID might want to follow along with the
+// signals it was ranked by
+type SuggestedUser struct {
+	ID            int64  `json:"id"`
+	Username      string `json:"username"`
+	DisplayName   string `json:"display_name"`
+	AvatarURL     string `json:"avatar_url"`
+	MutualCount   int64  `json:"mutual_count"`
+	SharedTags    int64  `json:"shared_tags"`
+	FollowerCount int64  `json:"follower_count"`
+}
+
+// GetSuggestions ranks up to limit accounts for userID to follow. Candidates
+// are followed by the accounts userID follows, posted recently under the
+// tags userID recently used, or are among the most followed. Mutual
+// connections weigh most, then shared tags, then popularity on a log scale.
+// Accounts already followed or requested, blocked either way or muted are
+// left out.
+func (s *FollowerStore) GetSuggestions(c context.Context, userID int64, limit int) ([]SuggestedUser, error) {
+	query := `
+		WITH following AS (
+			SELECT user_id FROM followers WHERE follower_id = $1
+		), mutual AS (
+			SELECT f.user_id AS id, COUNT(*) AS mutual_count
+			FROM followers f
+			JOIN following fo ON fo.user_id = f.follower_id
+			GROUP BY f.user_id
+		), own_tags AS (
+			SELECT DISTINCT unnest(tags) AS tag
+			FROM posts
+			WHERE user_id = $1 AND created_at > NOW() - INTERVAL '30 days'
+		), shared AS (
+			SELECT p.user_id AS id, COUNT(DISTINCT t.tag) AS shared_tags
+			FROM posts p, unnest(p.tags) AS t(tag)
+			WHERE p.created_at > NOW() - INTERVAL '30 days'
+				AND t.tag IN (SELECT tag FROM own_tags)
+			GROUP BY p.user_id
+		), popular AS (
+			SELECT user_id AS id FROM followers
+			GROUP BY user_id
+			ORDER BY COUNT(*) DESC
+			LIMIT 100
+		), candidates AS (
+			SELECT id FROM mutual
+			UNION SELECT id FROM shared
+			UNION SELECT id FROM popular
+		)
+		SELECT u.id, u.username, u.display_name, u.avatar_url,
+			COALESCE(m.mutual_count, 0), COALESCE(s.shared_tags, 0), fc.count
+		FROM candidates cd
+		JOIN users u ON u.id = cd.id
+		LEFT JOIN mutual m ON m.id = u.id
+		LEFT JOIN shared s ON s.id = u.id
+		CROSS JOIN LATERAL (
+			SELECT COUNT(*) AS count FROM followers WHERE user_id = u.id
+		) fc
+		WHERE u.id <> $1 AND u.is_active = true AND u.delete_after IS NULL
+			AND u.id NOT IN (SELECT user_id FROM following)
+			AND NOT EXISTS (
+				SELECT 1 FROM follow_requests fr WHERE fr.user_id = u.id AND fr.follower_id = $1
+			)
+			AND NOT EXISTS (
+				SELECT 1 FROM muted_users mu
+				WHERE mu.user_id = $1 AND mu.muted_user_id = u.id
+					AND (mu.expires_at IS NULL OR mu.expires_at > NOW())
+			)
+			AND` + notBlockedSQL(1, "u.id") + `
+		ORDER BY 3 * COALESCE(m.mutual_count, 0) + 2 * COALESCE(s.shared_tags, 0) + ln(1 + fc.count) DESC, u.id
+		LIMIT $2;
+	`
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(c, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []SuggestedUser{}
+	for rows.Next() {
+		var u SuggestedUser
+		err := rows.Scan(
+			&u.ID, &u.Username, &u.DisplayName, &u.AvatarURL,
+			&u.MutualCount, &u.SharedTags, &u.FollowerCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
@@ -0,0 +1,295 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrTOTPEnabled = errors.New("two-factor authentication is already enabled")
+
+// TOTP is the authenticator app secret of a user. Until EnabledAt is set it
+// is a pending enrollment that waits for a first code.
+type TOTP struct {
+	UserID      int64
+	Secret      string
+	LastCounter int64
+	EnabledAt   *time.Time
+}
+
+func (t *TOTP) Enabled() bool {
+	return t.EnabledAt != nil
+}
+
+// TwoFactorStore keeps the TOTP secrets, the hashes of recovery codes and
+// the challenges handed out between the password and the second factor
+type TwoFactorStore struct {
+	db *sql.DB
+}
+
+func (s *TwoFactorStore) Get(c context.Context, userID int64) (*TOTP, error) {
+	query := `
+		SELECT user_id, secret, last_counter, enabled_at
+		FROM user_totp
+		WHERE user_id = $1;
+	`
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	var t TOTP
+	err := s.db.QueryRowContext(c, query, userID).Scan(&t.UserID, &t.Secret, &t.LastCounter, &t.EnabledAt)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &t, nil
+}
+
+// Enroll stores secret as the pending secret of userID, replacing an
+// earlier pending one. Users with 2FA on get ErrTOTPEnabled.
+func (s *TwoFactorStore) Enroll(c context.Context, userID int64, secret string) error {
+	query := `
+		INSERT INTO user_totp (user_id, secret) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_counter = 0, created_at = NOW()
+		WHERE user_totp.enabled_at IS NULL;
+	`
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(c, query, userID, secret)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrTOTPEnabled
+	}
+
+	return nil
+}
+
+// Enable turns on the pending secret of userID, confirmed by a code of
+// step counter, and replaces the recovery codes with codes. Only bcrypt
+// hashes of the codes are stored, like passwords, so a leaked table can't be
+// searched through. The refresh tokens of userID are revoked, logins made
+// without a code end with their access tokens. Without a pending enrollment
+// it returns ErrNotFound.
+func (s *TwoFactorStore) Enable(c context.Context, userID, counter int64, codes []string) error {
+	// hashed before the transaction, bcrypt is slow on purpose
+	hashes := make([][]byte, len(codes))
+	for i, code := range codes {
+		hash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+		hashes[i] = hash
+	}
+
+	return withTx(s.db, c, func(tx *sql.Tx) error {
+		c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+		defer cancel()
+
+		query := `
+			UPDATE user_totp SET enabled_at = NOW(), last_counter = $2
+			WHERE user_id = $1 AND enabled_at IS NULL AND last_counter < $2;
+		`
+		res, err := tx.ExecContext(c, query, userID, counter)
+		if err != nil {
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return ErrNotFound
+		}
+
+		if _, err := tx.ExecContext(c, `DELETE FROM recovery_codes WHERE user_id = $1;`, userID); err != nil {
+			return err
+		}
+
+		query = `INSERT INTO recovery_codes (user_id, code) VALUES ($1, $2);`
+		for _, hash := range hashes {
+			if _, err := tx.ExecContext(c, query, userID, hash); err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.ExecContext(c, `DELETE FROM refresh_tokens WHERE user_id = $1;`, userID)
+		return err
+	})
+}
+
+// Disable turns 2FA off for userID, dropping its secret, recovery codes and
+// challenges
+func (s *TwoFactorStore) Disable(c context.Context, userID int64) error {
+	return withTx(s.db, c, func(tx *sql.Tx) error {
+		c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+		defer cancel()
+
+		queries := []string{
+			`DELETE FROM user_totp WHERE user_id = $1;`,
+			`DELETE FROM recovery_codes WHERE user_id = $1;`,
+			`DELETE FROM two_factor_challenges WHERE user_id = $1;`,
+		}
+		for _, query := range queries {
+			if _, err := tx.ExecContext(c, query, userID); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// UseCode records that userID used the code of step counter, it reports
+// false when that step or a later one was used already
+func (s *TwoFactorStore) UseCode(c context.Context, userID, counter int64) (bool, error) {
+	query := `
+		UPDATE user_totp SET last_counter = $2
+		WHERE user_id = $1 AND enabled_at IS NOT NULL AND last_counter < $2;
+	`
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(c, query, userID, counter)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+// UseRecoveryCode burns the recovery code code of userID, it reports false
+// for unknown or used codes. The salted hashes can't be looked up, so code
+// is compared with each unused one.
+func (s *TwoFactorStore) UseRecoveryCode(c context.Context, userID int64, code string) (bool, error) {
+	query := `SELECT code FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL;`
+
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(c, query, userID)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	var match []byte
+	for rows.Next() {
+		var hash []byte
+		if err := rows.Scan(&hash); err != nil {
+			return false, err
+		}
+		if bcrypt.CompareHashAndPassword(hash, []byte(code)) == nil {
+			match = hash
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+	if match == nil {
+		return false, nil
+	}
+
+	// a concurrent use of the same code leaves nothing to update
+	query = `
+		UPDATE recovery_codes SET used_at = NOW()
+		WHERE user_id = $1 AND code = $2 AND used_at IS NULL;
+	`
+	res, err := s.db.ExecContext(c, query, userID, match)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+// CreateChallenge stores the hash of a challenge token for userID, dropping
+// the expired challenges of the user on the way
+func (s *TwoFactorStore) CreateChallenge(c context.Context, userID int64, token string, exp time.Duration) error {
+	return withTx(s.db, c, func(tx *sql.Tx) error {
+		c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+		defer cancel()
+
+		query := `DELETE FROM two_factor_challenges WHERE user_id = $1 AND expiry <= NOW();`
+		if _, err := tx.ExecContext(c, query, userID); err != nil {
+			return err
+		}
+
+		query = `INSERT INTO two_factor_challenges (token, user_id, expiry) VALUES ($1, $2, $3);`
+		_, err := tx.ExecContext(c, query, token, userID, time.Now().Add(exp))
+		return err
+	})
+}
+
+// AttemptChallenge counts an attempt at the challenge token and returns its
+// user. Unknown and expired challenges, or those that had maxAttempts
+// already, return ErrNotFound.
+func (s *TwoFactorStore) AttemptChallenge(c context.Context, token string, maxAttempts int) (int64, error) {
+	query := `
+		UPDATE two_factor_challenges SET attempts = attempts + 1
+		WHERE token = $1 AND expiry > NOW() AND attempts < $2
+		RETURNING user_id;
+	`
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	hash := sha256.Sum256([]byte(token))
+	hashToken := hex.EncodeToString(hash[:])
+
+	var userID int64
+	if err := s.db.QueryRowContext(c, query, hashToken, maxAttempts).Scan(&userID); err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return 0, ErrNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	return userID, nil
+}
+
+// DeleteChallenge drops the challenge token once it was answered
+func (s *TwoFactorStore) DeleteChallenge(c context.Context, token string) error {
+	query := `DELETE FROM two_factor_challenges WHERE token = $1;`
+
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	hash := sha256.Sum256([]byte(token))
+	hashToken := hex.EncodeToString(hash[:])
+
+	_, err := s.db.ExecContext(c, query, hashToken)
+	return err
+}
@@ -0,0 +1,267 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ekachaikeaw/social/internal/username"
+)
+
+var ErrUsernameCooldown = errors.New("username was changed too recently")
+
+// UsernameChange is a username a user gave up, HeldUntil is when others may
+// register it
+type UsernameChange struct {
+	Username  string    `json:"username"`
+	ChangedAt time.Time `json:"changed_at"`
+	HeldUntil time.Time `json:"held_until"`
+}
+
+// usernameTakenSQL reports whether the username in parameter n, or its
+// skeleton in parameter m, belongs to a user or is held after a change.
+// With self set, the user in that parameter doesn't count, so they can get
+// back their own names.
+func usernameTakenSQL(n, m, self int) string {
+	var exclude, excludeHeld string
+	if self > 0 {
+		exclude = fmt.Sprintf(" AND tu.id <> $%d", self)
+		excludeHeld = fmt.Sprintf(" AND th.user_id <> $%d", self)
+	}
+
+	return fmt.Sprintf(`
+		(EXISTS (
+			SELECT 1 FROM users tu
+			WHERE (tu.username = $%[1]d OR tu.username_skeleton = $%[2]d)%[3]s
+		) OR EXISTS (
+			SELECT 1 FROM username_history th
+			WHERE (th.username = $%[1]d OR th.username_skeleton = $%[2]d)
+				AND th.held_until > NOW()%[4]s
+		))`, n, m, exclude, excludeHeld)
+}
+
+// ChangeUsername renames userID to name and returns when it happened. The
+// old name stays in the history and is held until hold has passed. Users
+// who changed their name within cooldown get ErrUsernameCooldown with the
+// time of that change, names that are taken, held or too close to either
+// ErrDuplicateUsername.
+func (s *UserStore) ChangeUsername(c context.Context, userID int64, name string, cooldown, hold time.Duration) (time.Time, error) {
+	var changedAt time.Time
+
+	err := withTx(s.db, c, func(tx *sql.Tx) error {
+		c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+		defer cancel()
+
+		var old string
+		var lastChange *time.Time
+		query := `SELECT username, username_changed_at FROM users WHERE id = $1 AND is_active = true FOR UPDATE;`
+		if err := tx.QueryRowContext(c, query, userID).Scan(&old, &lastChange); err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		if lastChange != nil && time.Since(*lastChange) < cooldown {
+			changedAt = *lastChange
+			return ErrUsernameCooldown
+		}
+
+		skeleton := username.Skeleton(name)
+
+		var taken bool
+		query = `SELECT` + usernameTakenSQL(1, 2, 3) + `;`
+		if err := tx.QueryRowContext(c, query, name, skeleton, userID).Scan(&taken); err != nil {
+			return err
+		}
+		if taken {
+			return ErrDuplicateUsername
+		}
+
+		// a change of case keeps the handle, there is nothing to hold
+		if !strings.EqualFold(old, name) {
+			query = `
+				INSERT INTO username_history (user_id, username, username_skeleton, held_until)
+				VALUES ($1, $2, $3, $4);
+			`
+			if _, err := tx.ExecContext(c, query, userID, old, username.Skeleton(old), time.Now().Add(hold)); err != nil {
+				return err
+			}
+		}
+
+		query = `
+			UPDATE users SET username = $1, username_skeleton = $2, username_changed_at = NOW()
+			WHERE id = $3
+			RETURNING username_changed_at;
+		`
+		if err := tx.QueryRowContext(c, query, name, skeleton, userID).Scan(&changedAt); err != nil {
+			return uniqueUserErr(err)
+		}
+
+		return nil
+	})
+	if err == ErrUsernameCooldown {
+		return changedAt, err
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return changedAt, nil
+}
+
+// ResolveUsername finds the active user named name, or the one who last
+// gave it up when nobody took it since. The returned user only carries the
+// id and current username.
+func (s *UserStore) ResolveUsername(c context.Context, name string) (*User, error) {
+	query := `
+		SELECT id, username FROM (
+			SELECT id, username, 0 AS rank, NOW() AS changed_at
+			FROM users
+			WHERE username = $1 AND is_active = true
+			UNION ALL
+			SELECT u.id, u.username, 1, h.changed_at
+			FROM username_history h
+			JOIN users u ON u.id = h.user_id
+			WHERE h.username = $1 AND u.is_active = true
+		) r
+		ORDER BY rank, changed_at DESC
+		LIMIT 1;
+	`
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	var user User
+	if err := s.db.QueryRowContext(c, query, name).Scan(&user.ID, &user.Username); err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+// GetUsernameHistory lists the names userID gave up, most recent first
+func (s *UserStore) GetUsernameHistory(c context.Context, userID int64) ([]UsernameChange, error) {
+	query := `
+		SELECT username, changed_at, held_until
+		FROM username_history
+		WHERE user_id = $1
+		ORDER BY changed_at DESC, id DESC;
+	`
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(c, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []UsernameChange{}
+	for rows.Next() {
+		var h UsernameChange
+		if err := rows.Scan(&h.Username, &h.ChangedAt, &h.HeldUntil); err != nil {
+			return nil, err
+		}
+
+		history = append(history, h)
+	}
+
+	return history, rows.Err()
+}
+
+// BackfillSkeletons stores the skeleton of the users that have none yet, a
+// batch at a time, and returns how many were filled and how many were left
+// without one. Those are lookalikes of an account that has the skeleton
+// already, so they stay covered by it and are flagged to be passed over
+// from then on.
+func (s *UserStore) BackfillSkeletons(c context.Context, batch int) (int, int, error) {
+	var filled, skipped int
+	var after int64
+
+	for {
+		users, err := s.withoutSkeleton(c, after, batch)
+		if err != nil {
+			return filled, skipped, err
+		}
+
+		for _, u := range users {
+			ok, err := s.setSkeleton(c, u.ID, username.Skeleton(u.Username))
+			if err != nil {
+				return filled, skipped, err
+			}
+			if ok {
+				filled++
+			} else {
+				skipped++
+			}
+			after = u.ID
+		}
+
+		if len(users) < batch {
+			return filled, skipped, nil
+		}
+	}
+}
+
+func (s *UserStore) withoutSkeleton(c context.Context, after int64, limit int) ([]User, error) {
+	query := `
+		SELECT id, username FROM users
+		WHERE username_skeleton IS NULL AND NOT username_lookalike AND id > $1
+		ORDER BY id
+		LIMIT $2;
+	`
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(c, query, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Username); err != nil {
+			return nil, err
+		}
+
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
+
+// setSkeleton reports false when another user has skeleton, userID is then
+// flagged as a lookalike
+func (s *UserStore) setSkeleton(c context.Context, userID int64, skeleton string) (bool, error) {
+	query := `UPDATE users SET username_skeleton = $1 WHERE id = $2 AND username_skeleton IS NULL;`
+
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(c, query, skeleton, userID)
+	if err == nil {
+		return true, nil
+	}
+	if uniqueUserErr(err) != ErrDuplicateUsername {
+		return false, err
+	}
+
+	query = `UPDATE users SET username_lookalike = true WHERE id = $1;`
+	if _, err := s.db.ExecContext(c, query, userID); err != nil {
+		return false, err
+	}
+
+	return false, nil
+}
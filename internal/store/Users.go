@@ -8,18 +8,29 @@ import (
 	"errors"
 	"time"
 
+	"github.com/ekachaikeaw/social/internal/username"
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type User struct {
-	ID        int64    `json:"id"`
-	Username  string   `json:"username"`
-	Email     string   `json:"email"`
-	Password  password `json:"-"`
-	CreatedAt string   `json:"created_at"`
-	IsActive  bool     `json:"is_active"`
-	RoleID    int64    `json:"role_id"`
-	Role      Role     `json:"role"`
+	ID                int64      `json:"id"`
+	Username          string     `json:"username"`
+	Email             string     `json:"email"`
+	Password          password   `json:"-"`
+	CreatedAt         string     `json:"created_at"`
+	IsActive          bool       `json:"is_active"`
+	RoleID            int64      `json:"role_id"`
+	Role              Role       `json:"role"`
+	DisplayName       string     `json:"display_name"`
+	Bio               string     `json:"bio"`
+	AvatarURL         string     `json:"avatar_url"`
+	Location          string     `json:"location"`
+	Website           string     `json:"website"`
+	PasswordChangedAt *time.Time `json:"password_changed_at,omitempty"`
+	UsernameChangedAt *time.Time `json:"username_changed_at,omitempty"`
+	DeleteAfter       *time.Time `json:"delete_after,omitempty"`
+	IsPrivate         bool       `json:"is_private"`
 }
 
 type password struct {
@@ -51,10 +62,13 @@ type UserStore struct {
 	db *sql.DB
 }
 
+// Create inserts u, usernames sharing their skeleton with an existing or
+// held one return ErrDuplicateUsername
 func (s *UserStore) Create(c context.Context, u *User, tx *sql.Tx) error {
 	query := `
-		INSERT INTO users (username, email, password, role_id)	
-		VALUES ($1, $2, $3, (SELECT id FROM roles WHERE name = $4))
+		INSERT INTO users (username, username_skeleton, email, password, role_id)
+		SELECT $1, $2, $3, $4, (SELECT id FROM roles WHERE name = $5)
+		WHERE NOT` + usernameTakenSQL(1, 2, 0) + `
 		RETURNING id, created_at;
 	`
 	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
@@ -65,24 +79,52 @@ func (s *UserStore) Create(c context.Context, u *User, tx *sql.Tx) error {
 		role = "user"
 	} 	
 
-	err := tx.QueryRowContext(c, query, u.Username, u.Email, u.Password.hash, role).
+	err := tx.QueryRowContext(c, query, u.Username, username.Skeleton(u.Username), u.Email, u.Password.hash, role).
 		Scan(&u.ID, &u.CreatedAt)
 	if err != nil {
-		switch {
-		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
-			return ErrDuplicateEmail
-		case err.Error() == `pq: duplicate key value violates unique constraint "users_username_key"`:
+		if err == sql.ErrNoRows {
 			return ErrDuplicateUsername
-		default:
-			return err
 		}
+		return uniqueUserErr(err)
 	}
 	return nil
 }
 
+// UsernameAvailable reports whether name is neither taken or held, in any
+// case, nor too close to a taken or held username
+func (s *UserStore) UsernameAvailable(c context.Context, name string) (bool, error) {
+	query := `SELECT NOT` + usernameTakenSQL(1, 2, 0) + `;`
+
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	var available bool
+	if err := s.db.QueryRowContext(c, query, name, username.Skeleton(name)).Scan(&available); err != nil {
+		return false, err
+	}
+
+	return available, nil
+}
+
+// uniqueUserErr maps unique violations on users to ErrDuplicateEmail and
+// ErrDuplicateUsername, a lookalike registered concurrently trips the
+// skeleton index
+func uniqueUserErr(err error) error {
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		switch pqErr.Constraint {
+		case "users_email_key":
+			return ErrDuplicateEmail
+		case "users_username_key", "users_username_skeleton_key":
+			return ErrDuplicateUsername
+		}
+	}
+	return err
+}
+
 func (s *UserStore) GetByID(c context.Context, userID int64) (*User, error) {
 	query := `
-		SELECT users.id, username, email, password, created_at, roles.* 
+		SELECT users.id, username, email, password, created_at,
+			display_name, bio, avatar_url, location, website, password_changed_at, username_changed_at, delete_after, is_private, roles.*
 		FROM users
 		JOIN roles ON users.role_id = roles.id
 		WHERE users.id = $1 AND is_active = true;	
@@ -100,6 +142,15 @@ func (s *UserStore) GetByID(c context.Context, userID int64) (*User, error) {
 			&user.Email,
 			&user.Password.hash,
 			&user.CreatedAt,
+			&user.DisplayName,
+			&user.Bio,
+			&user.AvatarURL,
+			&user.Location,
+			&user.Website,
+			&user.PasswordChangedAt,
+			&user.UsernameChangedAt,
+			&user.DeleteAfter,
+			&user.IsPrivate,
 			&user.Role.ID,
 			&user.Role.Name,
 			&user.Role.Level,
@@ -120,7 +171,7 @@ func (s *UserStore) GetByID(c context.Context, userID int64) (*User, error) {
 
 func (s *UserStore) GetByEmail(c context.Context, email string) (*User, error) {
 	query := `
-		SELECT id, username, email, password, created_at
+		SELECT id, username, email, password, created_at, delete_after
 		FROM users
 		WHERE email = $1 AND is_active = true;	
 	`
@@ -135,6 +186,7 @@ func (s *UserStore) GetByEmail(c context.Context, email string) (*User, error) {
 			&user.Email,
 			&user.Password.hash,
 			&user.CreatedAt,
+			&user.DeleteAfter,
 		)
 	if err != nil {
 		switch err {
@@ -148,6 +200,443 @@ func (s *UserStore) GetByEmail(c context.Context, email string) (*User, error) {
 	return &user, nil
 }
 
+func (s *UserStore) GetByUsername(c context.Context, username string) (*User, error) {
+	query := `
+		SELECT id, username, email, password, created_at
+		FROM users
+		WHERE username = $1 AND is_active = true;	
+	`
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	var user User
+	err := s.db.QueryRowContext(c, query, username).
+		Scan(
+			&user.ID,
+			&user.Username,
+			&user.Email,
+			&user.Password.hash,
+			&user.CreatedAt,
+		)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+// UserStats are the counts shown on a profile and how it relates to the
+// user looking at it
+type UserStats struct {
+	FollowersCount int64 `json:"followers_count"`
+	FollowingCount int64 `json:"following_count"`
+	PostsCount     int64 `json:"posts_count"`
+	IsFollowing    bool  `json:"is_following"`
+	FollowsYou     bool  `json:"follows_you"`
+}
+
+// GetStats counts the followers, follows and posts of userID. IsFollowing
+// and FollowsYou are seen from viewerID.
+func (s *UserStore) GetStats(c context.Context, userID, viewerID int64) (*UserStats, error) {
+	query := `
+		SELECT
+			(SELECT COUNT(*) FROM followers f JOIN users u ON u.id = f.follower_id
+				WHERE f.user_id = $1 AND u.is_active = true),
+			(SELECT COUNT(*) FROM followers f JOIN users u ON u.id = f.user_id
+				WHERE f.follower_id = $1 AND u.is_active = true),
+			(SELECT COUNT(*) FROM posts WHERE user_id = $1),
+			EXISTS (SELECT 1 FROM followers WHERE user_id = $1 AND follower_id = $2),
+			EXISTS (SELECT 1 FROM followers WHERE user_id = $2 AND follower_id = $1);
+	`
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	var stats UserStats
+	err := s.db.QueryRowContext(c, query, userID, viewerID).Scan(
+		&stats.FollowersCount,
+		&stats.FollowingCount,
+		&stats.PostsCount,
+		&stats.IsFollowing,
+		&stats.FollowsYou,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+// UpdateProfile saves the profile fields of an active user. Making the
+// account public approves its pending follow requests, the ids of the
+// approved followers are returned.
+func (s *UserStore) UpdateProfile(c context.Context, u *User) ([]int64, error) {
+	approved := []int64{}
+
+	err := withTx(s.db, c, func(tx *sql.Tx) error {
+		query := `
+			UPDATE users
+			SET display_name = $1, bio = $2, avatar_url = $3, location = $4, website = $5, is_private = $6
+			WHERE id = $7 AND is_active = true;
+		`
+		qc, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+		defer cancel()
+
+		res, err := tx.ExecContext(qc, query, u.DisplayName, u.Bio, u.AvatarURL, u.Location, u.Website, u.IsPrivate, u.ID)
+		if err != nil {
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			return ErrNotFound
+		}
+
+		if u.IsPrivate {
+			return nil
+		}
+
+		query = `
+			WITH approved AS (
+				DELETE FROM follow_requests WHERE user_id = $1
+				RETURNING user_id, follower_id
+			)
+			INSERT INTO followers (user_id, follower_id)
+			SELECT user_id, follower_id FROM approved
+			ON CONFLICT DO NOTHING
+			RETURNING follower_id;
+		`
+		followers, err := tx.QueryContext(qc, query, u.ID)
+		if err != nil {
+			return err
+		}
+		defer followers.Close()
+
+		for followers.Next() {
+			var id int64
+			if err := followers.Scan(&id); err != nil {
+				return err
+			}
+			approved = append(approved, id)
+		}
+
+		return followers.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return approved, nil
+}
+
+// ChangePassword stores the new password of u and drops any pending reset
+func (s *UserStore) ChangePassword(c context.Context, u *User) error {
+	return withTx(s.db, c, func(tx *sql.Tx) error {
+		if err := s.updatePassword(c, tx, u); err != nil {
+			return err
+		}
+
+		return s.deletePasswordResets(c, tx, u.ID)
+	})
+}
+
+// CreatePasswordReset stores the hash of a reset token, replacing the
+// previous token of the user so only the latest email works
+func (s *UserStore) CreatePasswordReset(c context.Context, userID int64, token string, exp time.Duration) error {
+	return withTx(s.db, c, func(tx *sql.Tx) error {
+		if err := s.deletePasswordResets(c, tx, userID); err != nil {
+			return err
+		}
+
+		query := `INSERT INTO password_resets (token, user_id, expiry) VALUES ($1, $2, $3);`
+
+		c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+		defer cancel()
+
+		_, err := tx.ExecContext(c, query, token, userID, time.Now().Add(exp))
+		return err
+	})
+}
+
+// ResetPassword consumes a reset token and sets the password of its user
+// to u.Password. Unknown, used and expired tokens return ErrNotFound.
+func (s *UserStore) ResetPassword(c context.Context, token string, u *User) error {
+	return withTx(s.db, c, func(tx *sql.Tx) error {
+		query := `
+			DELETE FROM password_resets
+			WHERE token = $1 AND expiry > $2
+			RETURNING user_id;
+		`
+		qc, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+		defer cancel()
+
+		hash := sha256.Sum256([]byte(token))
+		hashToken := hex.EncodeToString(hash[:])
+
+		err := tx.QueryRowContext(qc, query, hashToken, time.Now()).Scan(&u.ID)
+		if err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		if err := s.updatePassword(c, tx, u); err != nil {
+			return err
+		}
+
+		return s.deletePasswordResets(c, tx, u.ID)
+	})
+}
+
+// updatePassword sets the password of u and revokes their refresh tokens
+// and pending 2FA challenges, the access tokens issued before are refused
+// from password_changed_at on. The column would round NOW() to the nearest
+// second, possibly after the issue time of the tokens handed out next, so
+// it is truncated like iat is.
+func (s *UserStore) updatePassword(c context.Context, tx *sql.Tx, u *User) error {
+	query := `
+		WITH revoked AS (
+			DELETE FROM refresh_tokens WHERE user_id = $2
+		), challenges AS (
+			DELETE FROM two_factor_challenges WHERE user_id = $2
+		)
+		UPDATE users SET password = $1, password_changed_at = date_trunc('second', NOW())
+		WHERE id = $2 AND is_active = true
+		RETURNING password_changed_at;
+	`
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	err := tx.QueryRowContext(c, query, u.Password.hash, u.ID).Scan(&u.PasswordChangedAt)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *UserStore) deletePasswordResets(c context.Context, tx *sql.Tx, userID int64) error {
+	query := `DELETE FROM password_resets WHERE user_id = $1;`
+
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(c, query, userID)
+	return err
+}
+
+// EmailChange describes an address swap of a user. OldEmail is the address
+// that was replaced and NewEmail the one in effect afterwards.
+type EmailChange struct {
+	UserID   int64
+	Username string
+	OldEmail string
+	NewEmail string
+}
+
+// RequestEmailChange stores the hash of a confirmation token for the new
+// address, replacing any pending request of the user
+func (s *UserStore) RequestEmailChange(c context.Context, userID int64, email, token string, exp time.Duration) error {
+	return withTx(s.db, c, func(tx *sql.Tx) error {
+		qc, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+		defer cancel()
+
+		var taken bool
+		query := `SELECT EXISTS (SELECT 1 FROM users WHERE email = $1);`
+		if err := tx.QueryRowContext(qc, query, email).Scan(&taken); err != nil {
+			return err
+		}
+		if taken {
+			return ErrDuplicateEmail
+		}
+
+		if err := s.deleteEmailChanges(c, tx, userID); err != nil {
+			return err
+		}
+
+		query = `INSERT INTO email_changes (token, user_id, email, expiry) VALUES ($1, $2, $3, $4);`
+
+		_, err := tx.ExecContext(qc, query, token, userID, email, time.Now().Add(exp))
+		return err
+	})
+}
+
+// ConfirmEmailChange consumes a confirmation token and switches the user to
+// the new address. The hash of revertToken is stored so the previous owner of
+// the account can undo the change within revertExp.
+func (s *UserStore) ConfirmEmailChange(c context.Context, token, revertToken string, revertExp time.Duration) (*EmailChange, error) {
+	var change EmailChange
+
+	err := withTx(s.db, c, func(tx *sql.Tx) error {
+		query := `
+			DELETE FROM email_changes
+			WHERE token = $1 AND expiry > $2
+			RETURNING user_id, email;
+		`
+		if err := s.consumeEmailToken(c, tx, query, token, &change); err != nil {
+			return err
+		}
+
+		if err := s.setEmail(c, tx, &change); err != nil {
+			return err
+		}
+
+		if err := s.deleteEmailChanges(c, tx, change.UserID); err != nil {
+			return err
+		}
+
+		query = `INSERT INTO email_reverts (token, user_id, email, expiry) VALUES ($1, $2, $3, $4);`
+
+		qc, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+		defer cancel()
+
+		_, err := tx.ExecContext(qc, query, revertToken, change.UserID, change.OldEmail, time.Now().Add(revertExp))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &change, nil
+}
+
+// RevertEmailChange consumes a revert token and restores the address it was
+// issued for. Pending changes and every other revert token of the user are
+// dropped so the account can't be moved away again with an older link, and
+// the user is signed out everywhere since whoever changed the address may
+// still hold a session.
+func (s *UserStore) RevertEmailChange(c context.Context, token string) (*EmailChange, error) {
+	var change EmailChange
+
+	err := withTx(s.db, c, func(tx *sql.Tx) error {
+		query := `
+			DELETE FROM email_reverts
+			WHERE token = $1 AND expiry > $2
+			RETURNING user_id, email;
+		`
+		if err := s.consumeEmailToken(c, tx, query, token, &change); err != nil {
+			return err
+		}
+
+		if err := s.setEmail(c, tx, &change); err != nil {
+			return err
+		}
+
+		if err := s.deleteEmailChanges(c, tx, change.UserID); err != nil {
+			return err
+		}
+
+		query = `DELETE FROM email_reverts WHERE user_id = $1;`
+
+		qc, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+		defer cancel()
+
+		if _, err := tx.ExecContext(qc, query, change.UserID); err != nil {
+			return err
+		}
+
+		return s.signOut(c, tx, change.UserID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &change, nil
+}
+
+// signOut ends every session of userID without touching the password: the
+// refresh tokens, 2FA challenges and password resets are dropped and the
+// access tokens issued before are refused like after a password change
+func (s *UserStore) signOut(c context.Context, tx *sql.Tx, userID int64) error {
+	query := `
+		WITH revoked AS (
+			DELETE FROM refresh_tokens WHERE user_id = $1
+		), challenges AS (
+			DELETE FROM two_factor_challenges WHERE user_id = $1
+		), resets AS (
+			DELETE FROM password_resets WHERE user_id = $1
+		)
+		UPDATE users SET password_changed_at = date_trunc('second', NOW())
+		WHERE id = $1;
+	`
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(c, query, userID)
+	return err
+}
+
+// consumeEmailToken runs a DELETE ... RETURNING user_id, email query for the
+// hash of token and fills the user and the target address of change
+func (s *UserStore) consumeEmailToken(c context.Context, tx *sql.Tx, query, token string, change *EmailChange) error {
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	hash := sha256.Sum256([]byte(token))
+	hashToken := hex.EncodeToString(hash[:])
+
+	err := tx.QueryRowContext(c, query, hashToken, time.Now()).Scan(&change.UserID, &change.NewEmail)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *UserStore) setEmail(c context.Context, tx *sql.Tx, change *EmailChange) error {
+	query := `
+		UPDATE users u SET email = $1
+		FROM (SELECT id, email FROM users WHERE id = $2 AND is_active = true FOR UPDATE) old
+		WHERE u.id = old.id
+		RETURNING u.username, old.email;
+	`
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	err := tx.QueryRowContext(c, query, change.NewEmail, change.UserID).Scan(&change.Username, &change.OldEmail)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return ErrNotFound
+		default:
+			return uniqueUserErr(err)
+		}
+	}
+
+	return nil
+}
+
+func (s *UserStore) deleteEmailChanges(c context.Context, tx *sql.Tx, userID int64) error {
+	query := `DELETE FROM email_changes WHERE user_id = $1;`
+
+	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(c, query, userID)
+	return err
+}
+
 func (s *UserStore) CreateAndInvite(c context.Context, u *User, token string, inviteExp time.Duration) error {
 	return withTx(s.db, c, func(tx *sql.Tx) error {
 		if err := s.Create(c, u, tx); err != nil {
@@ -162,6 +651,43 @@ func (s *UserStore) CreateAndInvite(c context.Context, u *User, token string, in
 	})
 }
 
+// RenewInvitation replaces the invitation of the inactive user with the given
+// email by a new token. Unknown and already active users return ErrNotFound.
+func (s *UserStore) RenewInvitation(c context.Context, email, token string, exp time.Duration) (*User, error) {
+	var user User
+
+	err := withTx(s.db, c, func(tx *sql.Tx) error {
+		query := `
+			SELECT id, username, email FROM users
+			WHERE email = $1 AND is_active = false
+			FOR UPDATE;
+		`
+		qc, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+		defer cancel()
+
+		err := tx.QueryRowContext(qc, query, email).Scan(&user.ID, &user.Username, &user.Email)
+		if err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		if err := s.deleteUserInvitation(c, tx, user.ID); err != nil {
+			return err
+		}
+
+		return s.createUserInvitation(c, tx, token, exp, user.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
 func (s *UserStore) Activate(c context.Context, token string) error {
 	return withTx(s.db, c, func(tx *sql.Tx) error {
 		// 1. find the user this token belong to
@@ -0,0 +1,123 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPurgeDeleted(t *testing.T) {
+	s, db := newTestStorage(t)
+	c := context.Background()
+
+	alice := createTestUser(t, s, db, "alice")
+	bob := createTestUser(t, s, db, "bob")
+	carol := createTestUser(t, s, db, "carol")
+
+	for _, u := range []*User{alice, carol} {
+		post := createTestPost(t, s, u.ID, "hello", nil)
+		if err := s.Comment.Create(c, &Comment{PostID: post.ID, UserID: bob.ID, Content: "hi"}); err != nil {
+			t.Fatal(err)
+		}
+		follow(t, s, bob.ID, u.ID)
+		follow(t, s, u.ID, bob.ID)
+	}
+
+	if err := s.RefreshToken.Create(c, alice.ID, "session", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	past := time.Now().Add(-time.Minute)
+	if err := s.Users.ScheduleDeletion(c, alice.ID, past); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(t, db, `SELECT count(*) FROM refresh_tokens WHERE user_id = $1`, alice.ID); n != 0 {
+		t.Errorf("expected the sessions revoked on scheduling, %d left", n)
+	}
+
+	t.Run("should delete everything the user owns", func(t *testing.T) {
+		users, err := s.Users.PurgeDeleted(c, false, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(users) != 1 || users[0].ID != alice.ID {
+			t.Fatalf("purged %v, want user %d", users, alice.ID)
+		}
+
+		if n := count(t, db, `SELECT count(*) FROM users WHERE id = $1`, alice.ID); n != 0 {
+			t.Error("expected the user deleted")
+		}
+		if n := count(t, db, `SELECT count(*) FROM posts WHERE user_id = $1`, alice.ID); n != 0 {
+			t.Errorf("expected the posts deleted, %d left", n)
+		}
+		// comments of others under the deleted posts go with them
+		if n := count(t, db, `SELECT count(*) FROM comments WHERE user_id = $1`, bob.ID); n != 1 {
+			t.Errorf("expected bob's comment on carol's post only, got %d", n)
+		}
+		if n := count(t, db, `SELECT count(*) FROM followers WHERE user_id = $1 OR follower_id = $1`, alice.ID); n != 0 {
+			t.Errorf("expected the follows deleted, %d left", n)
+		}
+	})
+
+	t.Run("should keep the posts of an anonymized user", func(t *testing.T) {
+		if err := s.Users.ScheduleDeletion(c, carol.ID, past); err != nil {
+			t.Fatal(err)
+		}
+
+		users, err := s.Users.PurgeDeleted(c, true, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(users) != 1 || users[0].ID != carol.ID {
+			t.Fatalf("purged %v, want user %d", users, carol.ID)
+		}
+
+		var username, email string
+		var active bool
+		err = db.QueryRow(`SELECT username, email, is_active FROM users WHERE id = $1`, carol.ID).Scan(&username, &email, &active)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if username == carol.Username || email == carol.Email || active {
+			t.Errorf("expected a placeholder, got %q %q active %v", username, email, active)
+		}
+
+		if n := count(t, db, `SELECT count(*) FROM posts WHERE user_id = $1`, carol.ID); n != 1 {
+			t.Errorf("expected the post kept, got %d", n)
+		}
+		if n := count(t, db, `SELECT count(*) FROM followers WHERE user_id = $1 OR follower_id = $1`, carol.ID); n != 0 {
+			t.Errorf("expected the follows deleted, %d left", n)
+		}
+
+		// nothing is due anymore
+		users, err = s.Users.PurgeDeleted(c, true, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(users) != 0 {
+			t.Errorf("purged %v twice", users)
+		}
+	})
+}
+
+func TestCancelDeletion(t *testing.T) {
+	s, db := newTestStorage(t)
+	c := context.Background()
+
+	alice := createTestUser(t, s, db, "alice")
+
+	if err := s.Users.ScheduleDeletion(c, alice.ID, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Users.CancelDeletion(c, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	users, err := s.Users.PurgeDeleted(c, false, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 0 {
+		t.Errorf("purged %v after the deletion was cancelled", users)
+	}
+}
@@ -0,0 +1,114 @@
+package store
+
+import (
+	"context"
+	"testing"
+)
+
+func TestBlock(t *testing.T) {
+	s, db := newTestStorage(t)
+	c := context.Background()
+
+	alice := createTestUser(t, s, db, "alice")
+	bob := createTestUser(t, s, db, "bob")
+
+	follow(t, s, alice.ID, bob.ID)
+	follow(t, s, bob.ID, alice.ID)
+	alicePost := createTestPost(t, s, alice.ID, "from alice", nil)
+	bobPost := createTestPost(t, s, bob.ID, "from bob", nil)
+
+	if err := s.Block.Block(c, &BlockedUser{UserID: alice.ID, BlockedUserID: bob.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should drop the follows both ways", func(t *testing.T) {
+		n := count(t, db, `SELECT count(*) FROM followers WHERE user_id = ANY(ARRAY[$1, $2]::bigint[])`, alice.ID, bob.ID)
+		if n != 0 {
+			t.Errorf("%d follows left", n)
+		}
+	})
+
+	t.Run("should refuse new follows both ways", func(t *testing.T) {
+		if _, err := s.Follower.Follow(c, bob.ID, alice.ID); err != ErrBlocked {
+			t.Errorf("blocked user follows: %v, want %v", err, ErrBlocked)
+		}
+		if _, err := s.Follower.Follow(c, alice.ID, bob.ID); err != ErrBlocked {
+			t.Errorf("blocking user follows: %v, want %v", err, ErrBlocked)
+		}
+	})
+
+	t.Run("should hide the posts both ways", func(t *testing.T) {
+		for _, tt := range []struct {
+			viewer *User
+			post   *Post
+		}{
+			{alice, bobPost},
+			{bob, alicePost},
+		} {
+			posts, err := s.Posts.GetByIDs(c, tt.viewer.ID, []int64{tt.post.ID})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(posts) != 0 {
+				t.Errorf("%s sees %v", tt.viewer.Username, postIDs(posts))
+			}
+
+			visible, err := s.Follower.CanSee(c, tt.viewer.ID, tt.post.UserID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if visible {
+				t.Errorf("%s can see user %d", tt.viewer.Username, tt.post.UserID)
+			}
+
+			unblocked, err := s.Block.NotBlocked(c, tt.viewer.ID, tt.post.UserID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if unblocked {
+				t.Errorf("%s is not blocked from user %d", tt.viewer.Username, tt.post.UserID)
+			}
+		}
+	})
+
+	t.Run("should refuse blocking twice or an unknown user", func(t *testing.T) {
+		if err := s.Block.Block(c, &BlockedUser{UserID: alice.ID, BlockedUserID: bob.ID}); err != ErrConflict {
+			t.Errorf("second block: %v, want %v", err, ErrConflict)
+		}
+		if err := s.Block.Block(c, &BlockedUser{UserID: alice.ID, BlockedUserID: -1}); err != ErrNotFound {
+			t.Errorf("unknown user: %v, want %v", err, ErrNotFound)
+		}
+	})
+
+	t.Run("should list the blocked users", func(t *testing.T) {
+		blocked, err := s.Block.GetBlockedUsers(c, alice.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(blocked) != 1 || blocked[0].BlockedUserID != bob.ID || blocked[0].Username != bob.Username {
+			t.Errorf("unexpected blocked users %+v", blocked)
+		}
+	})
+
+	t.Run("should show the posts again without the follows", func(t *testing.T) {
+		if err := s.Block.Unblock(c, alice.ID, bob.ID); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Block.Unblock(c, alice.ID, bob.ID); err != ErrNotFound {
+			t.Errorf("second unblock: %v, want %v", err, ErrNotFound)
+		}
+
+		posts, err := s.Posts.GetByIDs(c, alice.ID, []int64{bobPost.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(posts) != 1 {
+			t.Errorf("expected bob's post after the unblock, got %v", postIDs(posts))
+		}
+
+		n := count(t, db, `SELECT count(*) FROM followers WHERE user_id = ANY(ARRAY[$1, $2]::bigint[])`, alice.ID, bob.ID)
+		if n != 0 {
+			t.Errorf("expected the follows not restored, got %d", n)
+		}
+	})
+}
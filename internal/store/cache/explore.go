@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ekachaikeaw/social/internal/store"
+	"github.com/go-redis/redis/v8"
+)
+
+// ExploreExpTime is kept short, explore is meant to absorb bursts of reads
+// and go stale quickly
+const ExploreExpTime = time.Second * 30
+
+type ExplorePage struct {
+	Posts []store.PostWithMetadata `json:"posts"`
+	Next  *store.Cursor            `json:"next"`
+}
+
+type ExploreStore struct {
+	rdb *redis.Client
+}
+
+func (s *ExploreStore) Get(c context.Context, userID int64, query string) (*ExplorePage, error) {
+	data, err := s.rdb.Get(c, exploreKey(userID, query)).Result()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var page ExplorePage
+	if err := json.Unmarshal([]byte(data), &page); err != nil {
+		return nil, err
+	}
+
+	return &page, nil
+}
+
+func (s *ExploreStore) Set(c context.Context, userID int64, query string, page *ExplorePage) error {
+	data, err := json.Marshal(page)
+	if err != nil {
+		return err
+	}
+
+	return s.rdb.SetEX(c, exploreKey(userID, query), data, ExploreExpTime).Err()
+}
+
+func exploreKey(userID int64, query string) string {
+	return fmt.Sprintf("explore-%d-%s", userID, query)
+}
@@ -10,7 +10,12 @@ type MockUserStore struct{}
 
 func NewMockStore() Storage {
 	return Storage{
-		&MockUserStore{},
+		Users:       &MockUserStore{},
+		Timelines:   &MockTimelineStore{},
+		Explore:     &MockExploreStore{},
+		Suggestions: &MockSuggestionStore{},
+		Revocations: NewMemoryRevocationStore(),
+		Presence:    NewMemoryPresenceStore(),
 	}
 }
 
@@ -24,3 +29,40 @@ func (s *MockUserStore) Set(context.Context, *store.User) error {
 func (s *MockUserStore) Delete(context.Context, int64) {
 	
 }
+
+type MockTimelineStore struct{}
+
+func (s *MockTimelineStore) Get(context.Context, int64, store.PaginatedQuery) ([]TimelineEntry, bool, error) {
+	return nil, false, nil
+}
+func (s *MockTimelineStore) Set(context.Context, int64, []TimelineEntry) error {
+	return nil
+}
+func (s *MockTimelineStore) Push(context.Context, TimelineEntry, []int64) error {
+	return nil
+}
+func (s *MockTimelineStore) Add(context.Context, int64, []TimelineEntry) error {
+	return nil
+}
+func (s *MockTimelineStore) Remove(context.Context, int64, []int64) error {
+	return nil
+}
+
+type MockExploreStore struct{}
+
+func (s *MockExploreStore) Get(context.Context, int64, string) (*ExplorePage, error) {
+	return nil, nil
+}
+func (s *MockExploreStore) Set(context.Context, int64, string, *ExplorePage) error {
+	return nil
+}
+
+type MockSuggestionStore struct{}
+
+func (s *MockSuggestionStore) Get(context.Context, int64) ([]store.SuggestedUser, error) {
+	return nil, nil
+}
+func (s *MockSuggestionStore) Set(context.Context, int64, []store.SuggestedUser) error {
+	return nil
+}
+func (s *MockSuggestionStore) Delete(context.Context, int64) {}
@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// PresenceStore tracks the open connections of each user. Connections are
+// touched periodically and expire on their own if an instance goes away
+// without saying goodbye.
+type PresenceStore struct {
+	rdb *redis.Client
+}
+
+// Touch records connID as alive for ttl and reports whether the user just
+// came online
+func (s *PresenceStore) Touch(c context.Context, userID int64, connID string, ttl time.Duration) (bool, error) {
+	key := presenceKey(userID)
+	now := time.Now()
+
+	var before *redis.IntCmd
+	_, err := s.rdb.TxPipelined(c, func(pipe redis.Pipeliner) error {
+		pipe.ZRemRangeByScore(c, key, "-inf", strconv.FormatInt(now.UnixMilli(), 10))
+		before = pipe.ZCard(c, key)
+		pipe.ZAdd(c, key, &redis.Z{Score: float64(now.Add(ttl).UnixMilli()), Member: connID})
+		pipe.Expire(c, key, ttl)
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return before.Val() == 0, nil
+}
+
+// Leave removes connID and reports whether the user went offline
+func (s *PresenceStore) Leave(c context.Context, userID int64, connID string) (bool, error) {
+	key := presenceKey(userID)
+
+	var after *redis.IntCmd
+	_, err := s.rdb.TxPipelined(c, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(c, key, connID)
+		pipe.ZRemRangeByScore(c, key, "-inf", strconv.FormatInt(time.Now().UnixMilli(), 10))
+		after = pipe.ZCard(c, key)
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return after.Val() == 0, nil
+}
+
+func (s *PresenceStore) IsOnline(c context.Context, userID int64) (bool, error) {
+	n, err := s.rdb.ZCount(c, presenceKey(userID), strconv.FormatInt(time.Now().UnixMilli(), 10), "+inf").Result()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+func presenceKey(userID int64) string {
+	return fmt.Sprintf("presence-%d", userID)
+}
+
+// MemoryPresenceStore is the single instance fallback when Redis is off
+type MemoryPresenceStore struct {
+	sync.Mutex
+	conns map[int64]map[string]time.Time
+}
+
+func NewMemoryPresenceStore() *MemoryPresenceStore {
+	return &MemoryPresenceStore{conns: make(map[int64]map[string]time.Time)}
+}
+
+func (s *MemoryPresenceStore) Touch(c context.Context, userID int64, connID string, ttl time.Duration) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	conns := s.live(userID)
+	online := len(conns) > 0
+	if conns == nil {
+		conns = make(map[string]time.Time)
+		s.conns[userID] = conns
+	}
+	conns[connID] = time.Now().Add(ttl)
+
+	return !online, nil
+}
+
+func (s *MemoryPresenceStore) Leave(c context.Context, userID int64, connID string) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	conns := s.live(userID)
+	delete(conns, connID)
+	if len(conns) == 0 {
+		delete(s.conns, userID)
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func (s *MemoryPresenceStore) IsOnline(c context.Context, userID int64) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	return len(s.live(userID)) > 0, nil
+}
+
+// live drops the expired connections of a user, the lock must be held
+func (s *MemoryPresenceStore) live(userID int64) map[string]time.Time {
+	conns := s.conns[userID]
+
+	now := time.Now()
+	for id, expiresAt := range conns {
+		if now.After(expiresAt) {
+			delete(conns, id)
+		}
+	}
+
+	return conns
+}
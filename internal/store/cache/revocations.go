@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RevocationStore remembers revoked access tokens, by jti, and users whose
+// tokens issued before a point in time are all revoked. Entries only live
+// as long as the tokens they cover could still be used.
+type RevocationStore struct {
+	rdb *redis.Client
+}
+
+// Revoke revokes the token jti for ttl, its remaining lifetime
+func (s *RevocationStore) Revoke(c context.Context, jti string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil
+	}
+
+	return s.rdb.SetEX(c, revokedTokenKey(jti), 1, ttl).Err()
+}
+
+// RevokeUser revokes every token of userID issued before the second of
+// before, ttl is the longest lifetime of a token
+func (s *RevocationStore) RevokeUser(c context.Context, userID int64, before time.Time, ttl time.Duration) error {
+	return s.rdb.SetEX(c, revokedUserKey(userID), before.Unix(), ttl).Err()
+}
+
+// IsRevoked reports whether the token jti of userID issued at issuedAt was
+// revoked, in a single round trip
+func (s *RevocationStore) IsRevoked(c context.Context, jti string, userID int64, issuedAt time.Time) (bool, error) {
+	vals, err := s.rdb.MGet(c, revokedTokenKey(jti), revokedUserKey(userID)).Result()
+	if err != nil {
+		return false, err
+	}
+
+	if vals[0] != nil {
+		return true, nil
+	}
+
+	if before, ok := vals[1].(string); ok {
+		unix, err := strconv.ParseInt(before, 10, 64)
+		if err != nil {
+			return false, err
+		}
+		return issuedAt.Unix() < unix, nil
+	}
+
+	return false, nil
+}
+
+func revokedTokenKey(jti string) string {
+	return "revoked-token-" + jti
+}
+
+func revokedUserKey(userID int64) string {
+	return fmt.Sprintf("revoked-user-%d", userID)
+}
+
+// MemoryRevocationStore is the single instance fallback when Redis is off
+type MemoryRevocationStore struct {
+	sync.Mutex
+	tokens map[string]time.Time
+	users  map[int64]revokedUser
+}
+
+type revokedUser struct {
+	before    time.Time
+	expiresAt time.Time
+}
+
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		tokens: make(map[string]time.Time),
+		users:  make(map[int64]revokedUser),
+	}
+}
+
+func (s *MemoryRevocationStore) Revoke(c context.Context, jti string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.sweep()
+	s.tokens[jti] = time.Now().Add(ttl)
+
+	return nil
+}
+
+func (s *MemoryRevocationStore) RevokeUser(c context.Context, userID int64, before time.Time, ttl time.Duration) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.sweep()
+	s.users[userID] = revokedUser{before: before.Truncate(time.Second), expiresAt: time.Now().Add(ttl)}
+
+	return nil
+}
+
+func (s *MemoryRevocationStore) IsRevoked(c context.Context, jti string, userID int64, issuedAt time.Time) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+	if expiresAt, ok := s.tokens[jti]; ok && now.Before(expiresAt) {
+		return true, nil
+	}
+
+	if u, ok := s.users[userID]; ok && now.Before(u.expiresAt) {
+		return issuedAt.Before(u.before), nil
+	}
+
+	return false, nil
+}
+
+// sweep drops the entries that expired, the lock must be held
+func (s *MemoryRevocationStore) sweep() {
+	now := time.Now()
+
+	for jti, expiresAt := range s.tokens {
+		if now.After(expiresAt) {
+			delete(s.tokens, jti)
+		}
+	}
+
+	for id, u := range s.users {
+		if now.After(u.expiresAt) {
+			delete(s.users, id)
+		}
+	}
+}
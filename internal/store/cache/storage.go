@@ -2,6 +2,7 @@ package cache
 
 import (
 	"context"
+	"time"
 
 	"github.com/ekachaikeaw/social/internal/store"
 	"github.com/go-redis/redis/v8"
@@ -13,10 +14,50 @@ type Storage struct {
 		Set(context.Context, *store.User) error
 		Delete(context.Context, int64)
 	}
+	Timelines interface {
+		Get(context.Context, int64, store.PaginatedQuery) ([]TimelineEntry, bool, error)
+		Set(context.Context, int64, []TimelineEntry) error
+		Push(context.Context, TimelineEntry, []int64) error
+		Add(context.Context, int64, []TimelineEntry) error
+		Remove(context.Context, int64, []int64) error
+	}
+	Explore interface {
+		Get(c context.Context, userID int64, query string) (*ExplorePage, error)
+		Set(c context.Context, userID int64, query string, page *ExplorePage) error
+	}
+	Suggestions interface {
+		Get(c context.Context, userID int64) ([]store.SuggestedUser, error)
+		Set(c context.Context, userID int64, users []store.SuggestedUser) error
+		Delete(c context.Context, userID int64)
+	}
+	Revocations interface {
+		Revoke(c context.Context, jti string, ttl time.Duration) error
+		RevokeUser(c context.Context, userID int64, before time.Time, ttl time.Duration) error
+		IsRevoked(c context.Context, jti string, userID int64, issuedAt time.Time) (bool, error)
+	}
+	Presence interface {
+		Touch(c context.Context, userID int64, connID string, ttl time.Duration) (bool, error)
+		Leave(c context.Context, userID int64, connID string) (bool, error)
+		IsOnline(c context.Context, userID int64) (bool, error)
+	}
 }
 
 func NewCacheStorage(rdb *redis.Client) Storage {
-	return Storage{
-		&UserStore{rdb: rdb,},
+	storage := Storage{
+		Users:       &UserStore{rdb: rdb},
+		Timelines:   &TimelineStore{rdb: rdb},
+		Explore:     &ExploreStore{rdb: rdb},
+		Suggestions: &SuggestionStore{rdb: rdb},
+		Revocations: &RevocationStore{rdb: rdb},
+		Presence:    &PresenceStore{rdb: rdb},
+	}
+
+	// presence is needed by the gateway and revocations by every
+	// authenticated request, with or without redis
+	if rdb == nil {
+		storage.Presence = NewMemoryPresenceStore()
+		storage.Revocations = NewMemoryRevocationStore()
 	}
+
+	return storage
 }
\ No newline at end of file
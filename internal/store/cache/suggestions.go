@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ekachaikeaw/social/internal/store"
+	"github.com/go-redis/redis/v8"
+)
+
+// SuggestionsExpTime bounds how long a ranking is reused, the query walks
+// the follow graph and is too heavy to run on every request
+const SuggestionsExpTime = time.Minute * 15
+
+type SuggestionStore struct {
+	rdb *redis.Client
+}
+
+func (s *SuggestionStore) Get(c context.Context, userID int64) ([]store.SuggestedUser, error) {
+	data, err := s.rdb.Get(c, suggestionsKey(userID)).Result()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	users := []store.SuggestedUser{}
+	if err := json.Unmarshal([]byte(data), &users); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func (s *SuggestionStore) Set(c context.Context, userID int64, users []store.SuggestedUser) error {
+	data, err := json.Marshal(users)
+	if err != nil {
+		return err
+	}
+
+	return s.rdb.SetEX(c, suggestionsKey(userID), data, SuggestionsExpTime).Err()
+}
+
+func (s *SuggestionStore) Delete(c context.Context, userID int64) {
+	s.rdb.Del(c, suggestionsKey(userID))
+}
+
+func suggestionsKey(userID int64) string {
+	return fmt.Sprintf("suggestions-%d", userID)
+}
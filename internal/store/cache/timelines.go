@@ -0,0 +1,274 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ekachaikeaw/social/internal/store"
+	"github.com/go-redis/redis/v8"
+)
+
+// TimelineSize caps the number of posts kept per home timeline
+const TimelineSize = 800
+
+// TimelineExpTime is how long the timeline of a user who stopped reading it
+// is kept, each read starts it over
+const TimelineExpTime = time.Hour * 24 * 7
+
+type TimelineEntry struct {
+	PostID    int64
+	CreatedAt time.Time
+}
+
+type TimelineStore struct {
+	rdb *redis.Client
+}
+
+// addScript only touches timelines that are already materialized, a cold
+// timeline is rebuilt from the database on its next read instead of
+// starting out with a partial history. An empty timeline, KEYS[2], turns
+// into a sorted set with the expiry ARGV[2].
+var addScript = redis.NewScript(`
+local created = false
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	if redis.call("DEL", KEYS[2]) == 0 then
+		return 0
+	end
+	created = true
+end
+for i = 3, #ARGV, 2 do
+	redis.call("ZADD", KEYS[1], ARGV[i], ARGV[i + 1])
+end
+redis.call("ZREMRANGEBYRANK", KEYS[1], 0, -(tonumber(ARGV[1]) + 1))
+if created then
+	redis.call("EXPIRE", KEYS[1], ARGV[2])
+end
+return 1
+`)
+
+// Get returns a page of the timeline of userID, ok is false when it isn't
+// materialized or the page goes past the trimmed posts. Reading a timeline
+// keeps it for another TimelineExpTime.
+func (s *TimelineStore) Get(c context.Context, userID int64, fq store.PaginatedQuery) ([]TimelineEntry, bool, error) {
+	key := timelineKey(userID)
+
+	found, err := s.rdb.Expire(c, key, TimelineExpTime).Result()
+	if err != nil {
+		return nil, false, err
+	}
+
+	// redis drops empty sorted sets, an empty timeline is a marker key
+	if !found {
+		empty, err := s.rdb.Expire(c, emptyTimelineKey(userID), TimelineExpTime).Result()
+		if err != nil || !empty {
+			return nil, false, err
+		}
+
+		return []TimelineEntry{}, true, nil
+	}
+
+	var zs []redis.Z
+	switch {
+	case fq.After != nil:
+		zs, err = s.after(c, key, fq)
+	case fq.Sort == "asc":
+		zs, err = s.rdb.ZRangeWithScores(c, key, int64(fq.Offset), int64(fq.Offset+fq.Limit-1)).Result()
+	default:
+		zs, err = s.rdb.ZRevRangeWithScores(c, key, int64(fq.Offset), int64(fq.Offset+fq.Limit-1)).Result()
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	// a short page from a full timeline means older posts were trimmed
+	if len(zs) < fq.Limit {
+		size, err := s.rdb.ZCard(c, key).Result()
+		if err != nil {
+			return nil, false, err
+		}
+
+		if size >= TimelineSize {
+			return nil, false, nil
+		}
+	}
+
+	entries := make([]TimelineEntry, 0, len(zs))
+	for _, z := range zs {
+		entry, err := toEntry(z)
+		if err != nil {
+			return nil, false, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, true, nil
+}
+
+// after returns the page following the cursor. Posts created in the same
+// second share a score, those are ordered by id on the client side.
+func (s *TimelineStore) after(c context.Context, key string, fq store.PaginatedQuery) ([]redis.Z, error) {
+	score := strconv.FormatInt(fq.After.CreatedAt.Unix(), 10)
+	asc := fq.Sort == "asc"
+
+	ties, err := s.rdb.ZRangeByScoreWithScores(c, key, &redis.ZRangeBy{Min: score, Max: score}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var zs []redis.Z
+	for _, z := range ties {
+		entry, err := toEntry(z)
+		if err != nil {
+			return nil, err
+		}
+
+		if (asc && entry.PostID > fq.After.ID) || (!asc && entry.PostID < fq.After.ID) {
+			zs = append(zs, z)
+		}
+	}
+
+	sort.Slice(zs, func(i, j int) bool {
+		if asc {
+			return zs[i].Member.(string) < zs[j].Member.(string)
+		}
+		return zs[i].Member.(string) > zs[j].Member.(string)
+	})
+
+	var rest []redis.Z
+	if asc {
+		rest, err = s.rdb.ZRangeByScoreWithScores(c, key, &redis.ZRangeBy{
+			Min:   "(" + score,
+			Max:   "+inf",
+			Count: int64(fq.Limit),
+		}).Result()
+	} else {
+		rest, err = s.rdb.ZRevRangeByScoreWithScores(c, key, &redis.ZRangeBy{
+			Min:   "-inf",
+			Max:   "(" + score,
+			Count: int64(fq.Limit),
+		}).Result()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	zs = append(zs, rest...)
+	if len(zs) > fq.Limit {
+		zs = zs[:fq.Limit]
+	}
+
+	return zs, nil
+}
+
+// Set replaces the whole timeline of a user, an empty one is materialized
+// too so reads don't rebuild it every time
+func (s *TimelineStore) Set(c context.Context, userID int64, entries []TimelineEntry) error {
+	key := timelineKey(userID)
+
+	_, err := s.rdb.TxPipelined(c, func(pipe redis.Pipeliner) error {
+		pipe.Del(c, key, emptyTimelineKey(userID))
+		if len(entries) == 0 {
+			pipe.SetEX(c, emptyTimelineKey(userID), 1, TimelineExpTime)
+			return nil
+		}
+
+		members := make([]*redis.Z, 0, len(entries))
+		for _, e := range entries {
+			members = append(members, toZ(e))
+		}
+
+		pipe.ZAdd(c, key, members...)
+		pipe.ZRemRangeByRank(c, key, 0, -(TimelineSize + 1))
+		pipe.Expire(c, key, TimelineExpTime)
+		return nil
+	})
+
+	return err
+}
+
+// Push adds a new post to the timelines of the given users
+func (s *TimelineStore) Push(c context.Context, entry TimelineEntry, userIDs []int64) error {
+	z := toZ(entry)
+
+	_, err := s.rdb.Pipelined(c, func(pipe redis.Pipeliner) error {
+		for _, id := range userIDs {
+			keys := []string{timelineKey(id), emptyTimelineKey(id)}
+			addScript.Eval(c, pipe, keys, TimelineSize, timelineTTL(), z.Score, z.Member)
+		}
+		return nil
+	})
+
+	return err
+}
+
+// Add backfills the timeline of a user with older posts
+func (s *TimelineStore) Add(c context.Context, userID int64, entries []TimelineEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	args := []any{TimelineSize, timelineTTL()}
+	for _, e := range entries {
+		z := toZ(e)
+		args = append(args, z.Score, z.Member)
+	}
+
+	keys := []string{timelineKey(userID), emptyTimelineKey(userID)}
+	return addScript.Eval(c, s.rdb, keys, args...).Err()
+}
+
+func (s *TimelineStore) Remove(c context.Context, userID int64, postIDs []int64) error {
+	if len(postIDs) == 0 {
+		return nil
+	}
+
+	members := make([]any, 0, len(postIDs))
+	for _, id := range postIDs {
+		members = append(members, timelineMember(id))
+	}
+
+	return s.rdb.ZRem(c, timelineKey(userID), members...).Err()
+}
+
+func timelineKey(userID int64) string {
+	return fmt.Sprintf("timeline-%d", userID)
+}
+
+func emptyTimelineKey(userID int64) string {
+	return fmt.Sprintf("timeline-empty-%d", userID)
+}
+
+// timelineTTL is TimelineExpTime in the seconds EXPIRE takes
+func timelineTTL() int64 {
+	return int64(TimelineExpTime / time.Second)
+}
+
+// timelineMember zero pads the id so members with the same score sort by id
+func timelineMember(postID int64) string {
+	return fmt.Sprintf("%019d", postID)
+}
+
+func toZ(e TimelineEntry) *redis.Z {
+	return &redis.Z{
+		Score:  float64(e.CreatedAt.Unix()),
+		Member: timelineMember(e.PostID),
+	}
+}
+
+func toEntry(z redis.Z) (TimelineEntry, error) {
+	member, _ := z.Member.(string)
+
+	id, err := strconv.ParseInt(member, 10, 64)
+	if err != nil {
+		return TimelineEntry{}, err
+	}
+
+	return TimelineEntry{
+		PostID:    id,
+		CreatedAt: time.Unix(int64(z.Score), 0).UTC(),
+	}, nil
+}
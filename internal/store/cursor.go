@@ -0,0 +1,106 @@
+package store
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is a position in a feed ordered by (created_at, id), or by
+// (score, id) for ranked feeds scored at RankedAt.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        int64
+	Score     float64
+	RankedAt  time.Time
+}
+
+func (c Cursor) IsRanked() bool {
+	return !c.RankedAt.IsZero()
+}
+
+func CursorFromPost(p Post) (Cursor, error) {
+	createdAt, err := time.Parse(time.RFC3339Nano, p.CreatedAt)
+	if err != nil {
+		return Cursor{}, err
+	}
+
+	return Cursor{CreatedAt: createdAt, ID: p.ID}, nil
+}
+
+// Encode returns an opaque, url safe token signed with secret so clients
+// can't forge positions in someone else's feed.
+func (c Cursor) Encode(secret string) string {
+	raw := fmt.Sprintf("%d:%d", c.CreatedAt.UnixNano(), c.ID)
+	if c.IsRanked() {
+		raw = fmt.Sprintf("%s:%d:%d", raw, math.Float64bits(c.Score), c.RankedAt.UnixNano())
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString([]byte(raw))
+
+	return payload + "." + sign(payload, secret)
+}
+
+func DecodeCursor(token, secret string) (Cursor, error) {
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	if !hmac.Equal([]byte(sig), []byte(sign(payload, secret))) {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	fields := strings.Split(string(raw), ":")
+	if len(fields) != 2 && len(fields) != 4 {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	nanos, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	id, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	cursor := Cursor{CreatedAt: time.Unix(0, nanos).UTC(), ID: id}
+	if len(fields) == 4 {
+		bits, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			return Cursor{}, ErrInvalidCursor
+		}
+
+		rankedAt, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			return Cursor{}, ErrInvalidCursor
+		}
+
+		cursor.Score = math.Float64frombits(bits)
+		cursor.RankedAt = time.Unix(0, rankedAt).UTC()
+	}
+
+	return cursor, nil
+}
+
+func sign(payload, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
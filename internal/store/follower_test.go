@@ -0,0 +1,154 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestPrivateAccount(t *testing.T) {
+	s, db := newTestStorage(t)
+	c := context.Background()
+
+	alice := createTestUser(t, s, db, "alice")
+	bob := createTestUser(t, s, db, "bob")
+	carol := createTestUser(t, s, db, "carol")
+
+	alice.IsPrivate = true
+	if _, err := s.Users.UpdateProfile(c, alice); err != nil {
+		t.Fatal(err)
+	}
+	post := createTestPost(t, s, alice.ID, "private", nil)
+
+	sees := func(viewer *User) bool {
+		t.Helper()
+
+		posts, err := s.Posts.GetByIDs(c, viewer.ID, []int64{post.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		visible, err := s.Follower.CanSee(c, viewer.ID, alice.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if visible != (len(posts) == 1) {
+			t.Fatalf("CanSee %v disagrees with the posts %v", visible, postIDs(posts))
+		}
+
+		return visible
+	}
+
+	if !sees(alice) {
+		t.Error("expected the author to see her posts")
+	}
+
+	pending, err := s.Follower.Follow(c, bob.ID, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pending {
+		t.Error("expected a follow request")
+	}
+	if _, err := s.Follower.Follow(c, bob.ID, alice.ID); err != ErrConflict {
+		t.Errorf("second request: %v, want %v", err, ErrConflict)
+	}
+	if sees(bob) {
+		t.Error("expected the posts hidden while the request is pending")
+	}
+
+	requests, err := s.Follower.GetIncomingRequests(c, alice.ID, PaginatedQuery{Limit: 20, Sort: "desc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 1 || requests[0].ID != bob.ID {
+		t.Errorf("unexpected requests %+v", requests)
+	}
+
+	if err := s.Follower.ApproveRequest(c, alice.ID, bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Follower.ApproveRequest(c, alice.ID, bob.ID); err != ErrNotFound {
+		t.Errorf("second approval: %v, want %v", err, ErrNotFound)
+	}
+	if !sees(bob) {
+		t.Error("expected the posts visible to an approved follower")
+	}
+
+	// going public lets the pending requests in
+	if _, err := s.Follower.Follow(c, carol.ID, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	alice.IsPrivate = false
+	approved, err := s.Users.UpdateProfile(c, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(approved) != 1 || approved[0] != carol.ID {
+		t.Errorf("expected carol approved, got %v", approved)
+	}
+	if n := count(t, db, `SELECT count(*) FROM followers WHERE user_id = $1 AND follower_id = $2`, alice.ID, carol.ID); n != 1 {
+		t.Error("expected the pending request approved")
+	}
+}
+
+func TestGetSuggestions(t *testing.T) {
+	s, db := newTestStorage(t)
+	c := context.Background()
+
+	me := createTestUser(t, s, db, "me")
+	friend := createTestUser(t, s, db, "friend")
+	other := createTestUser(t, s, db, "other")
+	mutual := createTestUser(t, s, db, "mutual")
+	single := createTestUser(t, s, db, "single")
+	blocked := createTestUser(t, s, db, "blocked")
+	muted := createTestUser(t, s, db, "muted")
+
+	follow(t, s, me.ID, friend.ID)
+	follow(t, s, me.ID, other.ID)
+	follow(t, s, friend.ID, mutual.ID)
+	follow(t, s, other.ID, mutual.ID)
+	for _, u := range []*User{single, blocked, muted} {
+		follow(t, s, friend.ID, u.ID)
+	}
+
+	if err := s.Block.Block(c, &BlockedUser{UserID: blocked.ID, BlockedUserID: me.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Mute.MuteUser(c, &MutedUser{UserID: me.ID, MutedUserID: muted.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	suggested, err := s.Follower.GetSuggestions(c, me.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// followed, blocking and muted accounts are left out, mutuals rank first
+	var ids []int64
+	for _, u := range suggested {
+		ids = append(ids, u.ID)
+	}
+	if !slices.Equal(ids, []int64{mutual.ID, single.ID}) {
+		t.Fatalf("suggested %v, want %v", ids, []int64{mutual.ID, single.ID})
+	}
+	if suggested[0].MutualCount != 2 || suggested[0].FollowerCount != 2 {
+		t.Errorf("unexpected signals %+v", suggested[0])
+	}
+
+	suggested, err = s.Follower.GetSuggestions(c, me.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(suggested) != 1 {
+		t.Errorf("expected the limit applied, got %d", len(suggested))
+	}
+
+	follow(t, s, me.ID, mutual.ID)
+	suggested, err = s.Follower.GetSuggestions(c, me.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(suggested) != 1 || suggested[0].ID != single.ID {
+		t.Errorf("expected a followed account dropped, got %+v", suggested)
+	}
+}
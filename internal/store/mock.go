@@ -8,7 +8,14 @@ import (
 
 func NewMockStore() Storage {
 	return Storage{
-		Users: &MockUserStore{},
+		Users:        &MockUserStore{},
+		Posts:        &MockPostStore{},
+		Follower:     &MockFollowerStore{},
+		Mute:         &MockMuteStore{},
+		Federation:   &MockFederationStore{},
+		Block:        &MockBlockStore{},
+		RefreshToken: &MockRefreshTokenStore{},
+		TwoFactor:    &MockTwoFactorStore{},
 	}
 }
 
@@ -17,18 +24,302 @@ type MockUserStore struct{}
 func (s *MockUserStore) Create(context.Context, *User, *sql.Tx) error {
 	return nil
 }
-func (s *MockUserStore) GetByID(context.Context, int64) (*User, error) {
+func (s *MockUserStore) GetByID(c context.Context, userID int64) (*User, error) {
+	return &User{ID: userID}, nil
+}
+func (s *MockUserStore) GetByEmail(c context.Context, email string) (*User, error) {
+	// the user with 2FA on, logging in with "password"
+	if email == "totp@example.com" {
+		user := &User{ID: 2, Email: email}
+		if err := user.Password.Set("password"); err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
 	return &User{}, nil
 }
-func (s *MockUserStore) GetByEmail(context.Context, string) (*User, error) {
+func (s *MockUserStore) GetByUsername(context.Context, string) (*User, error) {
 	return &User{}, nil
 }
+func (s *MockUserStore) UsernameAvailable(c context.Context, name string) (bool, error) {
+	return name != "taken", nil
+}
+func (s *MockUserStore) ChangeUsername(c context.Context, userID int64, name string, cooldown, hold time.Duration) (time.Time, error) {
+	// "recent" stands for a change made by a concurrent request an hour ago
+	if name == "recent" {
+		return time.Now().Add(-time.Hour), ErrUsernameCooldown
+	}
+	return time.Now(), nil
+}
+func (s *MockUserStore) ResolveUsername(c context.Context, name string) (*User, error) {
+	switch name {
+	case "oldgopher":
+		return &User{ID: 1, Username: "gopher"}, nil
+	case "nobody":
+		return nil, ErrNotFound
+	default:
+		return &User{ID: 1, Username: name}, nil
+	}
+}
+func (s *MockUserStore) BackfillSkeletons(context.Context, int) (int, int, error) {
+	return 0, 0, nil
+}
+func (s *MockUserStore) GetUsernameHistory(context.Context, int64) ([]UsernameChange, error) {
+	return []UsernameChange{}, nil
+}
+func (s *MockUserStore) GetStats(context.Context, int64, int64) (*UserStats, error) {
+	return &UserStats{}, nil
+}
+func (s *MockUserStore) UpdateProfile(context.Context, *User) ([]int64, error) {
+	return []int64{}, nil
+}
+func (s *MockUserStore) ChangePassword(context.Context, *User) error {
+	return nil
+}
+func (s *MockUserStore) CreatePasswordReset(context.Context, int64, string, time.Duration) error {
+	return nil
+}
+func (s *MockUserStore) ResetPassword(c context.Context, token string, u *User) error {
+	if token != "valid" {
+		return ErrNotFound
+	}
+	return nil
+}
+func (s *MockUserStore) RequestEmailChange(context.Context, int64, string, string, time.Duration) error {
+	return nil
+}
+func (s *MockUserStore) ConfirmEmailChange(c context.Context, token, revertToken string, revertExp time.Duration) (*EmailChange, error) {
+	if token != "valid" {
+		return nil, ErrNotFound
+	}
+	return &EmailChange{NewEmail: "new@example.com", OldEmail: "old@example.com"}, nil
+}
+func (s *MockUserStore) RevertEmailChange(c context.Context, token string) (*EmailChange, error) {
+	if token != "valid" {
+		return nil, ErrNotFound
+	}
+	return &EmailChange{NewEmail: "old@example.com", OldEmail: "new@example.com"}, nil
+}
 func (s *MockUserStore) CreateAndInvite(context.Context, *User, string, time.Duration) error {
 	return nil
 }
+func (s *MockUserStore) RenewInvitation(context.Context, string, string, time.Duration) (*User, error) {
+	return &User{}, nil
+}
+func (s *MockUserStore) Export(c context.Context, userID int64) (*UserExport, error) {
+	return &UserExport{
+		Profile: &User{ID: userID},
+		Posts:   []ExportedPost{{ID: 1, Title: "hello", Content: "world"}},
+	}, nil
+}
+func (s *MockUserStore) ScheduleDeletion(context.Context, int64, time.Time) error {
+	return nil
+}
+func (s *MockUserStore) CancelDeletion(context.Context, int64) error {
+	return nil
+}
+func (s *MockUserStore) PurgeDeleted(context.Context, bool, int) ([]User, error) {
+	return nil, nil
+}
 func (s *MockUserStore) Activate(context.Context, string) error {
 	return nil
 }
 func (s *MockUserStore) Delete(context.Context, int64) error {
 	return nil
 }
+
+type MockPostStore struct{}
+
+func (s *MockPostStore) Create(context.Context, *Post) error {
+	return nil
+}
+func (s *MockPostStore) GetByID(context.Context, int64) (*Post, error) {
+	return &Post{}, nil
+}
+func (s *MockPostStore) Update(context.Context, *Post) error {
+	return nil
+}
+func (s *MockPostStore) Delete(context.Context, int64) error {
+	return nil
+}
+func (s *MockPostStore) GetUserFeed(context.Context, int64, PaginatedQuery) ([]PostWithMetadata, error) {
+	return []PostWithMetadata{}, nil
+}
+func (s *MockPostStore) GetByIDs(context.Context, int64, []int64) ([]PostWithMetadata, error) {
+	return []PostWithMetadata{}, nil
+}
+func (s *MockPostStore) GetFollowedSince(context.Context, int64, int64, int) ([]Post, error) {
+	return []Post{}, nil
+}
+func (s *MockPostStore) GetByUserID(context.Context, int64, int) ([]Post, error) {
+	return []Post{}, nil
+}
+func (s *MockPostStore) IncrementViews(context.Context, int64) error {
+	return nil
+}
+func (s *MockPostStore) GetExplore(context.Context, int64, PaginatedQuery) ([]PostWithMetadata, error) {
+	return []PostWithMetadata{}, nil
+}
+func (s *MockPostStore) GetByTag(context.Context, string, int) ([]Post, error) {
+	return []Post{}, nil
+}
+
+type MockFederationStore struct{}
+
+func (s *MockFederationStore) GetActorKey(context.Context, int64) (*ActorKey, error) {
+	return nil, ErrNotFound
+}
+func (s *MockFederationStore) CreateActorKey(context.Context, *ActorKey) error {
+	return nil
+}
+func (s *MockFederationStore) AddRemoteFollower(context.Context, *RemoteFollower) error {
+	return nil
+}
+func (s *MockFederationStore) RemoveRemoteFollower(context.Context, int64, string) error {
+	return nil
+}
+func (s *MockFederationStore) GetRemoteFollowers(context.Context, int64) ([]RemoteFollower, error) {
+	return []RemoteFollower{}, nil
+}
+
+type MockFollowerStore struct{}
+
+func (s *MockFollowerStore) Follow(context.Context, int64, int64) (bool, error) {
+	return false, nil
+}
+func (s *MockFollowerStore) ApproveRequest(context.Context, int64, int64) error {
+	return nil
+}
+func (s *MockFollowerStore) RejectRequest(context.Context, int64, int64) error {
+	return nil
+}
+func (s *MockFollowerStore) CanSee(context.Context, int64, int64) (bool, error) {
+	return true, nil
+}
+func (s *MockFollowerStore) GetIncomingRequests(context.Context, int64, PaginatedQuery) ([]FollowUser, error) {
+	return []FollowUser{}, nil
+}
+func (s *MockFollowerStore) GetOutgoingRequests(context.Context, int64, PaginatedQuery) ([]FollowUser, error) {
+	return []FollowUser{}, nil
+}
+func (s *MockFollowerStore) Unfollow(context.Context, int64, int64) error {
+	return nil
+}
+func (s *MockFollowerStore) GetFollowerIDs(context.Context, int64) ([]int64, error) {
+	return []int64{}, nil
+}
+func (s *MockFollowerStore) GetFollowers(context.Context, int64, PaginatedQuery) ([]FollowUser, error) {
+	return []FollowUser{}, nil
+}
+func (s *MockFollowerStore) GetFollowing(context.Context, int64, PaginatedQuery) ([]FollowUser, error) {
+	return []FollowUser{}, nil
+}
+func (s *MockFollowerStore) GetSuggestions(context.Context, int64, int) ([]SuggestedUser, error) {
+	return []SuggestedUser{}, nil
+}
+
+type MockMuteStore struct{}
+
+func (s *MockMuteStore) MuteUser(context.Context, *MutedUser) error {
+	return nil
+}
+func (s *MockMuteStore) UnmuteUser(context.Context, int64, int64) error {
+	return nil
+}
+func (s *MockMuteStore) GetMutedUsers(context.Context, int64) ([]MutedUser, error) {
+	return []MutedUser{}, nil
+}
+func (s *MockMuteStore) CreateKeyword(context.Context, *MutedKeyword) error {
+	return nil
+}
+func (s *MockMuteStore) DeleteKeyword(context.Context, int64, int64) error {
+	return nil
+}
+func (s *MockMuteStore) GetKeywords(context.Context, int64) ([]MutedKeyword, error) {
+	return []MutedKeyword{}, nil
+}
+func (s *MockMuteStore) GetNotMuting(c context.Context, postID int64, userIDs []int64) ([]int64, error) {
+	return userIDs, nil
+}
+
+type MockBlockStore struct{}
+
+func (s *MockBlockStore) Block(context.Context, *BlockedUser) error {
+	return nil
+}
+func (s *MockBlockStore) Unblock(context.Context, int64, int64) error {
+	return nil
+}
+func (s *MockBlockStore) GetBlockedUsers(context.Context, int64) ([]BlockedUser, error) {
+	return []BlockedUser{}, nil
+}
+func (s *MockBlockStore) NotBlocked(context.Context, int64, int64) (bool, error) {
+	return true, nil
+}
+
+type MockRefreshTokenStore struct{}
+
+func (s *MockRefreshTokenStore) Create(context.Context, int64, string, time.Duration) error {
+	return nil
+}
+func (s *MockRefreshTokenStore) Rotate(c context.Context, token, newToken string, exp time.Duration) (int64, error) {
+	switch token {
+	case "valid":
+		return 1, nil
+	case "reused":
+		return 0, ErrRefreshTokenReused
+	default:
+		return 0, ErrNotFound
+	}
+}
+func (s *MockRefreshTokenStore) Revoke(context.Context, int64, string) error {
+	return nil
+}
+func (s *MockRefreshTokenStore) RevokeAll(context.Context, int64) error {
+	return nil
+}
+
+// MockTOTPSecret is the secret of the pending enrollment of user 1 and of
+// the enabled 2FA of user 2
+const MockTOTPSecret = "JBSWY3DPEHPK3PXP"
+
+type MockTwoFactorStore struct{}
+
+func (s *MockTwoFactorStore) Get(c context.Context, userID int64) (*TOTP, error) {
+	switch userID {
+	case 1:
+		return &TOTP{UserID: userID, Secret: MockTOTPSecret}, nil
+	case 2:
+		enabledAt := time.Now()
+		return &TOTP{UserID: userID, Secret: MockTOTPSecret, EnabledAt: &enabledAt}, nil
+	default:
+		return nil, ErrNotFound
+	}
+}
+func (s *MockTwoFactorStore) Enroll(context.Context, int64, string) error {
+	return nil
+}
+func (s *MockTwoFactorStore) Enable(context.Context, int64, int64, []string) error {
+	return nil
+}
+func (s *MockTwoFactorStore) Disable(context.Context, int64) error {
+	return nil
+}
+func (s *MockTwoFactorStore) UseCode(context.Context, int64, int64) (bool, error) {
+	return true, nil
+}
+func (s *MockTwoFactorStore) UseRecoveryCode(c context.Context, userID int64, code string) (bool, error) {
+	return code == "abcdefghij", nil
+}
+func (s *MockTwoFactorStore) CreateChallenge(context.Context, int64, string, time.Duration) error {
+	return nil
+}
+func (s *MockTwoFactorStore) AttemptChallenge(c context.Context, token string, maxAttempts int) (int64, error) {
+	if token == "valid" {
+		return 2, nil
+	}
+	return 0, ErrNotFound
+}
+func (s *MockTwoFactorStore) DeleteChallenge(context.Context, string) error {
+	return nil
+}
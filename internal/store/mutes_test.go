@@ -0,0 +1,153 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMutedKeywords(t *testing.T) {
+	s, db := newTestStorage(t)
+	c := context.Background()
+
+	viewer := createTestUser(t, s, db, "viewer")
+	author := createTestUser(t, s, db, "author")
+
+	// createPostHandler stores nil tags for untagged posts
+	untagged := createTestPost(t, s, author.ID, "Learning Golang", nil)
+	tagged := createTestPost(t, s, author.ID, "Weekend", []string{"golang"})
+	other := createTestPost(t, s, author.ID, "Rust notes", nil)
+
+	for _, keyword := range []*MutedKeyword{
+		{UserID: viewer.ID, Keyword: "GOLANG"},
+		{UserID: viewer.ID, Keyword: "^rust", IsRegex: true},
+	} {
+		if err := s.Mute.CreateKeyword(c, keyword); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ids := []int64{untagged.ID, tagged.ID, other.ID}
+	posts, err := s.Posts.GetByIDs(c, viewer.ID, ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := postIDs(posts); len(got) != 0 {
+		t.Errorf("expected every post muted, got %v", got)
+	}
+
+	// the author hasn't muted anything
+	posts, err = s.Posts.GetByIDs(c, author.ID, ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range ids {
+		if !slices.Contains(postIDs(posts), id) {
+			t.Errorf("expected post %d for the author, got %v", id, postIDs(posts))
+		}
+	}
+}
+
+func TestMutedUsers(t *testing.T) {
+	s, db := newTestStorage(t)
+	c := context.Background()
+
+	viewer := createTestUser(t, s, db, "viewer")
+	muted := createTestUser(t, s, db, "muted")
+	expired := createTestUser(t, s, db, "expired")
+
+	mutedPost := createTestPost(t, s, muted.ID, "muted", nil)
+	expiredPost := createTestPost(t, s, expired.ID, "expired", nil)
+
+	past := time.Now().Add(-time.Minute)
+	for _, m := range []*MutedUser{
+		{UserID: viewer.ID, MutedUserID: muted.ID},
+		{UserID: viewer.ID, MutedUserID: expired.ID, ExpiresAt: &past},
+	} {
+		if err := s.Mute.MuteUser(c, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ids := []int64{mutedPost.ID, expiredPost.ID}
+	posts, err := s.Posts.GetByIDs(c, viewer.ID, ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := postIDs(posts); !slices.Equal(got, []int64{expiredPost.ID}) {
+		t.Errorf("expected only the post of the expired mute, got %v", got)
+	}
+
+	mutes, err := s.Mute.GetMutedUsers(c, viewer.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mutes) != 1 || mutes[0].MutedUserID != muted.ID {
+		t.Errorf("unexpected mutes %+v", mutes)
+	}
+
+	if err := s.Mute.UnmuteUser(c, viewer.ID, muted.ID); err != nil {
+		t.Fatal(err)
+	}
+	posts, err = s.Posts.GetByIDs(c, viewer.ID, ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != len(ids) {
+		t.Errorf("expected every post after the unmute, got %v", postIDs(posts))
+	}
+}
+
+func TestMutedStream(t *testing.T) {
+	s, db := newTestStorage(t)
+	c := context.Background()
+
+	viewer := createTestUser(t, s, db, "viewer")
+	other := createTestUser(t, s, db, "other")
+	author := createTestUser(t, s, db, "author")
+	blocked := createTestUser(t, s, db, "blocked")
+	follow(t, s, viewer.ID, author.ID)
+	follow(t, s, other.ID, author.ID)
+
+	if err := s.Mute.CreateKeyword(c, &MutedKeyword{UserID: viewer.ID, Keyword: "spoiler"}); err != nil {
+		t.Fatal(err)
+	}
+
+	muted := createTestPost(t, s, author.ID, "Finale spoiler", nil)
+	shown := createTestPost(t, s, author.ID, "Hello", nil)
+	hidden := createTestPost(t, s, blocked.ID, "Blocked", nil)
+
+	// blocking drops the follow, one left behind must not leak the posts
+	if err := s.Block.Block(c, &BlockedUser{UserID: blocked.ID, BlockedUserID: viewer.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO followers (user_id, follower_id) VALUES ($1, $2)`, blocked.ID, viewer.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should only publish to followers not muting the post", func(t *testing.T) {
+		ids, err := s.Mute.GetNotMuting(c, muted.ID, []int64{viewer.ID, other.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(ids, []int64{other.ID}) {
+			t.Errorf("expected only the other follower, got %v", ids)
+		}
+	})
+
+	t.Run("should replay without muted or blocked posts", func(t *testing.T) {
+		posts, err := s.Posts.GetFollowedSince(c, viewer.ID, 0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids := []int64{}
+		for _, p := range posts {
+			ids = append(ids, p.ID)
+		}
+		if !slices.Equal(ids, []int64{shown.ID}) {
+			t.Errorf("expected only post %d, got %v (hidden %d)", shown.ID, ids, hidden.ID)
+		}
+	})
+}
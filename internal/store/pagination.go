@@ -1,6 +1,7 @@
 package store
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
@@ -8,13 +9,18 @@ import (
 )
 
 type PaginatedQuery struct {
-	Limit  int      `json:"limit" validate:"gte=1,lte=20"`
-	Offset int      `json:"offset" validate:"gte=0"`
-	Sort   string   `json:"sort" validate:"oneof=asc desc"`
-	Tags   []string `json:"tags" validate:"max=5"`
-	Search string   `json:"search" validate:"max=100"`
-	Until  string   `json:"until"`
-	Since  string   `json:"since"`
+	Limit  int        `json:"limit" validate:"gte=1,lte=20"`
+	Offset int        `json:"offset" validate:"gte=0"`
+	Sort   string     `json:"sort" validate:"oneof=asc desc top"`
+	Tags   []string   `json:"tags" validate:"max=5"`
+	Search string     `json:"search" validate:"max=100"`
+	Until  *time.Time `json:"until"`
+	Since  *time.Time `json:"since"`
+	Cursor string     `json:"cursor" validate:"max=256"`
+	After  *Cursor    `json:"-"`
+	// Ranking and RankedAt only apply to the "top" sort
+	Ranking  Ranking   `json:"-"`
+	RankedAt time.Time `json:"-"`
 }
 
 func (fq PaginatedQuery) Parse(r *http.Request) (PaginatedQuery, error) {
@@ -59,24 +65,45 @@ func (fq PaginatedQuery) Parse(r *http.Request) (PaginatedQuery, error) {
 		fq.Search = search
 	}
 
+	cursor := qs.Get("cursor")
+	if cursor != "" {
+		fq.Cursor = cursor
+	}
+
 	since := qs.Get("since")
 	if since != "" {
-		fq.Until = parseTime(since)
+		t, err := parseTime(since)
+		if err != nil {
+			return fq, fmt.Errorf("invalid since: %w", err)
+		}
+
+		fq.Since = &t
 	}
 
 	until := qs.Get("until")
 	if until != "" {
-		fq.Until = parseTime(until)
+		t, err := parseTime(until)
+		if err != nil {
+			return fq, fmt.Errorf("invalid until: %w", err)
+		}
+
+		fq.Until = &t
+	}
+
+	if fq.Since != nil && fq.Until != nil && fq.Since.After(*fq.Until) {
+		return fq, fmt.Errorf("since must be before until")
 	}
 
 	return fq, nil
 }
 
-func parseTime(s string) string {
-	t, err := time.Parse(time.DateTime, s)
-	if err != nil {
-		return ""
+// parseTime accepts RFC3339 or time.DateTime, the latter is read as UTC
+func parseTime(s string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, time.DateTime} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
 	}
 
-	return t.Format(time.DateTime)
+	return time.Time{}, fmt.Errorf("%q is not in RFC3339 or %q format", s, time.DateTime)
 }
@@ -0,0 +1,37 @@
+package store
+
+import "fmt"
+
+// Ranking weighs engagement for the "top" sort. A post scores
+//
+//	(comments*CommentWeight + reactions*ReactionWeight + views*ViewWeight + 1) / (age in hours + 2)^Gravity
+//
+// so engagement lifts a post and age slowly pulls it back down.
+type Ranking struct {
+	CommentWeight  float64
+	ReactionWeight float64
+	ViewWeight     float64
+	Gravity        float64
+}
+
+var DefaultRanking = Ranking{
+	CommentWeight:  3,
+	ReactionWeight: 1,
+	ViewWeight:     0.1,
+	Gravity:        1.8,
+}
+
+// scoreSQL expects the posts alias p, comments alias c and the ranking
+// weights followed by the reference time in params starting at $n
+func (r Ranking) scoreSQL(n int) string {
+	return fmt.Sprintf(`(
+			($%d::float8 * count(c.id) +
+			 $%d::float8 * (SELECT count(*) FROM reactions r WHERE r.post_id = p.id) +
+			 $%d::float8 * p.views + 1) /
+			power(GREATEST(extract(epoch FROM ($%d::timestamptz - p.created_at)), 0) / 3600 + 2, $%d::float8)
+		)`, n, n+1, n+2, n+4, n+3)
+}
+
+func (r Ranking) args() []any {
+	return []any{r.CommentWeight, r.ReactionWeight, r.ViewWeight, r.Gravity}
+}
@@ -0,0 +1,88 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+func TestRefreshTokenRotation(t *testing.T) {
+	s, db := newTestStorage(t)
+	c := context.Background()
+
+	user := createTestUser(t, s, db, "gopher")
+
+	hash := func(token string) string {
+		sum := sha256.Sum256([]byte(token))
+		return hex.EncodeToString(sum[:])
+	}
+	rotate := func(token, next string) (int64, error) {
+		return s.RefreshToken.Rotate(c, token, hash(next), time.Hour)
+	}
+
+	if err := s.RefreshToken.Create(c, user.ID, hash("first"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	// a second login is a family of its own
+	if err := s.RefreshToken.Create(c, user.ID, hash("laptop"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	if id, err := rotate("first", "second"); err != nil || id != user.ID {
+		t.Fatalf("rotate = %d, %v", id, err)
+	}
+	if _, err := rotate("second", "third"); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should revoke the family of a replayed token", func(t *testing.T) {
+		if _, err := rotate("first", "stolen"); err != ErrRefreshTokenReused {
+			t.Fatalf("replay = %v, want %v", err, ErrRefreshTokenReused)
+		}
+		if _, err := rotate("third", "fourth"); err != ErrNotFound {
+			t.Errorf("latest token after the replay = %v, want %v", err, ErrNotFound)
+		}
+		if _, err := rotate("stolen", "fifth"); err != ErrNotFound {
+			t.Errorf("token handed out to the replay = %v, want %v", err, ErrNotFound)
+		}
+	})
+
+	t.Run("should keep the other families", func(t *testing.T) {
+		if _, err := rotate("laptop", "laptop2"); err != nil {
+			t.Errorf("other family = %v", err)
+		}
+	})
+
+	t.Run("should refuse expired and unknown tokens", func(t *testing.T) {
+		if err := s.RefreshToken.Create(c, user.ID, hash("expired"), -time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := rotate("expired", "next"); err != ErrNotFound {
+			t.Errorf("expired = %v, want %v", err, ErrNotFound)
+		}
+		if _, err := rotate("unknown", "next"); err != ErrNotFound {
+			t.Errorf("unknown = %v, want %v", err, ErrNotFound)
+		}
+	})
+
+	t.Run("should revoke a family or every token", func(t *testing.T) {
+		if err := s.RefreshToken.Revoke(c, user.ID, "laptop2"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := rotate("laptop2", "laptop3"); err != ErrNotFound {
+			t.Errorf("revoked family = %v, want %v", err, ErrNotFound)
+		}
+
+		if err := s.RefreshToken.Create(c, user.ID, hash("phone"), time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.RefreshToken.RevokeAll(c, user.ID); err != nil {
+			t.Fatal(err)
+		}
+		if n := count(t, db, `SELECT count(*) FROM refresh_tokens WHERE user_id = $1`, user.ID); n != 0 {
+			t.Errorf("%d tokens left", n)
+		}
+	})
+}
@@ -20,35 +20,118 @@ type Storage struct {
 		Update(context.Context, *Post) error
 		Delete(context.Context, int64) error
 		GetUserFeed(context.Context, int64, PaginatedQuery) ([]PostWithMetadata, error)
+		GetExplore(context.Context, int64, PaginatedQuery) ([]PostWithMetadata, error)
+		GetByIDs(context.Context, int64, []int64) ([]PostWithMetadata, error)
+		GetByUserID(context.Context, int64, int) ([]Post, error)
+		GetFollowedSince(context.Context, int64, int64, int) ([]Post, error)
+		GetByTag(context.Context, string, int) ([]Post, error)
+		IncrementViews(context.Context, int64) error
 	}
 	Users interface {
 		Create(context.Context, *User, *sql.Tx) error
 		GetByID(context.Context, int64) (*User, error)
 		GetByEmail(context.Context, string) (*User, error)
+		GetByUsername(context.Context, string) (*User, error)
+		UsernameAvailable(c context.Context, name string) (bool, error)
+		ChangeUsername(c context.Context, userID int64, name string, cooldown, hold time.Duration) (time.Time, error)
+		ResolveUsername(c context.Context, name string) (*User, error)
+		BackfillSkeletons(c context.Context, batch int) (int, int, error)
+		GetUsernameHistory(c context.Context, userID int64) ([]UsernameChange, error)
+		GetStats(c context.Context, userID, viewerID int64) (*UserStats, error)
+		UpdateProfile(context.Context, *User) ([]int64, error)
+		ChangePassword(context.Context, *User) error
+		CreatePasswordReset(c context.Context, userID int64, token string, exp time.Duration) error
+		ResetPassword(c context.Context, token string, u *User) error
+		RequestEmailChange(c context.Context, userID int64, email, token string, exp time.Duration) error
+		ConfirmEmailChange(c context.Context, token, revertToken string, revertExp time.Duration) (*EmailChange, error)
+		RevertEmailChange(c context.Context, token string) (*EmailChange, error)
 		CreateAndInvite(context.Context, *User, string, time.Duration) error
+		RenewInvitation(c context.Context, email, token string, exp time.Duration) (*User, error)
 		Activate(context.Context, string) error
 		Delete(context.Context, int64) error
+		Export(c context.Context, userID int64) (*UserExport, error)
+		ScheduleDeletion(c context.Context, userID int64, at time.Time) error
+		CancelDeletion(c context.Context, userID int64) error
+		PurgeDeleted(c context.Context, anonymize bool, limit int) ([]User, error)
 	}
 	Comment interface {
-		GetByPostID(context.Context, int64) ([]Comment, error)
+		GetByPostID(c context.Context, postID, viewerID int64) ([]Comment, error)
 		Create(context.Context, *Comment) error
 	}
 	Follower interface {
-		Follow(c context.Context, followerID, userID int64) error
+		Follow(c context.Context, followerID, userID int64) (bool, error)
 		Unfollow(c context.Context, followerID, userID int64) error
+		ApproveRequest(c context.Context, userID, followerID int64) error
+		RejectRequest(c context.Context, userID, followerID int64) error
+		CanSee(c context.Context, viewerID, authorID int64) (bool, error)
+		GetFollowerIDs(c context.Context, userID int64) ([]int64, error)
+		GetFollowers(c context.Context, userID int64, fq PaginatedQuery) ([]FollowUser, error)
+		GetFollowing(c context.Context, userID int64, fq PaginatedQuery) ([]FollowUser, error)
+		GetIncomingRequests(c context.Context, userID int64, fq PaginatedQuery) ([]FollowUser, error)
+		GetOutgoingRequests(c context.Context, userID int64, fq PaginatedQuery) ([]FollowUser, error)
+		GetSuggestions(c context.Context, userID int64, limit int) ([]SuggestedUser, error)
 	}
 	Role interface {
 		GetByName(context.Context, string) (*Role, error)
 	}
+	Reaction interface {
+		Upsert(context.Context, *Reaction) error
+		Delete(c context.Context, postID, userID int64) error
+	}
+	Mute interface {
+		MuteUser(context.Context, *MutedUser) error
+		UnmuteUser(c context.Context, userID, mutedUserID int64) error
+		GetMutedUsers(c context.Context, userID int64) ([]MutedUser, error)
+		CreateKeyword(context.Context, *MutedKeyword) error
+		DeleteKeyword(c context.Context, userID, keywordID int64) error
+		GetKeywords(c context.Context, userID int64) ([]MutedKeyword, error)
+		GetNotMuting(c context.Context, postID int64, userIDs []int64) ([]int64, error)
+	}
+	Block interface {
+		Block(context.Context, *BlockedUser) error
+		Unblock(c context.Context, userID, blockedUserID int64) error
+		GetBlockedUsers(c context.Context, userID int64) ([]BlockedUser, error)
+		NotBlocked(c context.Context, userID, otherID int64) (bool, error)
+	}
+	RefreshToken interface {
+		Create(c context.Context, userID int64, token string, exp time.Duration) error
+		Rotate(c context.Context, token, newToken string, exp time.Duration) (int64, error)
+		Revoke(c context.Context, userID int64, token string) error
+		RevokeAll(c context.Context, userID int64) error
+	}
+	TwoFactor interface {
+		Get(c context.Context, userID int64) (*TOTP, error)
+		Enroll(c context.Context, userID int64, secret string) error
+		Enable(c context.Context, userID, counter int64, codes []string) error
+		Disable(c context.Context, userID int64) error
+		UseCode(c context.Context, userID, counter int64) (bool, error)
+		UseRecoveryCode(c context.Context, userID int64, code string) (bool, error)
+		CreateChallenge(c context.Context, userID int64, token string, exp time.Duration) error
+		AttemptChallenge(c context.Context, token string, maxAttempts int) (int64, error)
+		DeleteChallenge(c context.Context, token string) error
+	}
+	Federation interface {
+		GetActorKey(context.Context, int64) (*ActorKey, error)
+		CreateActorKey(context.Context, *ActorKey) error
+		AddRemoteFollower(context.Context, *RemoteFollower) error
+		RemoveRemoteFollower(c context.Context, userID int64, actorID string) error
+		GetRemoteFollowers(context.Context, int64) ([]RemoteFollower, error)
+	}
 }
 
 func NewStorage(db *sql.DB) Storage {
 	return Storage{
-		Posts:    &PostStore{db},
-		Users:    &UserStore{db},
-		Comment:  &CommentStore{db},
-		Follower: &FollowerStore{db},
-		Role:     &RoleStore{db},
+		Posts:        &PostStore{db},
+		Users:        &UserStore{db},
+		Comment:      &CommentStore{db},
+		Follower:     &FollowerStore{db},
+		Role:         &RoleStore{db},
+		Reaction:     &ReactionStore{db},
+		Mute:         &MuteStore{db},
+		Federation:   &FederationStore{db},
+		Block:        &BlockStore{db},
+		RefreshToken: &RefreshTokenStore{db},
+		TwoFactor:    &TwoFactorStore{db},
 	}
 }
 
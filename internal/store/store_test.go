@@ -0,0 +1,146 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestStorage migrates a fresh schema of the Postgres database in
+// TEST_DB_ADDR and returns a Storage on it, the schema is dropped once the
+// test is done. Tests that need the database are skipped without it.
+func newTestStorage(t *testing.T) (Storage, *sql.DB) {
+	t.Helper()
+
+	addr := os.Getenv("TEST_DB_ADDR")
+	if addr == "" {
+		t.Skip("TEST_DB_ADDR is not set")
+	}
+
+	admin, err := sql.Open("postgres", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`)
+		admin.Close()
+	})
+
+	db, err := sql.Open("postgres", withSearchPath(addr, schema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrations, err := filepath.Glob("../db/migrations/*.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(migrations)
+
+	for _, path := range migrations {
+		query, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(string(query)); err != nil {
+			t.Fatalf("%s: %v", filepath.Base(path), err)
+		}
+	}
+
+	return NewStorage(db), db
+}
+
+// withSearchPath points the connections of addr at schema, with public
+// behind it for the extensions
+func withSearchPath(addr, schema string) string {
+	path := schema + ",public"
+
+	if strings.HasPrefix(addr, "postgres://") || strings.HasPrefix(addr, "postgresql://") {
+		u, err := url.Parse(addr)
+		if err == nil {
+			q := u.Query()
+			q.Set("search_path", path)
+			u.RawQuery = q.Encode()
+			return u.String()
+		}
+	}
+
+	return addr + " search_path=" + path
+}
+
+// createTestUser registers an active user named name
+func createTestUser(t *testing.T, s Storage, db *sql.DB, name string) *User {
+	t.Helper()
+
+	user := &User{Username: name, Email: name + "@example.com"}
+	if err := user.Password.Set("password"); err != nil {
+		t.Fatal(err)
+	}
+
+	err := withTx(db, context.Background(), func(tx *sql.Tx) error {
+		return s.Users.Create(context.Background(), user, tx)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec(`UPDATE users SET is_active = true WHERE id = $1`, user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	return user
+}
+
+func createTestPost(t *testing.T, s Storage, userID int64, title string, tags []string) *Post {
+	t.Helper()
+
+	post := &Post{UserID: userID, Title: title, Content: "content", Tags: tags}
+	if err := s.Posts.Create(context.Background(), post); err != nil {
+		t.Fatal(err)
+	}
+
+	return post
+}
+
+func postIDs(posts []PostWithMetadata) []int64 {
+	ids := make([]int64, 0, len(posts))
+	for _, p := range posts {
+		ids = append(ids, p.ID)
+	}
+
+	return ids
+}
+
+// follow makes followerID follow userID, which must be a public account
+func follow(t *testing.T, s Storage, followerID, userID int64) {
+	t.Helper()
+
+	if _, err := s.Follower.Follow(context.Background(), followerID, userID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// count runs a SELECT count(*) query
+func count(t *testing.T, db *sql.DB, query string, args ...any) int {
+	t.Helper()
+
+	var n int
+	if err := db.QueryRow(query, args...).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+
+	return n
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestTwoFactorEnable(t *testing.T) {
+	s, db := newTestStorage(t)
+	c := context.Background()
+
+	user := createTestUser(t, s, db, "gopher")
+	other := createTestUser(t, s, db, "other")
+
+	if err := s.RefreshToken.Create(c, user.ID, "phone", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RefreshToken.Create(c, other.ID, "laptop", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should need a pending enrollment", func(t *testing.T) {
+		if err := s.TwoFactor.Enable(c, user.ID, 1, []string{"code"}); err != ErrNotFound {
+			t.Errorf("enable = %v, want %v", err, ErrNotFound)
+		}
+		if n := count(t, db, `SELECT COUNT(*) FROM refresh_tokens WHERE user_id = $1`, user.ID); n != 1 {
+			t.Errorf("expected the refresh token kept, got %d", n)
+		}
+	})
+
+	t.Run("should revoke the refresh tokens of the user", func(t *testing.T) {
+		if err := s.TwoFactor.Enroll(c, user.ID, "SECRET"); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.TwoFactor.Enable(c, user.ID, 1, []string{"code"}); err != nil {
+			t.Fatal(err)
+		}
+
+		if n := count(t, db, `SELECT COUNT(*) FROM refresh_tokens WHERE user_id = $1`, user.ID); n != 0 {
+			t.Errorf("expected no refresh tokens, got %d", n)
+		}
+		if n := count(t, db, `SELECT COUNT(*) FROM refresh_tokens WHERE user_id = $1`, other.ID); n != 1 {
+			t.Errorf("expected the tokens of other users kept, got %d", n)
+		}
+	})
+
+	t.Run("should store recovery codes hashed and burn them once", func(t *testing.T) {
+		var hash string
+		if err := db.QueryRow(`SELECT code FROM recovery_codes WHERE user_id = $1`, user.ID).Scan(&hash); err != nil {
+			t.Fatal(err)
+		}
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte("code")) != nil {
+			t.Errorf("expected a bcrypt hash of the code, got %q", hash)
+		}
+
+		if ok, err := s.TwoFactor.UseRecoveryCode(c, user.ID, "wrong"); err != nil || ok {
+			t.Errorf("unknown code = %t, %v", ok, err)
+		}
+		if ok, err := s.TwoFactor.UseRecoveryCode(c, other.ID, "code"); err != nil || ok {
+			t.Errorf("code of another user = %t, %v", ok, err)
+		}
+		if ok, err := s.TwoFactor.UseRecoveryCode(c, user.ID, "code"); err != nil || !ok {
+			t.Errorf("code = %t, %v", ok, err)
+		}
+		if ok, err := s.TwoFactor.UseRecoveryCode(c, user.ID, "code"); err != nil || ok {
+			t.Errorf("used code = %t, %v", ok, err)
+		}
+	})
+}
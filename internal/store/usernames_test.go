@@ -0,0 +1,101 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestUsernameSkeletons(t *testing.T) {
+	s, db := newTestStorage(t)
+	c := context.Background()
+
+	createTestUser(t, s, db, "paypal")
+
+	create := func(name string) error {
+		user := &User{Username: name, Email: name + "@example.com"}
+		if err := user.Password.Set("password"); err != nil {
+			t.Fatal(err)
+		}
+		return withTx(db, c, func(tx *sql.Tx) error {
+			return s.Users.Create(c, user, tx)
+		})
+	}
+
+	t.Run("should refuse lookalikes in any case", func(t *testing.T) {
+		for _, name := range []string{"PAYPAL", "PayPa1", "paypaI"} {
+			if err := create(name); err != ErrDuplicateUsername {
+				t.Errorf("Create(%q) = %v, want %v", name, err, ErrDuplicateUsername)
+			}
+		}
+	})
+
+	t.Run("should map the skeleton index to a duplicate", func(t *testing.T) {
+		_, err := db.Exec(`
+			INSERT INTO users (username, username_skeleton, email, password, role_id)
+			SELECT 'paypa1', 'paypal', 'race@example.com', '', id FROM roles WHERE name = 'user'
+		`)
+		if uniqueUserErr(err) != ErrDuplicateUsername {
+			t.Errorf("concurrent lookalike = %v, want %v", err, ErrDuplicateUsername)
+		}
+	})
+
+	t.Run("should backfill the skeletons once per lookalike", func(t *testing.T) {
+		// accounts from before the skeleton column
+		ivan := createTestUser(t, s, db, "ivan")
+		if _, err := db.Exec(`UPDATE users SET username_skeleton = NULL WHERE id = $1`, ivan.ID); err != nil {
+			t.Fatal(err)
+		}
+		lvan := createTestUser(t, s, db, "lvan")
+		if _, err := db.Exec(`UPDATE users SET username_skeleton = NULL WHERE id = $1`, lvan.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		filled, skipped, err := s.Users.BackfillSkeletons(c, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if filled != 1 || skipped != 1 {
+			t.Errorf("filled %d, skipped %d, want 1 and 1", filled, skipped)
+		}
+
+		var skeleton sql.NullString
+		if err := db.QueryRow(`SELECT username_skeleton FROM users WHERE id = $1`, ivan.ID).Scan(&skeleton); err != nil {
+			t.Fatal(err)
+		}
+		if skeleton.String != "lvan" {
+			t.Errorf("skeleton of the older account = %v, want lvan", skeleton)
+		}
+
+		if err := create("IVAN"); err != ErrDuplicateUsername {
+			t.Errorf("Create(IVAN) = %v, want %v", err, ErrDuplicateUsername)
+		}
+
+		filled, skipped, err = s.Users.BackfillSkeletons(c, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if filled != 0 || skipped != 0 {
+			t.Errorf("second run filled %d, skipped %d, want nothing", filled, skipped)
+		}
+	})
+
+	t.Run("should anonymize several accounts", func(t *testing.T) {
+		a := createTestUser(t, s, db, "alice")
+		b := createTestUser(t, s, db, "bob")
+		for _, u := range []*User{a, b} {
+			if err := s.Users.ScheduleDeletion(c, u.ID, time.Now().Add(-time.Minute)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		users, err := s.Users.PurgeDeleted(c, true, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(users) != 2 {
+			t.Errorf("anonymized %d accounts, want 2", len(users))
+		}
+	})
+}
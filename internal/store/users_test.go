@@ -0,0 +1,80 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+func TestChangePasswordTime(t *testing.T) {
+	s, db := newTestStorage(t)
+	user := createTestUser(t, s, db, "gopher")
+
+	for i := 0; i < 5; i++ {
+		if err := user.Password.Set("secret"); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Users.ChangePassword(context.Background(), user); err != nil {
+			t.Fatal(err)
+		}
+
+		// a token issued right after the change has an iat of this second,
+		// the change must not land in a later one
+		now := time.Now()
+		if user.PasswordChangedAt == nil || user.PasswordChangedAt.Unix() > now.Unix() {
+			t.Fatalf("password_changed_at = %v, after %v", user.PasswordChangedAt, now)
+		}
+
+		stored, err := s.Users.GetByID(context.Background(), user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !stored.PasswordChangedAt.Equal(*user.PasswordChangedAt) {
+			t.Errorf("stored %v, returned %v", stored.PasswordChangedAt, user.PasswordChangedAt)
+		}
+	}
+}
+
+func TestRevertEmailChangeSignsOut(t *testing.T) {
+	s, db := newTestStorage(t)
+	user := createTestUser(t, s, db, "gopher")
+	c := context.Background()
+
+	hash := func(token string) string {
+		sum := sha256.Sum256([]byte(token))
+		return hex.EncodeToString(sum[:])
+	}
+
+	// whoever took the account over holds a session and moved the address
+	if err := s.RefreshToken.Create(c, user.ID, hash("session"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Users.RequestEmailChange(c, user.ID, "taken@example.com", hash("confirm"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Users.ConfirmEmailChange(c, "confirm", hash("revert"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	change, err := s.Users.RevertEmailChange(c, "revert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change.NewEmail != user.Email {
+		t.Errorf("reverted to %q, want %q", change.NewEmail, user.Email)
+	}
+
+	if _, err := s.RefreshToken.Rotate(c, "session", hash("next"), time.Hour); err != ErrNotFound {
+		t.Errorf("refresh after revert = %v, want %v", err, ErrNotFound)
+	}
+
+	stored, err := s.Users.GetByID(c, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Email != user.Email || stored.PasswordChangedAt == nil {
+		t.Errorf("email %q, password_changed_at %v after revert", stored.Email, stored.PasswordChangedAt)
+	}
+}
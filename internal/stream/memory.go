@@ -0,0 +1,140 @@
+package stream
+
+import (
+	"context"
+	"sync"
+)
+
+type MemoryBroker struct {
+	sync.Mutex
+	topics map[string]map[*Subscription]struct{}
+	buffer int
+	closed bool
+
+	// idle is called with the lock held when the last subscriber of a
+	// topic goes away, idles counts those calls
+	idle  func(topic string)
+	idles uint64
+}
+
+func NewMemoryBroker(buffer int) *MemoryBroker {
+	return &MemoryBroker{
+		topics: make(map[string]map[*Subscription]struct{}),
+		buffer: buffer,
+	}
+}
+
+func (b *MemoryBroker) Publish(c context.Context, e Event, topics ...string) error {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.closed {
+		return ErrClosed
+	}
+
+	for _, topic := range topics {
+		for s := range b.topics[topic] {
+			select {
+			case s.events <- e:
+			default:
+				// a lagging subscriber is dropped rather than blocking
+				// everyone else, it resumes from its last event id
+				b.remove(s)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (b *MemoryBroker) Subscribe(c context.Context, topic string) (*Subscription, error) {
+	return b.subscribe(topic, nil)
+}
+
+// subscribe calls first when topic has no subscribers yet. It runs without
+// the lock so a slow upstream doesn't hold up the other topics, and again if
+// a topic opened meanwhile went idle and undid it.
+func (b *MemoryBroker) subscribe(topic string, first func() error) (*Subscription, error) {
+	b.Lock()
+	defer b.Unlock()
+
+	for first != nil && !b.closed {
+		if _, ok := b.topics[topic]; ok {
+			break
+		}
+
+		idles := b.idles
+		b.Unlock()
+		err := first()
+		b.Lock()
+
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := b.topics[topic]; ok || b.idles == idles {
+			break
+		}
+	}
+
+	if b.closed {
+		return nil, ErrClosed
+	}
+
+	subs, ok := b.topics[topic]
+	if !ok {
+		subs = make(map[*Subscription]struct{})
+		b.topics[topic] = subs
+	}
+
+	events := make(chan Event, b.buffer)
+	s := &Subscription{
+		C:      events,
+		topic:  topic,
+		events: events,
+		cancel: func(s *Subscription) {
+			b.Lock()
+			defer b.Unlock()
+
+			b.remove(s)
+		},
+	}
+	subs[s] = struct{}{}
+
+	return s, nil
+}
+
+func (b *MemoryBroker) remove(s *Subscription) {
+	subs := b.topics[s.topic]
+	if _, ok := subs[s]; !ok {
+		return
+	}
+
+	delete(subs, s)
+	close(s.events)
+
+	if len(subs) == 0 {
+		delete(b.topics, s.topic)
+		if b.idle != nil {
+			b.idle(s.topic)
+			b.idles++
+		}
+	}
+}
+
+// Close ends every subscription, streams are closed before the server
+// waits for its connections during shutdown
+func (b *MemoryBroker) Close() error {
+	b.Lock()
+	defer b.Unlock()
+
+	b.closed = true
+	for _, subs := range b.topics {
+		for s := range subs {
+			delete(subs, s)
+			close(s.events)
+		}
+	}
+	b.topics = make(map[string]map[*Subscription]struct{})
+
+	return nil
+}
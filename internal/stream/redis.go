@@ -0,0 +1,72 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisBroker relays events between instances over Redis pub/sub. Each
+// instance holds one Redis subscription per topic with local subscribers
+// and dispatches the messages through a MemoryBroker.
+type RedisBroker struct {
+	rdb    *redis.Client
+	pubsub *redis.PubSub
+	local  *MemoryBroker
+}
+
+func NewRedisBroker(rdb *redis.Client, buffer int) *RedisBroker {
+	b := &RedisBroker{
+		rdb:    rdb,
+		pubsub: rdb.Subscribe(context.Background()),
+		local:  NewMemoryBroker(buffer),
+	}
+
+	b.local.idle = func(topic string) {
+		b.pubsub.Unsubscribe(context.Background(), topic)
+	}
+
+	go b.receive()
+
+	return b
+}
+
+func (b *RedisBroker) receive() {
+	for msg := range b.pubsub.Channel() {
+		var e Event
+		if err := json.Unmarshal([]byte(msg.Payload), &e); err != nil {
+			continue
+		}
+
+		b.local.Publish(context.Background(), e, msg.Channel)
+	}
+}
+
+func (b *RedisBroker) Publish(c context.Context, e Event, topics ...string) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.rdb.Pipelined(c, func(pipe redis.Pipeliner) error {
+		for _, topic := range topics {
+			pipe.Publish(c, topic, payload)
+		}
+		return nil
+	})
+
+	return err
+}
+
+func (b *RedisBroker) Subscribe(c context.Context, topic string) (*Subscription, error) {
+	return b.local.subscribe(topic, func() error {
+		return b.pubsub.Subscribe(c, topic)
+	})
+}
+
+func (b *RedisBroker) Close() error {
+	b.local.Close()
+
+	return b.pubsub.Close()
+}
@@ -0,0 +1,40 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var ErrClosed = errors.New("broker is closed")
+
+// Event is one message of a server-sent event stream
+type Event struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Data []byte `json:"data"`
+}
+
+type Broker interface {
+	Publish(c context.Context, e Event, topics ...string) error
+	Subscribe(c context.Context, topic string) (*Subscription, error)
+	Close() error
+}
+
+// Subscription receives the events published to one topic. C is closed
+// when the subscription is closed, when the subscriber falls too far behind
+// or when the broker shuts down.
+type Subscription struct {
+	C <-chan Event
+
+	topic  string
+	events chan Event
+	once   sync.Once
+	cancel func(*Subscription)
+}
+
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.cancel(s)
+	})
+}
@@ -0,0 +1,141 @@
+package stream
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryBroker(t *testing.T) {
+	c := context.Background()
+
+	t.Run("should deliver to subscribers of the topic", func(t *testing.T) {
+		b := NewMemoryBroker(1)
+
+		a, err := b.Subscribe(c, "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		other, err := b.Subscribe(c, "b")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := b.Publish(c, Event{ID: "1"}, "a"); err != nil {
+			t.Fatal(err)
+		}
+
+		if e := <-a.C; e.ID != "1" {
+			t.Errorf("expected event 1. Got %s", e.ID)
+		}
+		if len(other.C) != 0 {
+			t.Error("event delivered to another topic")
+		}
+	})
+
+	t.Run("should drop lagging subscribers", func(t *testing.T) {
+		b := NewMemoryBroker(1)
+
+		s, err := b.Subscribe(c, "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b.Publish(c, Event{ID: "1"}, "a")
+		b.Publish(c, Event{ID: "2"}, "a")
+
+		<-s.C
+		if _, ok := <-s.C; ok {
+			t.Error("expected the subscription to be closed")
+		}
+
+		// closing again is a no-op
+		s.Close()
+	})
+
+	t.Run("should not hold other topics up while subscribing upstream", func(t *testing.T) {
+		b := NewMemoryBroker(1)
+
+		a, err := b.Subscribe(c, "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		started, release := make(chan struct{}), make(chan struct{})
+		done := make(chan error)
+		go func() {
+			_, err := b.subscribe("slow", func() error {
+				close(started)
+				<-release
+				return nil
+			})
+			done <- err
+		}()
+		<-started
+
+		published := make(chan error)
+		go func() { published <- b.Publish(c, Event{ID: "1"}, "a") }()
+
+		select {
+		case err := <-published:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("publish waited on the upstream subscription")
+		}
+		if e := <-a.C; e.ID != "1" {
+			t.Errorf("expected event 1. Got %s", e.ID)
+		}
+
+		close(release)
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("should subscribe upstream again after the topic went idle", func(t *testing.T) {
+		b := NewMemoryBroker(1)
+		b.idle = func(string) {}
+
+		calls := 0
+		first := func() error {
+			calls++
+			if calls == 1 {
+				// another subscriber opens and leaves the topic meanwhile
+				other, err := b.Subscribe(c, "a")
+				if err != nil {
+					return err
+				}
+				other.Close()
+			}
+			return nil
+		}
+
+		if _, err := b.subscribe("a", first); err != nil {
+			t.Fatal(err)
+		}
+		if calls != 2 {
+			t.Errorf("expected a second upstream subscription, got %d", calls)
+		}
+	})
+
+	t.Run("should close subscriptions on close", func(t *testing.T) {
+		b := NewMemoryBroker(1)
+
+		s, err := b.Subscribe(c, "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b.Close()
+
+		if _, ok := <-s.C; ok {
+			t.Error("expected the subscription to be closed")
+		}
+
+		if _, err := b.Subscribe(c, "a"); err != ErrClosed {
+			t.Errorf("expected ErrClosed. Got %v", err)
+		}
+	})
+}
@@ -0,0 +1,116 @@
+package totp
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// the SHA-1 vectors of RFC 6238, cut down to six digits
+var rfcSecret = encoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+
+	tests := []struct {
+		name string
+		at   time.Time
+		code string
+		ok   bool
+	}{
+		{"current step", now, "050471", true},
+		{"previous step", now.Add(Period * time.Second), "050471", true},
+		{"next step", now.Add(-Period * time.Second), "050471", true},
+		{"too late", now.Add(2 * Period * time.Second), "050471", false},
+		{"wrong code", now, "123456", false},
+		{"short code", now, "05047", false},
+		{"padded code", now, " 050471 ", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter, ok := Validate(rfcSecret, tt.code, tt.at)
+			if ok != tt.ok {
+				t.Fatalf("Validate(%q) = %v, want %v", tt.code, ok, tt.ok)
+			}
+			if ok && counter != Counter(now) {
+				t.Errorf("counter = %d, want %d", counter, Counter(now))
+			}
+		})
+	}
+}
+
+func TestSecretAndURI(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := Code(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := Validate(strings.ToLower(secret), code, time.Now()); !ok {
+		t.Error("a fresh code of a generated secret was refused")
+	}
+
+	u, err := url.Parse(URI("Gopher Social", "gopher@example.com", secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Gopher Social:gopher@example.com" {
+		t.Errorf("URI = %s", u)
+	}
+	if u.Query().Get("secret") != secret || u.Query().Get("issuer") != "Gopher Social" {
+		t.Errorf("URI query = %s", u.RawQuery)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(RecoveryCodeCount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != RecoveryCodeCount {
+		t.Fatalf("got %d codes", len(codes))
+	}
+
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		if len(code) != recoveryCodeLength+1 || code[recoveryCodeLength/2] != '-' {
+			t.Errorf("malformed code %q", code)
+		}
+		if seen[code] {
+			t.Errorf("duplicate code %q", code)
+		}
+		seen[code] = true
+	}
+
+	if got := NormalizeRecoveryCode(" ABCDE-fghij "); got != "abcdefghij" {
+		t.Errorf("NormalizeRecoveryCode = %q", got)
+	}
+}
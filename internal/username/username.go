@@ -0,0 +1,185 @@
+// Package username holds the rules a username has to follow and the
+// skeletons used to tell lookalike usernames apart.
+package username
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	MinLength = 3
+	MaxLength = 30
+)
+
+var (
+	ErrReserved    = errors.New("username is reserved")
+	ErrMixedScript = errors.New("username mixes letters of different scripts")
+)
+
+// DefaultReserved are names kept away from users because they impersonate
+// the service or clash with routes. Policies always include them.
+var DefaultReserved = []string{
+	"about", "abuse", "admin", "administrator", "anonymous", "api", "available",
+	"deleted", "explore", "help", "login", "logout", "mail", "me", "moderator",
+	"mod", "null", "official", "postmaster", "register", "root", "security",
+	"settings", "signup", "staff", "suggestions", "support", "system",
+	"undefined", "user", "users", "webmaster", "www",
+}
+
+// Policy checks usernames against the character rules and the reserved
+// names, which are compared by skeleton so lookalikes are reserved too
+type Policy struct {
+	reserved map[string]bool
+}
+
+// NewPolicy returns a policy reserving DefaultReserved and extra, blank
+// entries are ignored
+func NewPolicy(extra []string) *Policy {
+	p := &Policy{reserved: make(map[string]bool)}
+
+	for _, name := range append(DefaultReserved, extra...) {
+		if name = strings.TrimSpace(name); name != "" {
+			p.reserved[Skeleton(name)] = true
+		}
+	}
+
+	return p
+}
+
+// Check returns name in the normalized form it is stored in, or why it
+// can't be used. A username is 3 to 30 letters of a single script, ASCII
+// digits and the separators '_', '.' and '-', starts and ends with a letter
+// or digit and never has two separators in a row.
+func (p *Policy) Check(name string) (string, error) {
+	name = norm.NFKC.String(name)
+
+	n := utf8.RuneCountInString(name)
+	if n < MinLength || n > MaxLength {
+		return "", fmt.Errorf("username must be between %d and %d characters", MinLength, MaxLength)
+	}
+
+	var script *unicode.RangeTable
+	prevSeparator := true
+	for _, r := range name {
+		switch {
+		case r >= '0' && r <= '9':
+			prevSeparator = false
+		case unicode.IsLetter(r):
+			s := scriptOf(r)
+			if s == nil {
+				return "", fmt.Errorf("username can't contain %q", r)
+			}
+			if script != nil && s != script {
+				return "", ErrMixedScript
+			}
+			script = s
+			prevSeparator = false
+		case isSeparator(r):
+			if prevSeparator {
+				return "", errors.New("username must start with a letter or digit and can't have two separators in a row")
+			}
+			prevSeparator = true
+		default:
+			return "", fmt.Errorf("username can't contain %q", r)
+		}
+	}
+
+	if prevSeparator {
+		return "", errors.New("username must end with a letter or digit")
+	}
+
+	if p.reserved[Skeleton(name)] {
+		return "", ErrReserved
+	}
+
+	return name, nil
+}
+
+// scripts usernames may be written in, a username keeps to one of them
+var scripts = []*unicode.RangeTable{
+	unicode.Latin, unicode.Cyrillic, unicode.Greek, unicode.Armenian,
+	unicode.Hebrew, unicode.Arabic, unicode.Devanagari, unicode.Thai,
+	unicode.Hangul, unicode.Han,
+}
+
+// scriptOf returns the script of letter r. Japanese mixes kana with kanji,
+// so both kana count as Han.
+func scriptOf(r rune) *unicode.RangeTable {
+	if unicode.In(r, unicode.Hiragana, unicode.Katakana) {
+		return unicode.Han
+	}
+
+	for _, s := range scripts {
+		if unicode.Is(s, r) {
+			return s
+		}
+	}
+
+	return nil
+}
+
+func isSeparator(r rune) bool {
+	return r == '_' || r == '.' || r == '-'
+}
+
+// capitals maps the capitals that only pass for a Latin letter in upper
+// case, their lowercase forms look different
+var capitals = map[rune]rune{
+	// Cyrillic
+	'В': 'b', 'Н': 'h', 'М': 'm', 'Т': 't',
+
+	// Greek
+	'Β': 'b', 'Ε': 'e', 'Ζ': 'z', 'Η': 'h', 'Μ': 'm', 'Ν': 'n', 'Τ': 't',
+	'Υ': 'y',
+}
+
+// confusables maps lowercase characters to the Latin letter they are
+// mistaken for, after a subset of the Unicode confusables (UTS #39). The
+// i, l and 1 family all become l, so "ADMIN" and "admln" meet "admin".
+var confusables = map[rune]rune{
+	'0': 'o', '1': 'l', 'i': 'l',
+
+	// Cyrillic
+	'а': 'a', 'е': 'e', 'к': 'k', 'о': 'o', 'р': 'p', 'с': 'c', 'у': 'y',
+	'х': 'x', 'і': 'l', 'ј': 'j', 'ѕ': 's', 'һ': 'h', 'ԁ': 'd', 'ԛ': 'q',
+	'ԝ': 'w', 'ӏ': 'l',
+
+	// Greek
+	'α': 'a', 'ι': 'l', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p', 'υ': 'u',
+	'χ': 'x',
+}
+
+// sequences are runs of Latin letters that read as a single one
+var sequences = strings.NewReplacer("rn", "m", "vv", "w", "cl", "d")
+
+// Skeleton reduces name to the form lookalike usernames share: compatibility
+// decomposed without accents, case folded, confusable characters replaced
+// and separators dropped. Two usernames with the same skeleton are too
+// close to tell apart.
+func Skeleton(name string) string {
+	var b strings.Builder
+
+	for _, r := range norm.NFKD.String(name) {
+		if unicode.Is(unicode.Mn, r) || isSeparator(r) {
+			continue
+		}
+		if c, ok := capitals[r]; ok {
+			b.WriteRune(c)
+			continue
+		}
+
+		r = unicode.ToLower(r)
+		if c, ok := confusables[r]; ok {
+			r = c
+		}
+		b.WriteRune(r)
+	}
+
+	return sequences.Replace(b.String())
+}
@@ -0,0 +1,79 @@
+package username
+
+import "testing"
+
+func TestCheck(t *testing.T) {
+	p := NewPolicy([]string{"gopher", " "})
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+		ok    bool
+	}{
+		{"plain", "alice_01", "alice_01", true},
+		{"single script", "мария", "мария", true},
+		{"fullwidth folded", "ａｌｉｃｅ", "alice", true},
+		{"too short", "al", "", false},
+		{"too long", "abcdefghijklmnopqrstuvwxyzabcde", "", false},
+		{"whitespace", "   ", "", false},
+		{"inner space", "al ice", "", false},
+		{"leading separator", "_alice", "", false},
+		{"trailing separator", "alice.", "", false},
+		{"double separator", "al__ice", "", false},
+		{"mixed script", "pаypal", "", false},
+		{"emoji", "alice🙂", "", false},
+		{"reserved", "admin", "", false},
+		{"reserved in any case", "Admin", "", false},
+		{"reserved in capitals", "ADMIN", "", false},
+		{"reserved with l for i", "admln", "", false},
+		{"reserved lookalike", "r00t", "", false},
+		{"configured reserved", "g0pher", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.Check(tt.input)
+			if (err == nil) != tt.ok {
+				t.Fatalf("Check(%q) error = %v, want ok %v", tt.input, err, tt.ok)
+			}
+			if got != tt.want {
+				t.Errorf("Check(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSkeleton(t *testing.T) {
+	tests := []struct {
+		a, b string
+	}{
+		{"paypal", "PayPal"},
+		{"paypal", "pаypаl"},
+		{"paypal", "paypa1"},
+		{"paypal", "paypaI"},
+		{"paypal", "pay_pal"},
+		{"modern", "modem"},
+		{"cafe", "café"},
+		{"wendy", "vvendy"},
+		{"ocean", "οcean"},
+		{"admin", "ADMIN"},
+		{"admin", "AdMiN"},
+		{"ivan", "Ivan"},
+		{"ivan", "lvan"},
+		{"ivan", "1van"},
+		{"ivan", "IVAN"},
+		{"hello", "НЕLLО"},
+		{"nina", "ΝΙΝΑ"},
+	}
+
+	for _, tt := range tests {
+		if Skeleton(tt.a) != Skeleton(tt.b) {
+			t.Errorf("Skeleton(%q) = %q, Skeleton(%q) = %q, want equal", tt.a, Skeleton(tt.a), tt.b, Skeleton(tt.b))
+		}
+	}
+
+	if Skeleton("alice") == Skeleton("bob") {
+		t.Error("different names share a skeleton")
+	}
+}